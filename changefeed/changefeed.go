@@ -0,0 +1,158 @@
+// Package changefeed keeps a bounded in-memory log of catalog changes and
+// fans them out to live subscribers, such as the SSE changes stream.
+package changefeed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// subscriberBuffer is how many changes a subscriber may fall behind before it
+// is dropped; it then reconnects and resumes from the ring buffer
+const subscriberBuffer = 256
+
+// Feed records product changes in a ring buffer and publishes them to
+// subscribers. Change IDs are "<epoch>-<sequence>": the epoch is the start
+// time of the feed, so IDs issued before a restart are told apart.
+type Feed struct {
+	mu          sync.Mutex
+	epoch       string
+	ring        []models.ProductChange
+	next        int    // ring slot written next
+	count       int    // changes held in the ring
+	lastSeq     uint64 // sequence number of the latest change
+	subscribers map[*Subscription]bool
+}
+
+// NewFeed creates a feed buffering the latest size changes; size must be positive
+func NewFeed(size int) (*Feed, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("changes buffer size must be positive, got %d", size)
+	}
+	return &Feed{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		ring:        make([]models.ProductChange, size),
+		subscribers: make(map[*Subscription]bool),
+	}, nil
+}
+
+// Subscription receives the changes of one category, or all of them
+type Subscription struct {
+	C        <-chan models.ProductChange // closed when the subscriber is closed or dropped
+	ch       chan models.ProductChange
+	category string
+	feed     *Feed
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.feed.remove(s)
+}
+
+// HandleProductChange records a product change and publishes it
+func (f *Feed) HandleProductChange(ctx context.Context, before, after *models.Product) error {
+	change := models.ProductChange{Timestamp: time.Now()}
+	switch {
+	case before == nil:
+		change.Type, change.ProductID, change.Category = models.ChangeCreated, after.ID, after.Category
+	case after == nil:
+		change.Type, change.ProductID, change.Category = models.ChangeDeleted, before.ID, before.Category
+	default:
+		change.Type, change.ProductID, change.Category = models.ChangeUpdated, after.ID, after.Category
+		if before.Category != after.Category {
+			change.PreviousCategory = before.Category
+		}
+		diff, err := models.ProductDiff(before, after)
+		if err != nil {
+			return err
+		}
+		change.Fields = models.ChangedFields(diff)
+	}
+
+	f.publish(change)
+	return nil
+}
+
+// publish assigns the next ID to a change, stores it and sends it to the
+// matching subscribers. Subscribers that fell too far behind are dropped.
+func (f *Feed) publish(change models.ProductChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastSeq++
+	change.ID = f.epoch + "-" + strconv.FormatUint(f.lastSeq, 10)
+	f.ring[f.next] = change
+	f.next = (f.next + 1) % len(f.ring)
+	f.count = min(f.count+1, len(f.ring))
+
+	for sub := range f.subscribers {
+		if !change.Matches(sub.category) {
+			continue
+		}
+		select {
+		case sub.ch <- change:
+		default:
+			log.Printf("[CHANGES] Dropping slow subscriber at change %s", change.ID)
+			f.remove(sub)
+		}
+	}
+}
+
+// Subscribe starts a subscription to changes of a category ("" for all). When
+// resuming after lastEventID, the buffered changes since then are returned
+// first; ok is false when some of them are no longer buffered, or the ID was
+// not issued by this feed (e.g. before a restart), and the subscriber must
+// reload its state.
+func (f *Feed) Subscribe(category string, lastEventID string) (missed []models.ProductChange, sub *Subscription, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan models.ProductChange, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, category: category, feed: f}
+	f.subscribers[sub] = true
+
+	if lastEventID == "" {
+		return nil, sub, true
+	}
+
+	seq, ok := f.sequence(lastEventID)
+	oldestSeq := f.lastSeq - uint64(f.count) + 1
+	if !ok || seq > f.lastSeq || seq+1 < oldestSeq {
+		return nil, sub, false
+	}
+
+	for i := f.count - int(f.lastSeq-seq); i < f.count; i++ {
+		change := f.ring[(f.next-f.count+i+len(f.ring))%len(f.ring)]
+		if change.Matches(category) {
+			missed = append(missed, change)
+		}
+	}
+	return missed, sub, true
+}
+
+// sequence returns the sequence number of a change ID issued by this feed
+func (f *Feed) sequence(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != f.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// remove unregisters a subscriber and closes its channel; callers hold f.mu
+func (f *Feed) remove(sub *Subscription) {
+	if f.subscribers[sub] {
+		delete(f.subscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,95 @@
+package changefeed
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// newTestFeed returns a feed of the given size holding n created products
+func newTestFeed(t *testing.T, size, n int) *Feed {
+	t.Helper()
+	feed, err := NewFeed(size)
+	if err != nil {
+		t.Fatalf("NewFeed(%d) returned error: %v", size, err)
+	}
+	feed.epoch = "e1"
+	for i := 0; i < n; i++ {
+		product := &models.Product{ID: string(rune('a' + i)), Category: "gaming"}
+		if err := feed.HandleProductChange(context.Background(), nil, product); err != nil {
+			t.Fatalf("HandleProductChange returned error: %v", err)
+		}
+	}
+	return feed
+}
+
+func changeIDs(changes []models.ProductChange) []string {
+	ids := []string{}
+	for _, change := range changes {
+		ids = append(ids, change.ID)
+	}
+	return ids
+}
+
+func TestNewFeedRejectsNonPositiveSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		if _, err := NewFeed(size); err == nil {
+			t.Errorf("NewFeed(%d) returned no error", size)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	tests := []struct {
+		name        string
+		size, n     int
+		lastEventID string
+		wantIDs     []string
+		wantOK      bool
+	}{
+		{"no resume", 3, 5, "", []string{}, true},
+		{"resume within ring", 5, 3, "e1-1", []string{"e1-2", "e1-3"}, true},
+		{"resume after wraparound", 3, 5, "e1-2", []string{"e1-3", "e1-4", "e1-5"}, true},
+		{"resume at latest", 3, 5, "e1-5", []string{}, true},
+		{"resume before any change", 3, 0, "e1-0", []string{}, true},
+		{"evicted ID", 3, 5, "e1-1", []string{}, false},
+		{"ID from another epoch", 3, 5, "e0-4", []string{}, false},
+		{"ID above the latest", 3, 5, "e1-6", []string{}, false},
+		{"ID without epoch", 3, 5, "4", []string{}, false},
+		{"malformed sequence", 3, 5, "e1-x", []string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := newTestFeed(t, tt.size, tt.n)
+			missed, sub, ok := feed.Subscribe("", tt.lastEventID)
+			defer sub.Close()
+
+			if ok != tt.wantOK {
+				t.Errorf("Subscribe(%q) ok = %v, want %v", tt.lastEventID, ok, tt.wantOK)
+			}
+			if got := changeIDs(missed); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("Subscribe(%q) missed = %v, want %v", tt.lastEventID, got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSubscribeFiltersMissedByCategory(t *testing.T) {
+	feed := newTestFeed(t, 4, 2)
+	other := &models.Product{ID: "z", Category: "audio"}
+	if err := feed.HandleProductChange(context.Background(), nil, other); err != nil {
+		t.Fatalf("HandleProductChange returned error: %v", err)
+	}
+
+	missed, sub, ok := feed.Subscribe("audio", "e1-1")
+	defer sub.Close()
+	if !ok {
+		t.Fatal("Subscribe returned ok = false")
+	}
+	if got, want := changeIDs(missed), []string{"e1-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missed = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+// Command releval measures search relevance against a judgment list.
+//
+// The judgment file maps each query to graded product IDs (0 = irrelevant,
+// higher = more relevant):
+//
+//	{
+//	  "gaming laptop": {"<product-id>": 3, "<product-id>": 1},
+//	  "wireless mouse": {"<product-id>": 2}
+//	}
+//
+// Each query is run through ProductRepository.SearchWithFallback with the
+// configured fallback steps, like the search endpoint, and scored with NDCG@k,
+// MRR and precision@k. With -compare, a second ranking profile is evaluated
+// and both are reported side by side.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/aditya/elasticsearch-products-api/config"
+	"github.com/aditya/elasticsearch-products-api/embedding"
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+)
+
+func main() {
+	judgmentsPath := flag.String("judgments", "", "JSON judgment file: query -> product ID -> grade (required)")
+	k := flag.Int("k", 10, "number of results evaluated per query")
+	minGrade := flag.Int("min-grade", 1, "lowest grade counted as relevant for MRR and precision")
+	profilePath := flag.String("profile", "", "JSON ranking profile overrides (default: configured ranking)")
+	comparePath := flag.String("compare", "", "JSON ranking profile overrides to compare against -profile")
+	flag.Parse()
+
+	if *judgmentsPath == "" || *k < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	judgments, err := loadJudgments(*judgmentsPath)
+	if err != nil {
+		log.Fatalf("Failed to load judgments: %v", err)
+	}
+
+	cfg := config.LoadConfig()
+
+	embedder, err := embedding.NewHashingEmbedder(cfg.EmbeddingDims)
+	if err != nil {
+		log.Fatalf("Invalid embedding configuration: %v", err)
+	}
+
+	if err := repository.ValidateFallbackSteps(cfg.SearchFallbackSteps); err != nil {
+		log.Fatalf("Invalid search fallback configuration: %v", err)
+	}
+
+	esClient, err := config.NewElasticsearchClient(cfg.ElasticsearchURL)
+	if err != nil {
+		log.Fatalf("Failed to create Elasticsearch client: %v", err)
+	}
+
+	// Same ranking setup as the API, without personalization
+	defaults := repository.DefaultRankingProfile()
+	defaults.TrendingWeight = cfg.TrendingBoostWeight
+	defaults.FreshnessWeight = cfg.FreshnessWeight
+
+	repo := repository.NewProductRepository(esClient, cfg.ElasticsearchIndex, embedder)
+	trending, err := repository.NewTrendingRepository(esClient, cfg.TrendingIndex, cfg.TrendingHalfLife, cfg.TrendingWindow)
+	if err != nil {
+		log.Fatalf("Invalid trending configuration: %v", err)
+	}
+	repo.SetTrending(trending)
+	repo.SetFreshness(repository.Freshness{
+		Function: cfg.FreshnessFunction,
+		Scale:    cfg.FreshnessScale,
+		Offset:   cfg.FreshnessOffset,
+		Decay:    cfg.FreshnessDecay,
+	}, cfg.NewArrivalsPeriod)
+	repo.SetPromotions(repository.NewPromotionRepository(esClient, cfg.PromotionIndex))
+	repo.SetCurrencies(repository.NewCurrencyRepository(esClient, cfg.CurrencyIndex, cfg.BaseCurrency))
+	repo.SetTaxonomy(repository.NewCategoryRepository(esClient, cfg.CategoryIndex))
+
+	profiles := []namedProfile{{name: "baseline", profile: defaults}}
+	if *profilePath != "" {
+		if profiles[0].profile, err = loadProfile(*profilePath, defaults); err != nil {
+			log.Fatalf("Failed to load profile: %v", err)
+		}
+		profiles[0].name = *profilePath
+	}
+	if *comparePath != "" {
+		compare, err := loadProfile(*comparePath, defaults)
+		if err != nil {
+			log.Fatalf("Failed to load comparison profile: %v", err)
+		}
+		profiles = append(profiles, namedProfile{name: *comparePath, profile: compare})
+	}
+
+	queries := make([]string, 0, len(judgments))
+	for query := range judgments {
+		queries = append(queries, query)
+	}
+	sort.Strings(queries)
+
+	ctx := context.Background()
+	results := make([][]queryMetrics, len(profiles))
+	for i, p := range profiles {
+		for _, query := range queries {
+			ranking, err := runQuery(ctx, repo, query, p.profile, *k, cfg.SearchFallbackSteps)
+			if err != nil {
+				log.Fatalf("Query %q failed: %v", query, err)
+			}
+			results[i] = append(results[i], evaluate(ranking, judgments[query], *k, *minGrade))
+		}
+	}
+
+	report(os.Stdout, profiles, queries, results, *k)
+}
+
+type namedProfile struct {
+	name    string
+	profile models.RankingProfile
+}
+
+// loadJudgments reads query -> product ID -> grade
+func loadJudgments(path string) (map[string]map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var judgments map[string]map[string]int
+	if err := json.Unmarshal(data, &judgments); err != nil {
+		return nil, fmt.Errorf("error decoding judgments: %w", err)
+	}
+	if len(judgments) == 0 {
+		return nil, fmt.Errorf("no queries in %s", path)
+	}
+	return judgments, nil
+}
+
+// loadProfile applies ranking profile overrides from a JSON file to the defaults
+func loadProfile(path string, defaults models.RankingProfile) (models.RankingProfile, error) {
+	profile := defaults
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return profile, err
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("error decoding profile: %w", err)
+	}
+	return profile, repository.ValidateRankingProfile(profile)
+}
+
+// runQuery returns the IDs of the top k products for a query under a profile,
+// searching the way the search endpoint does
+func runQuery(ctx context.Context, repo *repository.ProductRepository, query string, profile models.RankingProfile, k int, steps []string) ([]string, error) {
+	result, err := repo.SearchWithFallback(ctx, &models.ProductSearchRequest{
+		Query:    query,
+		PageSize: k,
+		Ranking:  &profile,
+	}, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(result.Products))
+	for i, product := range result.Products {
+		ids[i] = product.ID
+	}
+	return ids, nil
+}
+
+// report prints per-query and mean metrics, one column group per profile,
+// followed by the difference when two profiles are compared
+func report(out io.Writer, profiles []namedProfile, queries []string, results [][]queryMetrics, k int) {
+	for i, p := range profiles {
+		fmt.Fprintf(out, "profile %c: %s\n", 'A'+i, p.name)
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	header := "query\t"
+	for i := range profiles {
+		header += fmt.Sprintf("%c NDCG@%d\t%c MRR\t%c P@%d\t", 'A'+i, k, 'A'+i, 'A'+i, k)
+	}
+	if len(profiles) == 2 {
+		header += fmt.Sprintf("Δ NDCG@%d\tΔ MRR\tΔ P@%d\t", k, k)
+	}
+	fmt.Fprintln(w, header)
+
+	row := func(label string, metrics []queryMetrics) {
+		line := label + "\t"
+		for _, m := range metrics {
+			line += fmt.Sprintf("%.3f\t%.3f\t%.3f\t", m.NDCG, m.MRR, m.Precision)
+		}
+		if len(metrics) == 2 {
+			a, b := metrics[0], metrics[1]
+			line += fmt.Sprintf("%+.3f\t%+.3f\t%+.3f\t", b.NDCG-a.NDCG, b.MRR-a.MRR, b.Precision-a.Precision)
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	for q, query := range queries {
+		metrics := make([]queryMetrics, len(profiles))
+		for i := range profiles {
+			metrics[i] = results[i][q]
+		}
+		row(query, metrics)
+	}
+
+	overall := make([]queryMetrics, len(profiles))
+	for i := range profiles {
+		overall[i] = mean(results[i])
+	}
+	row(fmt.Sprintf("MEAN (%d queries)", len(queries)), overall)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// queryMetrics holds the relevance metrics of one ranked result list
+type queryMetrics struct {
+	NDCG      float64
+	MRR       float64
+	Precision float64
+}
+
+// evaluate scores a ranking against graded judgments. Unjudged products count
+// as grade 0; products graded at least minGrade are relevant.
+func evaluate(ranking []string, grades map[string]int, k, minGrade int) queryMetrics {
+	if len(ranking) > k {
+		ranking = ranking[:k]
+	}
+
+	var metrics queryMetrics
+	relevant := 0
+	dcg := 0.0
+	for i, id := range ranking {
+		grade := grades[id]
+		dcg += gain(grade) / math.Log2(float64(i+2))
+		if grade >= minGrade {
+			relevant++
+			if metrics.MRR == 0 {
+				metrics.MRR = 1 / float64(i+1)
+			}
+		}
+	}
+
+	if idcg := idealDCG(grades, k); idcg > 0 {
+		metrics.NDCG = dcg / idcg
+	}
+	metrics.Precision = float64(relevant) / float64(k)
+	return metrics
+}
+
+// idealDCG is the DCG of the best possible ranking of the judged products
+func idealDCG(grades map[string]int, k int) float64 {
+	sorted := make([]int, 0, len(grades))
+	for _, grade := range grades {
+		sorted = append(sorted, grade)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	if len(sorted) > k {
+		sorted = sorted[:k]
+	}
+
+	idcg := 0.0
+	for i, grade := range sorted {
+		idcg += gain(grade) / math.Log2(float64(i+2))
+	}
+	return idcg
+}
+
+// gain is the exponential gain 2^grade - 1 of NDCG
+func gain(grade int) float64 {
+	if grade <= 0 {
+		return 0
+	}
+	return math.Pow(2, float64(grade)) - 1
+}
+
+// mean averages the metrics of several queries
+func mean(all []queryMetrics) queryMetrics {
+	var total queryMetrics
+	if len(all) == 0 {
+		return total
+	}
+	for _, m := range all {
+		total.NDCG += m.NDCG
+		total.MRR += m.MRR
+		total.Precision += m.Precision
+	}
+	n := float64(len(all))
+	return queryMetrics{NDCG: total.NDCG / n, MRR: total.MRR / n, Precision: total.Precision / n}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aditya/elasticsearch-products-api/config"
+	"github.com/aditya/elasticsearch-products-api/embedding"
 	"github.com/aditya/elasticsearch-products-api/models"
 	"github.com/aditya/elasticsearch-products-api/repository"
 )
@@ -15,16 +16,21 @@ import (
 func main() {
 	cfg := config.LoadConfig()
 
+	embedder, err := embedding.NewHashingEmbedder(cfg.EmbeddingDims)
+	if err != nil {
+		log.Fatalf("Invalid embedding configuration: %v", err)
+	}
+
 	esClient, err := config.NewElasticsearchClient(cfg.ElasticsearchURL)
 	if err != nil {
 		log.Fatalf("Failed to create Elasticsearch client: %v", err)
 	}
 
-	if err := config.CreateProductIndex(esClient, cfg.ElasticsearchIndex); err != nil {
+	if err := config.CreateProductIndex(esClient, cfg.ElasticsearchIndex, cfg.EmbeddingDims); err != nil {
 		log.Fatalf("Failed to create index: %v", err)
 	}
 
-	repo := repository.NewProductRepository(esClient, cfg.ElasticsearchIndex)
+	repo := repository.NewProductRepository(esClient, cfg.ElasticsearchIndex, embedder)
 
 	seedProducts(repo, 100)
 }
@@ -3,14 +3,69 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	ServerPort         string
-	ElasticsearchURL   string
-	ElasticsearchIndex string
+	ServerPort          string
+	ElasticsearchURL    string
+	ElasticsearchIndex  string
+	EventsIndex         string
+	CoOccurrenceIndex   string
+	TrendingIndex       string
+	FeatureLogIndex     string
+	AnalyticsIndex      string
+	SuggestionIndex     string
+	AlertIndex          string
+	AlertQueueIndex     string
+	WebhookIndex        string
+	DeliveryIndex       string
+	AuditIndex          string
+	PromotionIndex      string
+	CurrencyIndex       string
+	BaseCurrency        string
+	CurrencyRates       []string
+	CategoryIndex       string
+	SearchFallbackSteps []string
+	EmbeddingDims       int
+	TrendingHalfLife    time.Duration
+	TrendingWindow      time.Duration
+	TrendingBoostWeight float64
+	FreshnessFunction   string
+	FreshnessScale      time.Duration
+	FreshnessOffset     time.Duration
+	FreshnessDecay      float64
+	FreshnessWeight     float64
+	NewArrivalsPeriod   time.Duration
+	AffinityCategory    float64
+	AffinityPriceBand   float64
+	AffinityHalfLife    time.Duration
+	ProfileStoreSize    int
+	ExperimentsFile     string
+	ShadowSampleRate    float64
+	ShadowProfileFile   string
+	LTRSampleRate       float64
+	SearchLogBuffer     int
+	SearchLogFlush      time.Duration
+	SuggestionWindow    time.Duration
+	SuggestionMinCount  int
+	SuggestionRefresh   time.Duration
+	SuggestionBlocklist []string
+	AlertNotifier       string
+	AlertNotifierTarget string
+	AlertPollInterval   time.Duration
+	WebhookMaxAttempts  int
+	WebhookRetryBase    time.Duration
+	WebhookPollInterval time.Duration
+	ChangeBufferSize    int
+	ChangeHeartbeat     time.Duration
+	TrashRetention      time.Duration
+	TrashPurgeInterval  time.Duration
+	ScheduleInterval    time.Duration
 }
 
 func LoadConfig() *Config {
@@ -20,9 +75,61 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		ServerPort:         getEnv("SERVER_PORT", "8080"),
-		ElasticsearchURL:   getEnv("ELASTICSEARCH_URL", "http://localhost:9200"),
-		ElasticsearchIndex: getEnv("ELASTICSEARCH_INDEX", "products"),
+		ServerPort:          getEnv("SERVER_PORT", "8080"),
+		ElasticsearchURL:    getEnv("ELASTICSEARCH_URL", "http://localhost:9200"),
+		ElasticsearchIndex:  getEnv("ELASTICSEARCH_INDEX", "products"),
+		EventsIndex:         getEnv("EVENTS_INDEX", "product_events"),
+		CoOccurrenceIndex:   getEnv("COOCCURRENCE_INDEX", "product_cooccurrence"),
+		TrendingIndex:       getEnv("TRENDING_INDEX", "product_trending"),
+		FeatureLogIndex:     getEnv("FEATURE_LOG_INDEX", "search_features"),
+		AnalyticsIndex:      getEnv("ANALYTICS_INDEX", "search_analytics"),
+		SuggestionIndex:     getEnv("SUGGESTION_INDEX", "query_suggestions"),
+		AlertIndex:          getEnv("ALERT_INDEX", "product_alerts"),
+		AlertQueueIndex:     getEnv("ALERT_QUEUE_INDEX", "product_alert_queue"),
+		WebhookIndex:        getEnv("WEBHOOK_INDEX", "webhooks"),
+		DeliveryIndex:       getEnv("WEBHOOK_DELIVERY_INDEX", "webhook_deliveries"),
+		AuditIndex:          getEnv("AUDIT_INDEX", "product_history"),
+		PromotionIndex:      getEnv("PROMOTION_INDEX", "promotions"),
+		CurrencyIndex:       getEnv("CURRENCY_INDEX", "currency_rates"),
+		BaseCurrency:        getEnv("BASE_CURRENCY", "USD"),
+		CurrencyRates:       getEnvList("CURRENCY_RATES", "IDR:16000,SGD:1.35"),
+		CategoryIndex:       getEnv("CATEGORY_INDEX", "categories"),
+		SearchFallbackSteps: getEnvList("SEARCH_FALLBACK_STEPS", "drop_price,drop_category,relax_text,trending"),
+		EmbeddingDims:       getEnvInt("EMBEDDING_DIMS", 256),
+		TrendingHalfLife:    getEnvDuration("TRENDING_HALF_LIFE", 6*time.Hour),
+		TrendingWindow:      getEnvDuration("TRENDING_WINDOW", 24*time.Hour),
+		TrendingBoostWeight: getEnvFloat("TRENDING_BOOST_WEIGHT", 0),
+		FreshnessFunction:   getEnv("FRESHNESS_FUNCTION", "gauss"),
+		FreshnessScale:      getEnvDuration("FRESHNESS_SCALE", 14*24*time.Hour),
+		FreshnessOffset:     getEnvDuration("FRESHNESS_OFFSET", 3*24*time.Hour),
+		FreshnessDecay:      getEnvFloat("FRESHNESS_DECAY", 0.5),
+		FreshnessWeight:     getEnvFloat("FRESHNESS_WEIGHT", 0),
+		NewArrivalsPeriod:   getEnvDuration("NEW_ARRIVALS_PERIOD", 30*24*time.Hour),
+		AffinityCategory:    getEnvFloat("AFFINITY_CATEGORY_WEIGHT", 0.5),
+		AffinityPriceBand:   getEnvFloat("AFFINITY_PRICE_WEIGHT", 0.2),
+		AffinityHalfLife:    getEnvDuration("AFFINITY_HALF_LIFE", 7*24*time.Hour),
+		ProfileStoreSize:    getEnvInt("PROFILE_STORE_SIZE", 100000),
+		ExperimentsFile:     getEnv("EXPERIMENTS_FILE", ""),
+		ShadowSampleRate:    getEnvFloat("SHADOW_SAMPLE_RATE", 0),
+		ShadowProfileFile:   getEnv("SHADOW_PROFILE_FILE", "shadow_profile.json"),
+		LTRSampleRate:       getEnvFloat("LTR_SAMPLE_RATE", 0),
+		SearchLogBuffer:     getEnvInt("SEARCH_LOG_BUFFER", 10000),
+		SearchLogFlush:      getEnvDuration("SEARCH_LOG_FLUSH_INTERVAL", 5*time.Second),
+		SuggestionWindow:    getEnvDuration("SUGGESTION_WINDOW", 30*24*time.Hour),
+		SuggestionMinCount:  getEnvInt("SUGGESTION_MIN_SEARCHES", 3),
+		SuggestionRefresh:   getEnvDuration("SUGGESTION_REFRESH_INTERVAL", time.Hour),
+		SuggestionBlocklist: getEnvList("SUGGESTION_BLOCKLIST", "none"),
+		AlertNotifier:       getEnv("ALERT_NOTIFIER", "log"),
+		AlertNotifierTarget: getEnv("ALERT_NOTIFIER_TARGET", ""),
+		AlertPollInterval:   getEnvDuration("ALERT_POLL_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookRetryBase:    getEnvDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+		WebhookPollInterval: getEnvDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		ChangeBufferSize:    getEnvInt("CHANGES_BUFFER_SIZE", 1000),
+		ChangeHeartbeat:     getEnvDuration("CHANGES_HEARTBEAT_INTERVAL", 15*time.Second),
+		TrashRetention:      getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval:  getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		ScheduleInterval:    getEnvDuration("PUBLISH_SCHEDULE_INTERVAL", time.Minute),
 	}
 }
 
@@ -32,3 +139,61 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt reads an integer, falling back to the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		log.Printf("Invalid integer for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvFloat reads a float, falling back to the default when unset or invalid
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, strconv.FormatFloat(defaultValue, 'f', -1, 64)), 64)
+	if err != nil {
+		log.Printf("Invalid number for %s, using default %v", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration reads a duration such as "6h" or "14d", falling back to the default when unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := ParseDuration(getEnv(key, defaultValue.String()))
+	if err != nil {
+		log.Printf("Invalid duration for %s, using default %s", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// ParseDuration parses a Go duration, additionally accepting whole days ("7d")
+func ParseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// getEnvList reads a comma-separated list; the value "none" yields an empty list
+func getEnvList(key, defaultValue string) []string {
+	value := getEnv(key, defaultValue)
+	if value == "none" {
+		return []string{}
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
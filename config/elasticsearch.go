@@ -35,7 +35,7 @@ func NewElasticsearchClient(url string) (*elasticsearch.Client, error) {
 	return client, nil
 }
 
-func CreateProductIndex(client *elasticsearch.Client, indexName string) error {
+func CreateProductIndex(client *elasticsearch.Client, indexName string, embeddingDims int) error {
 	ctx := context.Background()
 
 	// Check if index already exists
@@ -47,112 +47,178 @@ func CreateProductIndex(client *elasticsearch.Client, indexName string) error {
 
 	if exists.StatusCode == 200 {
 		log.Printf("Index '%s' already exists\n", indexName)
-		return nil
+		return updateProductMapping(client, indexName, embeddingDims)
 	}
 
 	// Define index mapping
 	mapping := map[string]interface{}{
-		"settings": map[string]interface{}{
-			"analysis": map[string]interface{}{
-				"analyzer": map[string]interface{}{
-					"autocomplete": map[string]interface{}{
-						"tokenizer": "autocomplete_tokenizer",
-						"filter":    []string{"lowercase"},
-					},
-					"autocomplete_search": map[string]interface{}{
-						"tokenizer": "lowercase",
-					},
+		"settings": productSettings(),
+		"mappings": map[string]interface{}{
+			"properties": productProperties(embeddingDims),
+		},
+	}
+
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("error marshaling mapping: %w", err)
+	}
+
+	res, err := client.Indices.Create(
+		indexName,
+		client.Indices.Create.WithContext(ctx),
+		client.Indices.Create.WithBody(bytes.NewReader(mappingJSON)),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating index: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error: %s", res.String())
+	}
+
+	log.Printf("Index '%s' created successfully\n", indexName)
+	return nil
+}
+
+// productSettings returns the analysis settings of the products index
+func productSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"analyzer": map[string]interface{}{
+				"autocomplete": map[string]interface{}{
+					"tokenizer": "autocomplete_tokenizer",
+					"filter":    []string{"lowercase"},
+				},
+				"autocomplete_search": map[string]interface{}{
+					"tokenizer": "lowercase",
 				},
-				"tokenizer": map[string]interface{}{
-					"autocomplete_tokenizer": map[string]interface{}{
-						"type":        "edge_ngram",
-						"min_gram":    3,
-						"max_gram":    15,
-						"token_chars": []string{"letter", "digit"},
-					},
+			},
+			"tokenizer": map[string]interface{}{
+				"autocomplete_tokenizer": map[string]interface{}{
+					"type":        "edge_ngram",
+					"min_gram":    3,
+					"max_gram":    15,
+					"token_chars": []string{"letter", "digit"},
 				},
 			},
 		},
-		"mappings": map[string]interface{}{
-			"properties": map[string]interface{}{
-				"id": map[string]interface{}{
-					"type": "keyword",
-				},
-				"name": map[string]interface{}{
-					"type": "text",
-					"fields": map[string]interface{}{
-						"keyword": map[string]interface{}{
-							"type": "keyword",
-						},
-						"autocomplete": map[string]interface{}{
-							"type":            "text",
-							"analyzer":        "autocomplete",
-							"search_analyzer": "autocomplete_search",
-						},
-					},
-				},
-				"description": map[string]interface{}{
-					"type": "text",
-					"fields": map[string]interface{}{
-						"autocomplete": map[string]interface{}{
-							"type":            "text",
-							"analyzer":        "autocomplete",
-							"search_analyzer": "autocomplete_search",
-						},
-					},
-				},
-				"price": map[string]interface{}{
-					"type": "float",
-				},
-				"category": map[string]interface{}{
+	}
+}
+
+// productProperties returns the field mappings of the products index
+func productProperties(embeddingDims int) map[string]interface{} {
+	return map[string]interface{}{
+		"id": map[string]interface{}{
+			"type": "keyword",
+		},
+		"name": map[string]interface{}{
+			"type": "text",
+			"fields": map[string]interface{}{
+				"keyword": map[string]interface{}{
 					"type": "keyword",
 				},
-				"stock": map[string]interface{}{
-					"type": "integer",
+				"autocomplete": map[string]interface{}{
+					"type":            "text",
+					"analyzer":        "autocomplete",
+					"search_analyzer": "autocomplete_search",
 				},
-				"rating": map[string]interface{}{
-					"type": "float",
-				},
-				"review_count": map[string]interface{}{
-					"type": "integer",
-				},
-				"sales_count": map[string]interface{}{
-					"type": "integer",
-				},
-				"view_count": map[string]interface{}{
-					"type": "integer",
-				},
-				"ctr": map[string]interface{}{
-					"type": "float",
-				},
-				"is_promoted": map[string]interface{}{
-					"type": "boolean",
-				},
-				"margin": map[string]interface{}{
-					"type": "float",
-				},
-				"created_at": map[string]interface{}{
-					"type": "date",
-				},
-				"updated_at": map[string]interface{}{
-					"type": "date",
+			},
+		},
+		"description": map[string]interface{}{
+			"type": "text",
+			"fields": map[string]interface{}{
+				"autocomplete": map[string]interface{}{
+					"type":            "text",
+					"analyzer":        "autocomplete",
+					"search_analyzer": "autocomplete_search",
 				},
 			},
 		},
+		"price": map[string]interface{}{
+			"type": "float",
+		},
+		"currency": map[string]interface{}{
+			"type": "keyword",
+		},
+		"base_price": map[string]interface{}{
+			"type": "double",
+		},
+		"category": map[string]interface{}{
+			"type": "keyword",
+		},
+		// The path of the category and of each ancestor, so a term on a
+		// parent path matches its descendants
+		"category_paths": map[string]interface{}{
+			"type": "keyword",
+		},
+		"stock": map[string]interface{}{
+			"type": "integer",
+		},
+		"rating": map[string]interface{}{
+			"type": "float",
+		},
+		"review_count": map[string]interface{}{
+			"type": "integer",
+		},
+		"sales_count": map[string]interface{}{
+			"type": "integer",
+		},
+		"view_count": map[string]interface{}{
+			"type": "integer",
+		},
+		"ctr": map[string]interface{}{
+			"type": "float",
+		},
+		"is_promoted": map[string]interface{}{
+			"type": "boolean",
+		},
+		"margin": map[string]interface{}{
+			"type": "float",
+		},
+		"created_at": map[string]interface{}{
+			"type": "date",
+		},
+		"updated_at": map[string]interface{}{
+			"type": "date",
+		},
+		"deleted_at": map[string]interface{}{
+			"type": "date",
+		},
+		"status": map[string]interface{}{
+			"type": "keyword",
+		},
+		"publish_at": map[string]interface{}{
+			"type": "date",
+		},
+		"unpublish_at": map[string]interface{}{
+			"type": "date",
+		},
+		"embedding": map[string]interface{}{
+			"type":       "dense_vector",
+			"dims":       embeddingDims,
+			"index":      true,
+			"similarity": "cosine",
+		},
 	}
+}
 
-	mappingJSON, err := json.Marshal(mapping)
+// updateProductMapping adds fields introduced after an index was created.
+// Existing field definitions are unchanged, so this is a no-op for them.
+func updateProductMapping(client *elasticsearch.Client, indexName string, embeddingDims int) error {
+	mappingJSON, err := json.Marshal(map[string]interface{}{
+		"properties": productProperties(embeddingDims),
+	})
 	if err != nil {
 		return fmt.Errorf("error marshaling mapping: %w", err)
 	}
 
-	res, err := client.Indices.Create(
-		indexName,
-		client.Indices.Create.WithContext(ctx),
-		client.Indices.Create.WithBody(bytes.NewReader(mappingJSON)),
+	res, err := client.Indices.PutMapping(
+		[]string{indexName},
+		bytes.NewReader(mappingJSON),
 	)
 	if err != nil {
-		return fmt.Errorf("error creating index: %w", err)
+		return fmt.Errorf("error updating index mapping: %w", err)
 	}
 	defer res.Body.Close()
 
@@ -160,6 +226,5 @@ func CreateProductIndex(client *elasticsearch.Client, indexName string) error {
 		return fmt.Errorf("error: %s", res.String())
 	}
 
-	log.Printf("Index '%s' created successfully\n", indexName)
 	return nil
 }
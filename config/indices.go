@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// CreateEventIndex creates the index holding raw shopper events
+func CreateEventIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"id":          map[string]interface{}{"type": "keyword"},
+		"type":        map[string]interface{}{"type": "keyword"},
+		"product_ids": map[string]interface{}{"type": "keyword"},
+		"order_id":    map[string]interface{}{"type": "keyword"},
+		"user_id":     map[string]interface{}{"type": "keyword"},
+		"session_id":  map[string]interface{}{"type": "keyword"},
+		"search_id":   map[string]interface{}{"type": "keyword"},
+		"experiment":  map[string]interface{}{"type": "keyword"},
+		"variant":     map[string]interface{}{"type": "keyword"},
+		"timestamp":   map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateCoOccurrenceIndex creates the index holding co-purchase counts, one
+// document per ordered (product, related product) pair
+func CreateCoOccurrenceIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"product_id":        map[string]interface{}{"type": "keyword"},
+		"related_id":        map[string]interface{}{"type": "keyword"},
+		"count":             map[string]interface{}{"type": "integer"},
+		"last_purchased_at": map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateTrendingIndex creates the index holding hourly event counters per product
+func CreateTrendingIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"product_id":   map[string]interface{}{"type": "keyword"},
+		"bucket":       map[string]interface{}{"type": "date"},
+		"views":        map[string]interface{}{"type": "integer"},
+		"clicks":       map[string]interface{}{"type": "integer"},
+		"add_to_carts": map[string]interface{}{"type": "integer"},
+		"purchases":    map[string]interface{}{"type": "integer"},
+		"weighted":     map[string]interface{}{"type": "float"},
+	})
+}
+
+// CreateFeatureLogIndex creates the index holding logged learning-to-rank
+// feature vectors, one document per returned product
+func CreateFeatureLogIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"search_id":  map[string]interface{}{"type": "keyword"},
+		"query":      map[string]interface{}{"type": "keyword"},
+		"product_id": map[string]interface{}{"type": "keyword"},
+		"position":   map[string]interface{}{"type": "integer"},
+		"features":   map[string]interface{}{"type": "object", "enabled": false},
+		"user_id":    map[string]interface{}{"type": "keyword"},
+		"session_id": map[string]interface{}{"type": "keyword"},
+		"timestamp":  map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateSearchLogIndex creates the search analytics index, one document per served search
+func CreateSearchLogIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"search_id":    map[string]interface{}{"type": "keyword"},
+		"query":        map[string]interface{}{"type": "keyword"},
+		"filters":      map[string]interface{}{"type": "keyword"},
+		"category":     map[string]interface{}{"type": "keyword"},
+		"total":        map[string]interface{}{"type": "integer"},
+		"zero_results": map[string]interface{}{"type": "boolean"},
+		"relaxation":   map[string]interface{}{"type": "keyword"},
+		"latency_ms":   map[string]interface{}{"type": "long"},
+		"page":         map[string]interface{}{"type": "integer"},
+		"user_id":      map[string]interface{}{"type": "keyword"},
+		"session_id":   map[string]interface{}{"type": "keyword"},
+		"timestamp":    map[string]interface{}{"type": "date"},
+		"clicked":      map[string]interface{}{"type": "boolean"},
+	})
+}
+
+// CreateSuggestionIndex creates the index of popular queries mined for autocomplete
+func CreateSuggestionIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"query":     map[string]interface{}{"type": "keyword"},
+		"text":      map[string]interface{}{"type": "search_as_you_type"},
+		"searches":  map[string]interface{}{"type": "integer"},
+		"last_seen": map[string]interface{}{"type": "date"},
+		"mined_at":  map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateAlertIndex creates the index of saved search alerts. Each alert is a
+// percolator query, so the index also maps the product fields the queries
+// reference, analyzed like the products index.
+func CreateAlertIndex(client *elasticsearch.Client, indexName string, embeddingDims int) error {
+	properties := productProperties(embeddingDims)
+	properties["query"] = map[string]interface{}{"type": "percolator"}
+	properties["alert"] = map[string]interface{}{
+		"properties": map[string]interface{}{
+			"id":         map[string]interface{}{"type": "keyword"},
+			"user_id":    map[string]interface{}{"type": "keyword"},
+			"name":       map[string]interface{}{"type": "keyword"},
+			"search":     map[string]interface{}{"type": "object", "enabled": false},
+			"created_at": map[string]interface{}{"type": "date"},
+		},
+	}
+	return createIndexWithSettings(client, indexName, productSettings(), properties)
+}
+
+// CreateAlertQueueIndex creates the queue of product changes waiting to be
+// matched against saved searches
+func CreateAlertQueueIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"id":         map[string]interface{}{"type": "keyword"},
+		"product_id": map[string]interface{}{"type": "keyword"},
+		"before":     map[string]interface{}{"type": "object", "enabled": false},
+		"after":      map[string]interface{}{"type": "object", "enabled": false},
+		"queued_at":  map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateWebhookIndex creates the index of registered webhooks
+func CreateWebhookIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"id":          map[string]interface{}{"type": "keyword"},
+		"url":         map[string]interface{}{"type": "keyword"},
+		"event_types": map[string]interface{}{"type": "keyword"},
+		"secret":      map[string]interface{}{"type": "keyword", "index": false},
+		"created_at":  map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateWebhookDeliveryIndex creates the webhook delivery queue, one document
+// per event and webhook
+func CreateWebhookDeliveryIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"id":              map[string]interface{}{"type": "keyword"},
+		"webhook_id":      map[string]interface{}{"type": "keyword"},
+		"event_type":      map[string]interface{}{"type": "keyword"},
+		"event":           map[string]interface{}{"type": "object", "enabled": false},
+		"status":          map[string]interface{}{"type": "keyword"},
+		"attempts":        map[string]interface{}{"type": "integer"},
+		"next_attempt_at": map[string]interface{}{"type": "date"},
+		"last_error":      map[string]interface{}{"type": "text"},
+		"history":         map[string]interface{}{"type": "object", "enabled": false},
+		"created_at":      map[string]interface{}{"type": "date"},
+		"updated_at":      map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateAuditIndex creates the product history index, one document per version
+func CreateAuditIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"product_id":    map[string]interface{}{"type": "keyword"},
+		"version":       map[string]interface{}{"type": "integer"},
+		"action":        map[string]interface{}{"type": "keyword"},
+		"reverted_from": map[string]interface{}{"type": "integer"},
+		"actor":         map[string]interface{}{"type": "keyword"},
+		"changes":       map[string]interface{}{"type": "object", "enabled": false},
+		"snapshot":      map[string]interface{}{"type": "object", "enabled": false},
+		"timestamp":     map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreatePromotionIndex creates the index of time-boxed promotions
+func CreatePromotionIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"id":          map[string]interface{}{"type": "keyword"},
+		"name":        map[string]interface{}{"type": "keyword"},
+		"sale_price":  map[string]interface{}{"type": "float"},
+		"currency":    map[string]interface{}{"type": "keyword"},
+		"percent_off": map[string]interface{}{"type": "float"},
+		"starts_at":   map[string]interface{}{"type": "date"},
+		"ends_at":     map[string]interface{}{"type": "date"},
+		"product_ids": map[string]interface{}{"type": "keyword"},
+		"categories":  map[string]interface{}{"type": "keyword"},
+		"created_at":  map[string]interface{}{"type": "date"},
+		"updated_at":  map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateCurrencyIndex creates the exchange rates table, one document per currency
+func CreateCurrencyIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"code":       map[string]interface{}{"type": "keyword"},
+		"rate":       map[string]interface{}{"type": "double"},
+		"decimals":   map[string]interface{}{"type": "integer"},
+		"updated_at": map[string]interface{}{"type": "date"},
+	})
+}
+
+// CreateCategoryIndex creates the category taxonomy, one document per category
+func CreateCategoryIndex(client *elasticsearch.Client, indexName string) error {
+	return createIndexIfMissing(client, indexName, map[string]interface{}{
+		"id":         map[string]interface{}{"type": "keyword"},
+		"name":       map[string]interface{}{"type": "keyword"},
+		"parent_id":  map[string]interface{}{"type": "keyword"},
+		"created_at": map[string]interface{}{"type": "date"},
+		"updated_at": map[string]interface{}{"type": "date"},
+	})
+}
+
+// createIndexIfMissing creates an index with the given field mappings. When the
+// index exists, fields added since it was created are mapped instead.
+func createIndexIfMissing(client *elasticsearch.Client, indexName string, properties map[string]interface{}) error {
+	return createIndexWithSettings(client, indexName, nil, properties)
+}
+
+// createIndexWithSettings creates an index with analysis settings, or adds
+// the field mappings to it when it already exists
+func createIndexWithSettings(client *elasticsearch.Client, indexName string, settings, properties map[string]interface{}) error {
+	exists, err := client.Indices.Exists([]string{indexName})
+	if err != nil {
+		return fmt.Errorf("error checking index existence: %w", err)
+	}
+	defer exists.Body.Close()
+
+	if exists.StatusCode == 200 {
+		log.Printf("Index '%s' already exists\n", indexName)
+		return putMapping(client, indexName, properties)
+	}
+
+	mapping := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": properties,
+		},
+	}
+	if settings != nil {
+		mapping["settings"] = settings
+	}
+
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("error marshaling mapping: %w", err)
+	}
+
+	res, err := client.Indices.Create(
+		indexName,
+		client.Indices.Create.WithBody(bytes.NewReader(mappingJSON)),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating index: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error: %s", res.String())
+	}
+
+	log.Printf("Index '%s' created successfully\n", indexName)
+	return nil
+}
+
+// putMapping adds field mappings to an existing index; existing fields are unchanged
+func putMapping(client *elasticsearch.Client, indexName string, properties map[string]interface{}) error {
+	mappingJSON, err := json.Marshal(map[string]interface{}{
+		"properties": properties,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling mapping: %w", err)
+	}
+
+	res, err := client.Indices.PutMapping(
+		[]string{indexName},
+		bytes.NewReader(mappingJSON),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating index mapping: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("error: %s", res.String())
+	}
+
+	return nil
+}
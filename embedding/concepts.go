@@ -0,0 +1,60 @@
+package embedding
+
+import (
+	"sort"
+	"strings"
+)
+
+// concepts is a small bundled lexicon mapping product concepts to words that
+// express them, so queries describing a need match products by what they are
+var concepts = map[string][]string{
+	"keyboard":   {"keyboard", "keyboards", "type", "typing", "typist", "keys", "keycap", "mechanical", "quiet", "silent", "write", "writing"},
+	"mouse":      {"mouse", "mice", "click", "clicking", "pointer", "cursor", "scroll", "trackball"},
+	"audio":      {"audio", "sound", "listen", "listening", "music", "hear", "hearing", "headphones", "headphone", "earbuds", "speaker", "speakers", "podcast", "noise"},
+	"headphones": {"headphones", "headphone", "headset", "earbuds", "earphones", "ears", "listen", "private"},
+	"speaker":    {"speaker", "speakers", "loud", "party", "bass", "soundbar"},
+	"microphone": {"microphone", "mic", "record", "recording", "voice", "podcast", "stream", "streaming", "sing", "vocals"},
+	"display":    {"monitor", "display", "screen", "screens", "watch", "view", "viewing", "resolution", "hdr"},
+	"computer":   {"laptop", "notebook", "computer", "pc", "desktop", "work", "code", "coding", "programming", "developer"},
+	"mobile":     {"phone", "smartphone", "mobile", "call", "calls", "text", "texting", "tablet", "pocket"},
+	"camera":     {"camera", "photo", "photos", "photography", "picture", "pictures", "video", "film", "shoot", "lens"},
+	"network":    {"router", "wifi", "internet", "network", "connection", "signal", "mesh", "modem"},
+	"carry":      {"backpack", "bag", "carry", "travel", "commute", "portable", "lightweight", "compact"},
+	"furniture":  {"chair", "desk", "sit", "sitting", "seat", "ergonomic", "posture", "standing", "table", "office"},
+	"wearable":   {"smartwatch", "watch", "wrist", "fitness", "steps", "heart", "wearable", "tracker", "running"},
+	"gaming":     {"gaming", "gamer", "game", "games", "play", "playing", "esports", "fps", "rgb"},
+	"wireless":   {"wireless", "bluetooth", "cordless", "cable", "untethered"},
+	"quality":    {"premium", "pro", "high", "end", "professional", "advanced", "ultra", "flagship"},
+	"budget":     {"budget", "cheap", "affordable", "inexpensive", "value", "basic", "entry"},
+}
+
+// wordConcepts is the inverted concepts lexicon: word -> concepts
+var wordConcepts = func() map[string][]string {
+	index := make(map[string][]string)
+	for concept, words := range concepts {
+		for _, word := range words {
+			index[word] = append(index[word], concept)
+		}
+	}
+	// map iteration order is random; keep vectors bit-for-bit deterministic
+	for _, found := range index {
+		sort.Strings(found)
+	}
+	return index
+}()
+
+// conceptsFor returns the concepts a word belongs to, trying a few common
+// suffixes so inflected forms ("quietly", "typed") are recognized
+func conceptsFor(word string) []string {
+	if found, ok := wordConcepts[word]; ok {
+		return found
+	}
+	for _, suffix := range []string{"ly", "ed", "ing", "es", "s"} {
+		if stem := strings.TrimSuffix(word, suffix); stem != word && len(stem) > 2 {
+			if found, ok := wordConcepts[stem]; ok {
+				return found
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+// Package embedding turns product and query text into dense vectors for
+// semantic (kNN) search.
+package embedding
+
+// Embedder computes a fixed-size vector for a piece of text
+type Embedder interface {
+	// Embed returns the vector for text; vectors are L2-normalized so cosine
+	// similarity can be used
+	Embed(text string) ([]float32, error)
+
+	// Dimensions returns the length of the vectors produced by Embed
+	Dimensions() int
+}
@@ -0,0 +1,95 @@
+package embedding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// HashingEmbedder is a deterministic, offline embedder. Words, character
+// trigrams and the concepts they belong to (from a small bundled lexicon) are
+// hashed into signed buckets, so texts that share words, spellings or intent
+// ("type quietly" and "keyboard") end up close to each other.
+type HashingEmbedder struct {
+	dims int
+}
+
+// Feature weights: concepts carry intent across different wordings, words carry
+// exact meaning and trigrams add robustness to typos and inflections
+const (
+	conceptWeight = 2.0
+	wordWeight    = 1.0
+	trigramWeight = 0.3
+)
+
+// NewHashingEmbedder creates a hashing embedder producing vectors of dims
+// dimensions, which must be positive
+func NewHashingEmbedder(dims int) (*HashingEmbedder, error) {
+	if dims <= 0 {
+		return nil, fmt.Errorf("embedding dimensions must be positive, got %d", dims)
+	}
+	return &HashingEmbedder{dims: dims}, nil
+}
+
+// Dimensions returns the vector size
+func (e *HashingEmbedder) Dimensions() int {
+	return e.dims
+}
+
+// Embed returns the normalized hashed feature vector of text
+func (e *HashingEmbedder) Embed(text string) ([]float32, error) {
+	vector := make([]float64, e.dims)
+
+	for _, word := range tokenize(text) {
+		e.add(vector, "w:"+word, wordWeight)
+
+		padded := "^" + word + "$"
+		runes := []rune(padded)
+		for i := 0; i+3 <= len(runes); i++ {
+			e.add(vector, "t:"+string(runes[i:i+3]), trigramWeight)
+		}
+
+		for _, concept := range conceptsFor(word) {
+			e.add(vector, "c:"+concept, conceptWeight)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	result := make([]float32, e.dims)
+	if norm == 0 {
+		// cosine similarity is undefined for zero vectors
+		result[0] = 1
+		return result, nil
+	}
+	for i, v := range vector {
+		result[i] = float32(v / norm)
+	}
+	return result, nil
+}
+
+// add hashes a feature into a bucket with a hash-derived sign
+func (e *HashingEmbedder) add(vector []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	index := int(sum % uint64(e.dims))
+	if (sum>>63)&1 == 1 {
+		weight = -weight
+	}
+	vector[index] += weight
+}
+
+// tokenize lowercases text and splits it into letter/digit words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
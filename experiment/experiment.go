@@ -0,0 +1,182 @@
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+)
+
+// Variant is one arm of an experiment
+type Variant struct {
+	Name    string          `json:"name"`
+	Weight  float64         `json:"weight"`            // share of the experiment's traffic, relative to the other variants
+	Ranking json.RawMessage `json:"ranking,omitempty"` // overrides of the default ranking profile; empty for a control
+
+	profile models.RankingProfile
+}
+
+// Experiment compares ranking profiles on a slice of the traffic
+type Experiment struct {
+	Name     string    `json:"name"`
+	Traffic  float64   `json:"traffic"` // fraction of shoppers enrolled (0-1)
+	Variants []Variant `json:"variants"`
+}
+
+// Manager buckets shoppers into experiments. Each shopper is enrolled in at
+// most one experiment, so the ranking profile of a search is never ambiguous.
+type Manager struct {
+	experiments []Experiment
+}
+
+// Load reads experiment definitions from a JSON file of the form
+// {"experiments": [...]}. An empty path yields a manager without experiments.
+func Load(path string, defaults models.RankingProfile) (*Manager, error) {
+	if path == "" {
+		return &Manager{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading experiments: %w", err)
+	}
+
+	var file struct {
+		Experiments []Experiment `json:"experiments"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding experiments: %w", err)
+	}
+
+	return New(file.Experiments, defaults)
+}
+
+// New validates experiments and resolves the ranking profile of every variant
+// by applying its overrides on top of the defaults
+func New(experiments []Experiment, defaults models.RankingProfile) (*Manager, error) {
+	names := make(map[string]bool, len(experiments))
+	totalTraffic := 0.0
+
+	for i := range experiments {
+		exp := &experiments[i]
+		if exp.Name == "" {
+			return nil, fmt.Errorf("experiment %d has no name", i+1)
+		}
+		if names[exp.Name] {
+			return nil, fmt.Errorf("duplicate experiment %q", exp.Name)
+		}
+		names[exp.Name] = true
+
+		if exp.Traffic <= 0 || exp.Traffic > 1 {
+			return nil, fmt.Errorf("experiment %q: traffic must be between 0 and 1", exp.Name)
+		}
+		totalTraffic += exp.Traffic
+
+		if len(exp.Variants) < 2 {
+			return nil, fmt.Errorf("experiment %q needs at least two variants", exp.Name)
+		}
+		variantNames := make(map[string]bool, len(exp.Variants))
+		for j := range exp.Variants {
+			variant := &exp.Variants[j]
+			if variant.Name == "" || variantNames[variant.Name] {
+				return nil, fmt.Errorf("experiment %q: variant names must be unique and non-empty", exp.Name)
+			}
+			variantNames[variant.Name] = true
+
+			if variant.Weight <= 0 {
+				return nil, fmt.Errorf("experiment %q: variant %q needs a positive weight", exp.Name, variant.Name)
+			}
+
+			variant.profile = defaults
+			if len(variant.Ranking) > 0 {
+				if err := json.Unmarshal(variant.Ranking, &variant.profile); err != nil {
+					return nil, fmt.Errorf("experiment %q: variant %q: invalid ranking: %w", exp.Name, variant.Name, err)
+				}
+			}
+			if err := repository.ValidateRankingProfile(variant.profile); err != nil {
+				return nil, fmt.Errorf("experiment %q: variant %q: %w", exp.Name, variant.Name, err)
+			}
+		}
+	}
+
+	if totalTraffic > 1 {
+		return nil, fmt.Errorf("experiments enroll %.0f%% of traffic, at most 100%% allowed", totalTraffic*100)
+	}
+
+	return &Manager{experiments: experiments}, nil
+}
+
+// Experiments returns the configured experiments
+func (m *Manager) Experiments() []Experiment {
+	return m.experiments
+}
+
+// Get returns an experiment by name
+func (m *Manager) Get(name string) (Experiment, bool) {
+	for _, exp := range m.experiments {
+		if exp.Name == name {
+			return exp, true
+		}
+	}
+	return Experiment{}, false
+}
+
+// Assign buckets a shopper by a hash of their ID. The shopper's position in
+// [0, 1) selects the experiment, whose traffic slices are laid out in order;
+// a second hash salted with the experiment name selects the variant. Returns
+// nil when the shopper ID is empty or falls outside every experiment.
+func (m *Manager) Assign(shopperID string) (*models.ExperimentAssignment, *models.RankingProfile) {
+	if shopperID == "" {
+		return nil, nil
+	}
+
+	position := bucket(shopperID)
+	start := 0.0
+	for _, exp := range m.experiments {
+		if position < start || position >= start+exp.Traffic {
+			start += exp.Traffic
+			continue
+		}
+
+		variant := exp.pick(bucket(exp.Name + ":" + shopperID))
+		profile := variant.profile
+		return &models.ExperimentAssignment{Experiment: exp.Name, Variant: variant.Name}, &profile
+	}
+	return nil, nil
+}
+
+// pick selects the variant at position in [0, 1) of the weighted variants
+func (e Experiment) pick(position float64) Variant {
+	total := 0.0
+	for _, variant := range e.Variants {
+		total += variant.Weight
+	}
+
+	cumulative := 0.0
+	for _, variant := range e.Variants {
+		cumulative += variant.Weight / total
+		if position < cumulative {
+			return variant
+		}
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// ShopperID identifies a shopper for bucketing: the user ID when signed in,
+// otherwise the session ID
+func ShopperID(userID, sessionID string) string {
+	if userID != "" {
+		return userID
+	}
+	return sessionID
+}
+
+// bucket hashes a key to a uniformly distributed position in [0, 1)
+func bucket(key string) float64 {
+	sum := sha256.Sum256([]byte(key))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / float64(1<<53)
+}
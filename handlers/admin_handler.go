@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/aditya/elasticsearch-products-api/shadow"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultExportPeriod is how far back a feature export reaches by default
+	defaultExportPeriod = 7 * 24 * time.Hour
+
+	// defaultAnalyticsPeriod is how far back search analytics reach by default
+	defaultAnalyticsPeriod = 7 * 24 * time.Hour
+
+	// defaultMinSearches is the fewest searches for a query's CTR to be reported
+	defaultMinSearches = 20
+)
+
+type AdminHandler struct {
+	shadow      *shadow.Evaluator
+	featureLog  *repository.FeatureLogRepository
+	searchLog   *repository.SearchLogRepository
+	suggestions *repository.SuggestionRepository
+}
+
+func NewAdminHandler(shadowEvaluator *shadow.Evaluator, featureLog *repository.FeatureLogRepository, searchLog *repository.SearchLogRepository, suggestions *repository.SuggestionRepository) *AdminHandler {
+	return &AdminHandler{shadow: shadowEvaluator, featureLog: featureLog, searchLog: searchLog, suggestions: suggestions}
+}
+
+// GetShadowSummary reports how the shadow candidate ranking differs from production
+func (h *AdminHandler) GetShadowSummary(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"shadow": h.shadow.Summary()})
+}
+
+// ExportFeatures exports logged learning-to-rank features joined with their
+// outcome labels, as SVMrank (default) or CSV
+func (h *AdminHandler) ExportFeatures(c *gin.Context) {
+	format := c.DefaultQuery("format", "svmrank")
+	if format != "svmrank" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be svmrank or csv"})
+		return
+	}
+
+	since, until, err := timeRangeQuery(c, defaultExportPeriod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := 0
+	if l, ok := c.GetQuery("limit"); ok {
+		if _, err := fmt.Sscanf(l, "%d", &limit); err != nil || limit < 1 {
+			limit = 0
+		}
+	}
+
+	rows, err := h.featureLog.Export(c.Request.Context(), since, until, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", "attachment; filename=ltr_features.csv")
+		writeFeaturesCSV(c.Writer, rows)
+		return
+	}
+
+	c.Header("Content-Type", "text/plain")
+	c.Header("Content-Disposition", "attachment; filename=ltr_features.txt")
+	writeFeaturesSVMRank(c.Writer, rows)
+}
+
+// writeFeaturesSVMRank writes one line per row:
+// <label> qid:<n> 1:<bm25> 2:<position> ... # <search_id> <product_id>
+// where features are numbered in repository.LTRFeatures order
+func writeFeaturesSVMRank(w io.Writer, rows []models.FeatureRow) {
+	fmt.Fprint(w, "# features:")
+	for i, name := range repository.LTRFeatures {
+		fmt.Fprintf(w, " %d=%s", i+1, name)
+	}
+	fmt.Fprintln(w)
+
+	qids := make(map[string]int)
+	for _, row := range rows {
+		qid, ok := qids[row.SearchID]
+		if !ok {
+			qid = len(qids) + 1
+			qids[row.SearchID] = qid
+		}
+
+		fmt.Fprintf(w, "%d qid:%d", row.Label, qid)
+		for i, name := range repository.LTRFeatures {
+			fmt.Fprintf(w, " %d:%s", i+1, strconv.FormatFloat(featureValue(row, name), 'g', -1, 64))
+		}
+		fmt.Fprintf(w, " # %s %s\n", row.SearchID, row.ProductID)
+	}
+}
+
+// writeFeaturesCSV writes a header row and one row per product with its label
+func writeFeaturesCSV(w io.Writer, rows []models.FeatureRow) {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	header := []string{"search_id", "query", "product_id", "label"}
+	header = append(header, repository.LTRFeatures...)
+	writer.Write(header)
+
+	for _, row := range rows {
+		record := []string{row.SearchID, row.Query, row.ProductID, strconv.Itoa(row.Label)}
+		for _, name := range repository.LTRFeatures {
+			record = append(record, strconv.FormatFloat(featureValue(row, name), 'g', -1, 64))
+		}
+		writer.Write(record)
+	}
+}
+
+// featureValue returns a logged feature; factors that were not applied are 1 (no effect)
+func featureValue(row models.FeatureRow, name string) float64 {
+	if value, ok := row.Features[name]; ok {
+		return value
+	}
+	return 1
+}
+
+// timeRangeQuery reads the since and until query parameters as RFC 3339
+// times; by default the range ends now and spans period
+func timeRangeQuery(c *gin.Context, period time.Duration) (time.Time, time.Time, error) {
+	until := time.Now()
+	since := until.Add(-period)
+	for param, target := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value, ok := c.GetQuery(param); ok {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return since, until, fmt.Errorf("%s must be an RFC 3339 time", param)
+			}
+			*target = parsed
+		}
+	}
+	if !since.Before(until) {
+		return since, until, fmt.Errorf("since must be before until")
+	}
+	return since, until, nil
+}
+
+// analyticsQuery reads the time range and result size of an analytics report
+func analyticsQuery(c *gin.Context) (time.Time, time.Time, int, error) {
+	since, until, err := timeRangeQuery(c, defaultAnalyticsPeriod)
+	if err != nil {
+		return since, until, 0, err
+	}
+
+	size := 20
+	if s, ok := c.GetQuery("size"); ok {
+		if _, err := fmt.Sscanf(s, "%d", &size); err != nil || size < 1 || size > 100 {
+			return since, until, 0, fmt.Errorf("size must be between 1 and 100")
+		}
+	}
+	return since, until, size, nil
+}
+
+// GetTopQueries lists the most frequent search queries
+func (h *AdminHandler) GetTopQueries(c *gin.Context) {
+	since, until, size, err := analyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queries, err := h.searchLog.TopQueries(c.Request.Context(), since, until, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queries": queries, "since": since, "until": until})
+}
+
+// GetZeroResultQueries lists the queries that most often matched nothing
+func (h *AdminHandler) GetZeroResultQueries(c *gin.Context) {
+	since, until, size, err := analyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queries, err := h.searchLog.ZeroResultQueries(c.Request.Context(), since, until, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queries": queries, "since": since, "until": until})
+}
+
+// GetLowCTRQueries lists frequent queries whose results are rarely clicked
+func (h *AdminHandler) GetLowCTRQueries(c *gin.Context) {
+	since, until, size, err := analyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	minSearches := defaultMinSearches
+	if m, ok := c.GetQuery("min_searches"); ok {
+		if _, err := fmt.Sscanf(m, "%d", &minSearches); err != nil || minSearches < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_searches must be a positive integer"})
+			return
+		}
+	}
+
+	queries, err := h.searchLog.LowCTRQueries(c.Request.Context(), since, until, minSearches, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queries": queries, "since": since, "until": until})
+}
+
+// GetFilterUsage reports the share of searches using each filter
+func (h *AdminHandler) GetFilterUsage(c *gin.Context) {
+	since, until, err := timeRangeQuery(c, defaultAnalyticsPeriod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	usage, total, err := h.searchLog.FilterUsage(c.Request.Context(), since, until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"filters": usage, "total": total, "since": since, "until": until})
+}
+
+// RefreshSuggestions mines query suggestions from the search log now,
+// without waiting for the next scheduled refresh
+func (h *AdminHandler) RefreshSuggestions(c *gin.Context) {
+	count, err := h.suggestions.Refresh(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Query suggestions refreshed", "suggestions": count})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/querylang"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type AlertHandler struct {
+	repo *repository.AlertRepository
+}
+
+func NewAlertHandler(repo *repository.AlertRepository) *AlertHandler {
+	return &AlertHandler{repo: repo}
+}
+
+// CreateAlert saves a search to be alerted about matching new or restocked products
+func (h *AlertHandler) CreateAlert(c *gin.Context) {
+	var alert models.SavedSearch
+	if err := c.ShouldBindJSON(&alert); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.Create(c.Request.Context(), &alert); err != nil {
+		var parseErr *querylang.ParseError
+		if errors.As(err, &parseErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error(), "position": parseErr.Pos})
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidAlert) || errors.Is(err, repository.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Alert created successfully",
+		"alert":   alert,
+	})
+}
+
+// ListAlerts lists the saved searches of a user
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	alerts, err := h.repo.ListByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"total":  len(alerts),
+	})
+}
+
+// DeleteAlert deletes a saved search by ID
+func (h *AlertHandler) DeleteAlert(c *gin.Context) {
+	if err := h.repo.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, repository.ErrAlertNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert deleted successfully"})
+}
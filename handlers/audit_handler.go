@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// ActorHeader names who makes a product change, recorded in its history
+const ActorHeader = "X-Actor"
+
+type AuditHandler struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditHandler(repo *repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{repo: repo}
+}
+
+// actorContext is the request context carrying the actor of product changes
+func actorContext(c *gin.Context) context.Context {
+	return repository.WithActor(c.Request.Context(), c.GetHeader(ActorHeader))
+}
+
+// GetHistory lists the versions of a product, newest first
+func (h *AuditHandler) GetHistory(c *gin.Context) {
+	size := 50
+	if s, ok := c.GetQuery("size"); ok {
+		if _, err := fmt.Sscanf(s, "%d", &size); err != nil || size < 1 || size > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between 1 and 500"})
+			return
+		}
+	}
+
+	history, err := h.repo.History(c.Request.Context(), c.Param("id"), size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(history) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no history for product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": c.Param("id"),
+		"history":    history,
+		"total":      len(history),
+	})
+}
+
+// RevertProduct restores a product to one of its versions
+func (h *AuditHandler) RevertProduct(c *gin.Context) {
+	var version int
+	if _, err := fmt.Sscanf(c.Query("version"), "%d", &version); err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive number"})
+		return
+	}
+
+	product, err := h.repo.Revert(actorContext(c), c.Param("id"), version)
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidLifecycle) || errors.Is(err, repository.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Product reverted to version %d", version),
+		"product": product,
+	})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryHandler struct {
+	categories *repository.CategoryRepository
+	products   *repository.ProductRepository
+}
+
+func NewCategoryHandler(categories *repository.CategoryRepository, products *repository.ProductRepository) *CategoryHandler {
+	return &CategoryHandler{categories: categories, products: products}
+}
+
+// ListCategories returns the category tree
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	taxonomy, err := h.categories.Taxonomy(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"categories": taxonomy.Tree(""),
+		"total":      len(taxonomy),
+	})
+}
+
+// GetCategory retrieves a category with its breadcrumbs and subcategories
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	taxonomy, err := h.categories.Taxonomy(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	category, ok := taxonomy[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": repository.ErrCategoryNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"category":    models.CategoryNode{Category: category, Children: taxonomy.Tree(id)},
+		"path":        taxonomy.Path(id),
+		"breadcrumbs": taxonomy.Breadcrumbs(id),
+	})
+}
+
+// CreateCategory adds a category, then indexes the path of any products
+// already in it
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.categories.Create(c.Request.Context(), &category); err != nil {
+		categoryError(c, err)
+		return
+	}
+
+	repathed, err := h.products.RepathCategories(c.Request.Context(), []string{category.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "category saved but products were not updated: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Category created successfully",
+		"category": category,
+		"repathed": repathed,
+	})
+}
+
+// UpdateCategory renames or moves a category. Moving it updates the path of
+// the products in it and in its subcategories.
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.categories.Update(c.Request.Context(), c.Param("id"), &category); err != nil {
+		categoryError(c, err)
+		return
+	}
+
+	taxonomy, err := h.categories.Taxonomy(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "category saved but products were not updated: " + err.Error()})
+		return
+	}
+	repathed, err := h.products.RepathCategories(c.Request.Context(), taxonomy.Subtree(category.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "category saved but products were not updated: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Category updated successfully",
+		"category": category,
+		"repathed": repathed,
+	})
+}
+
+// DeleteCategory removes a category without subcategories. Its products keep
+// their category as a top-level path.
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.categories.Delete(c.Request.Context(), id); err != nil {
+		categoryError(c, err)
+		return
+	}
+
+	repathed, err := h.products.RepathCategories(c.Request.Context(), []string{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "category deleted but products were not updated: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Category deleted successfully",
+		"repathed": repathed,
+	})
+}
+
+// categoryError responds with the status matching a category repository error
+func categoryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrCategoryExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrInvalidCategory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
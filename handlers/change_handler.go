@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/changefeed"
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+type ChangeHandler struct {
+	feed      *changefeed.Feed
+	heartbeat time.Duration
+}
+
+func NewChangeHandler(feed *changefeed.Feed, heartbeat time.Duration) (*ChangeHandler, error) {
+	if heartbeat <= 0 {
+		return nil, fmt.Errorf("heartbeat interval must be positive, got %s", heartbeat)
+	}
+	return &ChangeHandler{feed: feed, heartbeat: heartbeat}, nil
+}
+
+// StreamChanges streams catalog changes as server-sent events, optionally of
+// one category. A reconnecting client sends Last-Event-ID (or last_event_id)
+// to receive the changes it missed; when they are no longer buffered, or the
+// ID is from before a restart, a "reset" event tells it to reload instead.
+func (h *ChangeHandler) StreamChanges(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	missed, sub, ok := h.feed.Subscribe(c.Query("category"), lastEventID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !ok {
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"message": "missed changes are no longer available, reload the catalog"}})
+	}
+	for _, change := range missed {
+		renderChange(c, change)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case change, open := <-sub.C:
+			if !open {
+				// Dropped for falling behind; the client resumes from its last ID
+				return false
+			}
+			renderChange(c, change)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// renderChange writes a change as an event named after its type
+func renderChange(c *gin.Context, change models.ProductChange) {
+	c.Render(-1, sse.Event{
+		Id:    change.ID,
+		Event: change.Type,
+		Data:  change,
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyHandler struct {
+	currencies *repository.CurrencyRepository
+	products   *repository.ProductRepository
+}
+
+func NewCurrencyHandler(currencies *repository.CurrencyRepository, products *repository.ProductRepository) *CurrencyHandler {
+	return &CurrencyHandler{currencies: currencies, products: products}
+}
+
+// rateRequest is the body of a rate update
+type rateRequest struct {
+	Rate     float64 `json:"rate" binding:"required,gt=0"`             // units of the currency per unit of the base currency
+	Decimals *int    `json:"decimals" binding:"omitempty,gte=0,lte=4"` // defaults to the usual minor unit of the currency
+}
+
+// ListCurrencies lists the exchange rates table
+func (h *CurrencyHandler) ListCurrencies(c *gin.Context) {
+	rates, err := h.currencies.Rates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	currencies, err := h.currencies.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base":       rates.Base,
+		"currencies": currencies,
+	})
+}
+
+// SetRate adds or updates the rate of a currency, then recomputes the base
+// currency price of the products priced in it
+func (h *CurrencyHandler) SetRate(c *gin.Context) {
+	var req rateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := strings.ToUpper(c.Param("code"))
+	currency := models.Currency{
+		Code:     code,
+		Rate:     req.Rate,
+		Decimals: models.DefaultDecimals(code),
+	}
+	if req.Decimals != nil {
+		currency.Decimals = *req.Decimals
+	}
+
+	if err := h.currencies.SetRate(c.Request.Context(), &currency); err != nil {
+		if errors.Is(err, repository.ErrInvalidCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	repriced, err := h.products.RepriceCurrency(c.Request.Context(), currency.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "rate saved but products were not repriced: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Rate updated successfully",
+		"currency": currency,
+		"repriced": repriced,
+	})
+}
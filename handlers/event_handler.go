@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/experiment"
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type EventHandler struct {
+	repo        *repository.EventRepository
+	experiments *experiment.Manager
+}
+
+func NewEventHandler(repo *repository.EventRepository, experiments *experiment.Manager) *EventHandler {
+	return &EventHandler{repo: repo, experiments: experiments}
+}
+
+// RecordEvent records a shopper event such as a purchase
+func (h *EventHandler) RecordEvent(c *gin.Context) {
+	var event models.Event
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Tag the event with the shopper's experiment variant for reporting
+	event.Experiment, event.Variant = "", ""
+	if assignment, _ := h.experiments.Assign(experiment.ShopperID(event.UserID, event.SessionID)); assignment != nil {
+		event.Experiment = assignment.Experiment
+		event.Variant = assignment.Variant
+	}
+
+	if err := h.repo.Record(c.Request.Context(), &event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Event recorded successfully",
+		"event":   event,
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/experiment"
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type ExperimentHandler struct {
+	experiments *experiment.Manager
+	events      *repository.EventRepository
+}
+
+func NewExperimentHandler(experiments *experiment.Manager, events *repository.EventRepository) *ExperimentHandler {
+	return &ExperimentHandler{experiments: experiments, events: events}
+}
+
+// ListExperiments lists the configured experiments and their variants
+func (h *ExperimentHandler) ListExperiments(c *gin.Context) {
+	experiments := h.experiments.Experiments()
+	c.JSON(http.StatusOK, gin.H{
+		"experiments": experiments,
+		"total":       len(experiments),
+	})
+}
+
+// GetReport compares CTR and conversion across the variants of an experiment
+func (h *ExperimentHandler) GetReport(c *gin.Context) {
+	name := c.Param("name")
+
+	exp, ok := h.experiments.Get(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "experiment not found"})
+		return
+	}
+
+	stats, err := h.events.VariantStats(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Report every configured variant, in order, even before it has events
+	report := models.ExperimentReport{Experiment: name}
+	for _, variant := range exp.Variants {
+		variantReport, ok := stats[variant.Name]
+		if !ok {
+			variantReport = models.VariantReport{Variant: variant.Name}
+		}
+		report.Variants = append(report.Variants, variantReport)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
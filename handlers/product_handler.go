@@ -1,20 +1,40 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/aditya/elasticsearch-products-api/experiment"
 	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/querylang"
 	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/aditya/elasticsearch-products-api/shadow"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type ProductHandler struct {
-	repo *repository.ProductRepository
+	repo          *repository.ProductRepository
+	events        *repository.EventRepository
+	searchLog     *repository.SearchLogRepository
+	experiments   *experiment.Manager
+	shadow        *shadow.Evaluator
+	fallbackSteps []string
 }
 
-func NewProductHandler(repo *repository.ProductRepository) *ProductHandler {
-	return &ProductHandler{repo: repo}
+func NewProductHandler(repo *repository.ProductRepository, events *repository.EventRepository, searchLog *repository.SearchLogRepository, experiments *experiment.Manager, shadowEvaluator *shadow.Evaluator, fallbackSteps []string) *ProductHandler {
+	return &ProductHandler{
+		repo:          repo,
+		events:        events,
+		searchLog:     searchLog,
+		experiments:   experiments,
+		shadow:        shadowEvaluator,
+		fallbackSteps: fallbackSteps,
+	}
 }
 
 // CreateProduct creates a new product
@@ -25,7 +45,11 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.Create(c.Request.Context(), &product); err != nil {
+	if err := h.repo.Create(actorContext(c), &product); err != nil {
+		if errors.Is(err, repository.ErrInvalidLifecycle) || errors.Is(err, repository.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -36,17 +60,45 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	})
 }
 
-// GetProduct retrieves a product by ID
+// GetProduct retrieves a product shoppers can see by ID
 func (h *ProductHandler) GetProduct(c *gin.Context) {
-	id := c.Param("id")
+	h.getProduct(c, h.repo.GetLive)
+}
 
-	product, err := h.repo.GetByID(c.Request.Context(), id)
+// PreviewProduct retrieves a product in any lifecycle status by ID, so
+// drafts can be previewed
+func (h *ProductHandler) PreviewProduct(c *gin.Context) {
+	h.getProduct(c, h.repo.GetByID)
+}
+
+// getProduct responds with the product a getter finds, priced like search results
+func (h *ProductHandler) getProduct(c *gin.Context, get func(ctx context.Context, id string) (*models.Product, error)) {
+	product, err := get(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if errors.Is(err, repository.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"product": product})
+	// Show the sale price of an active promotion next to the list price, and
+	// both in the requested currency
+	priced := []models.Product{*product}
+	h.repo.ApplyPromotions(c.Request.Context(), priced)
+	if currency := c.Query("currency"); currency != "" {
+		if err := h.repo.ConvertPrices(c.Request.Context(), priced, currency); err != nil {
+			if errors.Is(err, repository.ErrUnknownCurrency) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"product": priced[0]})
 }
 
 // UpdateProduct updates an existing product
@@ -59,7 +111,11 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.Update(c.Request.Context(), id, &product); err != nil {
+	if err := h.repo.Update(actorContext(c), id, &product); err != nil {
+		if errors.Is(err, repository.ErrInvalidLifecycle) || errors.Is(err, repository.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -70,27 +126,61 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	})
 }
 
-// DeleteProduct deletes a product by ID
+// DeleteProduct moves a product to the trash, or deletes it permanently with hard=true
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.repo.Delete(c.Request.Context(), id); err != nil {
+	remove, message := h.repo.Delete, "Product moved to trash"
+	if c.Query("hard") == "true" {
+		remove, message = h.repo.Purge, "Product deleted permanently"
+	}
+
+	if err := remove(actorContext(c), id); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": message})
 }
 
-// SearchProducts searches for products
-func (h *ProductHandler) SearchProducts(c *gin.Context) {
-	var searchReq models.ProductSearchRequest
-	if err := c.ShouldBindQuery(&searchReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// RestoreProduct takes a product out of the trash
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	product, err := h.repo.Restore(actorContext(c), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrProductNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrProductNotTrashed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Product restored successfully",
+		"product": product,
+	})
+}
+
+// ListProducts lists the products in every lifecycle status, or one with
+// status=draft|published|archived, most recently updated first
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.StatusDraft, models.StatusPublished, models.StatusArchived:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be draft, published or archived"})
 		return
 	}
+	page, pageSize := pagination(c)
 
-	products, total, err := h.repo.Search(c.Request.Context(), &searchReq)
+	products, total, err := h.repo.ListByStatus(c.Request.Context(), status, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -99,28 +189,207 @@ func (h *ProductHandler) SearchProducts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"products": products,
 		"total":    total,
-		"page":     searchReq.Page,
-		"pageSize": searchReq.PageSize,
+		"page":     page,
+		"pageSize": pageSize,
 	})
 }
 
-// GetAllProducts retrieves all products with pagination
-func (h *ProductHandler) GetAllProducts(c *gin.Context) {
-	page := 1
-	pageSize := 10
+// ListTrash lists the products in the trash with pagination
+func (h *ProductHandler) ListTrash(c *gin.Context) {
+	page, pageSize := pagination(c)
 
-	if p, ok := c.GetQuery("page"); ok {
-		if _, err := fmt.Sscanf(p, "%d", &page); err != nil {
-			page = 1
+	products, total, err := h.repo.Trash(c.Request.Context(), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products": products,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// SearchProducts searches for products
+func (h *ProductHandler) SearchProducts(c *gin.Context) {
+	var searchReq models.ProductSearchRequest
+	if err := c.ShouldBindQuery(&searchReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Shoppers enrolled in an experiment are ranked with their variant's profile
+	assignment, profile := h.experiments.Assign(experiment.ShopperID(searchReq.UserID, searchReq.SessionID))
+	searchReq.Ranking = profile
+	receivedReq := searchReq
+
+	// The search ID lets later events reference this response
+	searchReq.SearchID = uuid.New().String()
+
+	start := time.Now()
+	result, err := h.repo.SearchWithFallback(c.Request.Context(), &searchReq, h.fallbackSteps)
+	latency := time.Since(start)
+	if err != nil {
+		var parseErr *querylang.ParseError
+		if errors.As(err, &parseErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error(), "position": parseErr.Pos})
+			return
 		}
+		if errors.Is(err, repository.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	if ps, ok := c.GetQuery("page_size"); ok {
-		if _, err := fmt.Sscanf(ps, "%d", &pageSize); err != nil {
-			pageSize = 10
+	response := gin.H{
+		"products":  result.Products,
+		"total":     result.Total,
+		"page":      searchReq.Page,
+		"pageSize":  searchReq.PageSize,
+		"search_id": searchReq.SearchID,
+	}
+	if result.Relaxation != nil {
+		response["relaxation"] = result.Relaxation
+	}
+	if result.Interpretation != nil {
+		response["interpretation"] = result.Interpretation
+	}
+	if result.ParsedQuery != "" {
+		response["parsed_query"] = result.ParsedQuery
+	}
+	if result.PriceFacets != nil {
+		response["price_facets"] = result.PriceFacets
+	}
+	if result.CategoryFacets != nil {
+		response["category_facets"] = result.CategoryFacets
+	}
+	if len(result.Breadcrumbs) > 0 {
+		response["breadcrumbs"] = result.Breadcrumbs
+	}
+	if assignment != nil {
+		response["experiment"] = assignment
+		h.recordSearch(c, &searchReq, assignment, result.Products)
+	} else {
+		// Shadow comparisons are against the default ranking only
+		h.shadow.Submit(receivedReq, result.Products)
+	}
+	h.searchLog.Log(newSearchLogEntry(&receivedReq, &searchReq, result, latency))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// newSearchLogEntry describes a served search for analytics. Filters are those
+// of the request as received, before any fallback step relaxed them.
+func newSearchLogEntry(receivedReq, searchReq *models.ProductSearchRequest, result *models.SearchResult, latency time.Duration) models.SearchLogEntry {
+	entry := models.SearchLogEntry{
+		SearchID:    searchReq.SearchID,
+		Query:       repository.NormalizeQuery(receivedReq.Query),
+		Filters:     searchFilters(receivedReq),
+		Category:    receivedReq.Category,
+		Total:       result.Total,
+		ZeroResults: result.Total == 0 || result.Relaxation != nil,
+		LatencyMs:   latency.Milliseconds(),
+		Page:        searchReq.Page,
+		UserID:      searchReq.UserID,
+		SessionID:   searchReq.SessionID,
+		Timestamp:   time.Now(),
+	}
+	if result.Relaxation != nil {
+		entry.Relaxation = result.Relaxation.Step
+	}
+	return entry
+}
+
+// searchFilters lists the filter and ranking options a search request uses
+func searchFilters(searchReq *models.ProductSearchRequest) []string {
+	var filters []string
+	if searchReq.Category != "" {
+		filters = append(filters, "category")
+	}
+	if searchReq.MinPrice > 0 || searchReq.MaxPrice > 0 {
+		filters = append(filters, "price")
+	}
+	if searchReq.Currency != "" {
+		filters = append(filters, "currency")
+	}
+	if searchReq.InStock {
+		filters = append(filters, "in_stock")
+	}
+	if searchReq.Sort == models.SortNewArrivals {
+		filters = append(filters, "new_arrivals")
+	}
+	if searchReq.Mode == models.SearchModeHybrid {
+		filters = append(filters, "hybrid")
+	}
+	if searchReq.Syntax == models.SyntaxAdvanced {
+		filters = append(filters, "advanced_syntax")
+	}
+	if searchReq.Diversify {
+		filters = append(filters, "diversify")
+	}
+	if searchReq.UserID != "" {
+		filters = append(filters, "personalized")
+	}
+	return filters
+}
+
+// recordSearch logs an experiment search as an event, the denominator of the
+// variant's CTR. Failures are logged and do not fail the search.
+func (h *ProductHandler) recordSearch(c *gin.Context, searchReq *models.ProductSearchRequest, assignment *models.ExperimentAssignment, products []models.Product) {
+	productIDs := make([]string, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+
+	event := &models.Event{
+		Type:       models.EventTypeSearch,
+		ProductIDs: productIDs,
+		UserID:     searchReq.UserID,
+		SessionID:  searchReq.SessionID,
+		SearchID:   searchReq.SearchID,
+		Experiment: assignment.Experiment,
+		Variant:    assignment.Variant,
+	}
+	if err := h.events.Record(c.Request.Context(), event); err != nil {
+		log.Printf("[EXPERIMENT] Failed to record search for %s/%s: %v", assignment.Experiment, assignment.Variant, err)
+	}
+}
+
+// GetSimilarProducts retrieves products similar to the given product
+func (h *ProductHandler) GetSimilarProducts(c *gin.Context) {
+	id := c.Param("id")
+
+	var similarReq models.SimilarProductsRequest
+	if err := c.ShouldBindQuery(&similarReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	products, err := h.repo.Similar(c.Request.Context(), id, &similarReq)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"products":   products,
+		"total":      len(products),
+	})
+}
+
+// GetAllProducts retrieves all products with pagination
+func (h *ProductHandler) GetAllProducts(c *gin.Context) {
+	page, pageSize := pagination(c)
+
 	products, total, err := h.repo.GetAll(c.Request.Context(), page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -134,3 +403,23 @@ func (h *ProductHandler) GetAllProducts(c *gin.Context) {
 		"pageSize": pageSize,
 	})
 }
+
+// pagination reads the page and page_size parameters, defaulting to the first page of 10
+func pagination(c *gin.Context) (page, pageSize int) {
+	page = 1
+	pageSize = 10
+
+	if p, ok := c.GetQuery("page"); ok {
+		if _, err := fmt.Sscanf(p, "%d", &page); err != nil || page < 1 {
+			page = 1
+		}
+	}
+
+	if ps, ok := c.GetQuery("page_size"); ok {
+		if _, err := fmt.Sscanf(ps, "%d", &pageSize); err != nil || pageSize < 1 {
+			pageSize = 10
+		}
+	}
+
+	return page, pageSize
+}
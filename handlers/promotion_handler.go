@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type PromotionHandler struct {
+	repo *repository.PromotionRepository
+}
+
+func NewPromotionHandler(repo *repository.PromotionRepository) *PromotionHandler {
+	return &PromotionHandler{repo: repo}
+}
+
+// CreatePromotion schedules a promotion
+func (h *PromotionHandler) CreatePromotion(c *gin.Context) {
+	var promotion models.Promotion
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.Create(c.Request.Context(), &promotion); err != nil {
+		promotionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Promotion created successfully",
+		"promotion": promotion,
+	})
+}
+
+// ListPromotions lists the promotions; active=true lists only those running now
+func (h *PromotionHandler) ListPromotions(c *gin.Context) {
+	promotions, err := h.repo.List(c.Request.Context(), c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"promotions": promotions,
+		"total":      len(promotions),
+	})
+}
+
+// GetPromotion retrieves a promotion by ID
+func (h *PromotionHandler) GetPromotion(c *gin.Context) {
+	promotion, err := h.repo.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		promotionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"promotion": promotion})
+}
+
+// UpdatePromotion replaces a promotion
+func (h *PromotionHandler) UpdatePromotion(c *gin.Context) {
+	var promotion models.Promotion
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.Update(c.Request.Context(), c.Param("id"), &promotion); err != nil {
+		promotionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Promotion updated successfully",
+		"promotion": promotion,
+	})
+}
+
+// DeletePromotion deletes a promotion by ID, ending it immediately
+func (h *PromotionHandler) DeletePromotion(c *gin.Context) {
+	if err := h.repo.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		promotionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted successfully"})
+}
+
+// promotionError responds with the status matching a promotion repository error
+func promotionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrPromotionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrInvalidPromotion), errors.Is(err, repository.ErrUnknownCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/config"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// coPurchaseCandidates is how many co-purchased products are considered before
+// filtering out-of-stock items and re-ranking
+const coPurchaseCandidates = 50
+
+// Bounds of the trending window: counters are hourly buckets, and older
+// counters are not considered
+const (
+	minTrendingWindow = time.Hour
+	maxTrendingWindow = 30 * 24 * time.Hour
+)
+
+type RecommendationHandler struct {
+	products      *repository.ProductRepository
+	cooccurrence  *repository.CoOccurrenceRepository
+	trending      *repository.TrendingRepository
+	defaultWindow time.Duration
+}
+
+func NewRecommendationHandler(products *repository.ProductRepository, cooccurrence *repository.CoOccurrenceRepository, trending *repository.TrendingRepository, defaultWindow time.Duration) *RecommendationHandler {
+	return &RecommendationHandler{
+		products:      products,
+		cooccurrence:  cooccurrence,
+		trending:      trending,
+		defaultWindow: defaultWindow,
+	}
+}
+
+// GetBoughtTogether retrieves products frequently bought together with a product
+func (h *RecommendationHandler) GetBoughtTogether(c *gin.Context) {
+	id := c.Param("id")
+	size := 10
+
+	if s, ok := c.GetQuery("size"); ok {
+		if _, err := fmt.Sscanf(s, "%d", &size); err != nil || size < 1 {
+			size = 10
+		}
+	}
+	if size > coPurchaseCandidates {
+		size = coPurchaseCandidates
+	}
+
+	if _, err := h.products.GetByID(c.Request.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	related, err := h.cooccurrence.TopRelated(c.Request.Context(), id, coPurchaseCandidates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	products, err := h.products.BoughtTogether(c.Request.Context(), related, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts := make(map[string]int, len(related))
+	for _, coPurchase := range related {
+		counts[coPurchase.ProductID] = coPurchase.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id":         id,
+		"products":           products,
+		"total":              len(products),
+		"co_purchase_counts": counts,
+	})
+}
+
+// GetTrending retrieves products with the highest time-decayed activity
+func (h *RecommendationHandler) GetTrending(c *gin.Context) {
+	category := c.Query("category")
+	window := h.defaultWindow
+	page := 1
+	pageSize := 10
+
+	if w, ok := c.GetQuery("window"); ok {
+		parsed, err := config.ParseDuration(w)
+		if err != nil || parsed < minTrendingWindow || parsed > maxTrendingWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a duration between 1h and 30d, e.g. 24h or 7d"})
+			return
+		}
+		window = parsed
+	}
+
+	if p, ok := c.GetQuery("page"); ok {
+		if _, err := fmt.Sscanf(p, "%d", &page); err != nil || page < 1 {
+			page = 1
+		}
+	}
+
+	if ps, ok := c.GetQuery("page_size"); ok {
+		if _, err := fmt.Sscanf(ps, "%d", &pageSize); err != nil || pageSize < 1 {
+			pageSize = 10
+		}
+	}
+
+	// Rank within the category, so categories outside the global top
+	// candidates still list their trending products
+	var productIDs []string
+	if category != "" {
+		ids, err := h.products.CategoryProductIDs(c.Request.Context(), category)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		productIDs = ids
+	}
+
+	scores, err := h.trending.TopTrending(c.Request.Context(), window, repository.TrendingCandidates, productIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	products, total, err := h.products.TrendingProducts(c.Request.Context(), scores, category, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	trendingScores := make(map[string]float64, len(products))
+	for _, score := range scores {
+		trendingScores[score.ProductID] = score.Score
+	}
+	productScores := make(map[string]float64, len(products))
+	for _, product := range products {
+		productScores[product.ID] = trendingScores[product.ID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products":        products,
+		"total":           total,
+		"page":            page,
+		"pageSize":        pageSize,
+		"category":        category,
+		"window":          window.String(),
+		"trending_scores": productScores,
+	})
+}
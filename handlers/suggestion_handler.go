@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSuggestions is the number of autocomplete suggestions returned by default
+const defaultSuggestions = 10
+
+type SuggestionHandler struct {
+	products    *repository.ProductRepository
+	suggestions *repository.SuggestionRepository
+}
+
+func NewSuggestionHandler(products *repository.ProductRepository, suggestions *repository.SuggestionRepository) *SuggestionHandler {
+	return &SuggestionHandler{products: products, suggestions: suggestions}
+}
+
+// Autocomplete completes a prefix with popular queries followed by product names
+func (h *SuggestionHandler) Autocomplete(c *gin.Context) {
+	var req models.AutocompleteRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Size == 0 {
+		req.Size = defaultSuggestions
+	}
+
+	ctx := c.Request.Context()
+	queries, err := h.suggestions.SuggestQueries(ctx, req.Query, req.Size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	products, err := h.products.SuggestProducts(ctx, req.Query, req.Size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	suggestions := blendSuggestions(queries, products, req.Size)
+	c.JSON(http.StatusOK, gin.H{
+		"query":       req.Query,
+		"suggestions": suggestions,
+		"total":       len(suggestions),
+	})
+}
+
+// blendSuggestions returns up to size suggestions: query suggestions fill
+// half of them (rounded up) and product names the rest. Either kind fills
+// the slots the other cannot. Queries identical to a suggested product
+// name are dropped.
+func blendSuggestions(queries, products []models.Suggestion, size int) []models.Suggestion {
+	productNames := make(map[string]bool, len(products))
+	for _, product := range products {
+		productNames[repository.NormalizeQuery(product.Text)] = true
+	}
+
+	var distinct []models.Suggestion
+	for _, query := range queries {
+		if !productNames[query.Text] {
+			distinct = append(distinct, query)
+		}
+	}
+
+	queryCount := min(len(distinct), (size+1)/2)
+	productCount := min(len(products), size-queryCount)
+	queryCount = min(len(distinct), size-productCount)
+
+	blended := make([]models.Suggestion, 0, queryCount+productCount)
+	blended = append(blended, distinct[:queryCount]...)
+	return append(blended, products[:productCount]...)
+}
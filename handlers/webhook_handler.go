@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	repo *repository.WebhookRepository
+}
+
+func NewWebhookHandler(repo *repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{repo: repo}
+}
+
+// CreateWebhook registers an endpoint for product change events. The
+// response is the only one that includes the signing secret.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.Create(c.Request.Context(), &webhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created successfully",
+		"webhook": webhook,
+	})
+}
+
+// ListWebhooks lists the registered webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks, err := h.repo.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhooks,
+		"total":    len(webhooks),
+	})
+}
+
+// DeleteWebhook deletes a webhook by ID
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	if err := h.repo.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, repository.ErrWebhookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// ListDeliveries lists the latest deliveries; status=dead lists the dead letters
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or dead"})
+		return
+	}
+
+	size := 20
+	if s, ok := c.GetQuery("size"); ok {
+		if _, err := fmt.Sscanf(s, "%d", &size); err != nil || size < 1 || size > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between 1 and 100"})
+			return
+		}
+	}
+
+	deliveries, err := h.repo.ListDeliveries(c.Request.Context(), status, c.Query("webhook_id"), size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      len(deliveries),
+	})
+}
+
+// GetDelivery returns a delivery with every attempt made
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	delivery, err := h.repo.GetDelivery(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrDeliveryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ReplayDelivery queues a delivery again for an immediate attempt
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	delivery, err := h.repo.Replay(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrDeliveryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Delivery queued for replay",
+		"delivery": delivery,
+	})
+}
+
+// ReplayDeadLetters queues every dead letter again, optionally of one webhook
+func (h *WebhookHandler) ReplayDeadLetters(c *gin.Context) {
+	replayed, err := h.repo.ReplayDead(c.Request.Context(), c.Query("webhook_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Dead letters queued for replay",
+		"replayed": replayed,
+	})
+}
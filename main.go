@@ -1,45 +1,264 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/aditya/elasticsearch-products-api/changefeed"
 	"github.com/aditya/elasticsearch-products-api/config"
+	"github.com/aditya/elasticsearch-products-api/embedding"
+	"github.com/aditya/elasticsearch-products-api/experiment"
 	"github.com/aditya/elasticsearch-products-api/handlers"
+	"github.com/aditya/elasticsearch-products-api/notify"
 	"github.com/aditya/elasticsearch-products-api/repository"
 	"github.com/aditya/elasticsearch-products-api/routes"
+	"github.com/aditya/elasticsearch-products-api/shadow"
+	"github.com/aditya/elasticsearch-products-api/webhook"
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout bounds how long in-flight requests may finish on shutdown;
+// open change streams are cut off after it
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
+	embedder, err := embedding.NewHashingEmbedder(cfg.EmbeddingDims)
+	if err != nil {
+		log.Fatalf("Invalid embedding configuration: %v", err)
+	}
+
 	// Initialize Elasticsearch client
 	esClient, err := config.NewElasticsearchClient(cfg.ElasticsearchURL)
 	if err != nil {
 		log.Fatalf("Failed to create Elasticsearch client: %v", err)
 	}
 
-	// Create index if it doesn't exist
-	if err := config.CreateProductIndex(esClient, cfg.ElasticsearchIndex); err != nil {
+	// Create indices if they don't exist
+	if err := config.CreateProductIndex(esClient, cfg.ElasticsearchIndex, cfg.EmbeddingDims); err != nil {
 		log.Fatalf("Failed to create index: %v", err)
 	}
+	if err := config.CreateEventIndex(esClient, cfg.EventsIndex); err != nil {
+		log.Fatalf("Failed to create events index: %v", err)
+	}
+	if err := config.CreateCoOccurrenceIndex(esClient, cfg.CoOccurrenceIndex); err != nil {
+		log.Fatalf("Failed to create co-occurrence index: %v", err)
+	}
+	if err := config.CreateTrendingIndex(esClient, cfg.TrendingIndex); err != nil {
+		log.Fatalf("Failed to create trending index: %v", err)
+	}
+	if err := config.CreateFeatureLogIndex(esClient, cfg.FeatureLogIndex); err != nil {
+		log.Fatalf("Failed to create feature log index: %v", err)
+	}
+	if err := config.CreateSearchLogIndex(esClient, cfg.AnalyticsIndex); err != nil {
+		log.Fatalf("Failed to create analytics index: %v", err)
+	}
+	if err := config.CreateSuggestionIndex(esClient, cfg.SuggestionIndex); err != nil {
+		log.Fatalf("Failed to create suggestion index: %v", err)
+	}
+	if err := config.CreateAlertIndex(esClient, cfg.AlertIndex, cfg.EmbeddingDims); err != nil {
+		log.Fatalf("Failed to create alert index: %v", err)
+	}
+	if err := config.CreateAlertQueueIndex(esClient, cfg.AlertQueueIndex); err != nil {
+		log.Fatalf("Failed to create alert queue index: %v", err)
+	}
+	if err := config.CreateWebhookIndex(esClient, cfg.WebhookIndex); err != nil {
+		log.Fatalf("Failed to create webhook index: %v", err)
+	}
+	if err := config.CreateWebhookDeliveryIndex(esClient, cfg.DeliveryIndex); err != nil {
+		log.Fatalf("Failed to create webhook delivery index: %v", err)
+	}
+	if err := config.CreateAuditIndex(esClient, cfg.AuditIndex); err != nil {
+		log.Fatalf("Failed to create audit index: %v", err)
+	}
+	if err := config.CreatePromotionIndex(esClient, cfg.PromotionIndex); err != nil {
+		log.Fatalf("Failed to create promotion index: %v", err)
+	}
+	if err := config.CreateCurrencyIndex(esClient, cfg.CurrencyIndex); err != nil {
+		log.Fatalf("Failed to create currency index: %v", err)
+	}
+	if err := config.CreateCategoryIndex(esClient, cfg.CategoryIndex); err != nil {
+		log.Fatalf("Failed to create category index: %v", err)
+	}
+
+	if err := repository.ValidateFallbackSteps(cfg.SearchFallbackSteps); err != nil {
+		log.Fatalf("Invalid search fallback configuration: %v", err)
+	}
 
-	// Initialize repository and handler
-	productRepo := repository.NewProductRepository(esClient, cfg.ElasticsearchIndex)
-	productHandler := handlers.NewProductHandler(productRepo)
+	freshness := repository.Freshness{
+		Function: cfg.FreshnessFunction,
+		Scale:    cfg.FreshnessScale,
+		Offset:   cfg.FreshnessOffset,
+		Decay:    cfg.FreshnessDecay,
+	}
+	if err := repository.ValidateFreshness(freshness); err != nil {
+		log.Fatalf("Invalid freshness configuration: %v", err)
+	}
+
+	if err := repository.ValidateTrashPurge(cfg.TrashPurgeInterval, cfg.TrashRetention); err != nil {
+		log.Fatalf("Invalid trash configuration: %v", err)
+	}
+
+	if err := repository.ValidateScheduleInterval(cfg.ScheduleInterval); err != nil {
+		log.Fatalf("Invalid publishing schedule configuration: %v", err)
+	}
+
+	// Default ranking profile; experiment variants override parts of it
+	ranking := repository.DefaultRankingProfile()
+	ranking.TrendingWeight = cfg.TrendingBoostWeight
+	ranking.FreshnessWeight = cfg.FreshnessWeight
+	ranking.AffinityCategoryWeight = cfg.AffinityCategory
+	ranking.AffinityPriceWeight = cfg.AffinityPriceBand
+	if err := repository.ValidateRankingProfile(ranking); err != nil {
+		log.Fatalf("Invalid ranking configuration: %v", err)
+	}
+
+	experiments, err := experiment.Load(cfg.ExperimentsFile, ranking)
+	if err != nil {
+		log.Fatalf("Invalid experiments configuration: %v", err)
+	}
+
+	notifier, err := notify.New(cfg.AlertNotifier, cfg.AlertNotifierTarget)
+	if err != nil {
+		log.Fatalf("Invalid alert notifier configuration: %v", err)
+	}
+
+	changeFeed, err := changefeed.NewFeed(cfg.ChangeBufferSize)
+	if err != nil {
+		log.Fatalf("Invalid changes configuration: %v", err)
+	}
+	changeHandler, err := handlers.NewChangeHandler(changeFeed, cfg.ChangeHeartbeat)
+	if err != nil {
+		log.Fatalf("Invalid changes configuration: %v", err)
+	}
+
+	currencyRates, err := repository.ParseRates(cfg.CurrencyRates)
+	if err != nil {
+		log.Fatalf("Invalid currency rates configuration: %v", err)
+	}
+
+	shadowCandidate := ranking
+	if cfg.ShadowSampleRate > 0 {
+		if shadowCandidate, err = shadow.LoadCandidate(cfg.ShadowProfileFile, ranking); err != nil {
+			log.Fatalf("Invalid shadow ranking configuration: %v", err)
+		}
+	}
+
+	// Initialize repositories and handlers
+	productRepo := repository.NewProductRepository(esClient, cfg.ElasticsearchIndex, embedder)
+	coOccurrenceRepo := repository.NewCoOccurrenceRepository(esClient, cfg.CoOccurrenceIndex)
+	trendingRepo, err := repository.NewTrendingRepository(esClient, cfg.TrendingIndex, cfg.TrendingHalfLife, cfg.TrendingWindow)
+	if err != nil {
+		log.Fatalf("Invalid trending configuration: %v", err)
+	}
+	profileStore := repository.NewMemoryProfileStore(cfg.ProfileStoreSize)
+	affinityTracker := repository.NewAffinityTracker(productRepo, profileStore, cfg.AffinityHalfLife)
+	searchLogRepo, err := repository.NewSearchLogRepository(esClient, cfg.AnalyticsIndex, cfg.SearchLogBuffer, cfg.SearchLogFlush)
+	if err != nil {
+		log.Fatalf("Invalid search log configuration: %v", err)
+	}
+	eventRepo := repository.NewEventRepository(esClient, cfg.EventsIndex, coOccurrenceRepo, trendingRepo, affinityTracker, searchLogRepo)
+	productRepo.SetRankingProfile(ranking)
+	productRepo.SetTrending(trendingRepo)
+	productRepo.SetFreshness(freshness, cfg.NewArrivalsPeriod)
+	productRepo.SetPersonalization(profileStore)
+	promotionRepo := repository.NewPromotionRepository(esClient, cfg.PromotionIndex)
+	productRepo.SetPromotions(promotionRepo)
+	currencyRepo := repository.NewCurrencyRepository(esClient, cfg.CurrencyIndex, cfg.BaseCurrency)
+	if err := currencyRepo.Seed(context.Background(), currencyRates); err != nil {
+		log.Fatalf("Failed to seed currency rates: %v", err)
+	}
+	productRepo.SetCurrencies(currencyRepo)
+	promotionRepo.SetCurrencies(currencyRepo)
+	// Price filters and sorts use the base currency price, so products without
+	// one would drop out of them
+	if count, err := productRepo.BackfillBasePrices(context.Background()); err != nil {
+		log.Fatalf("Failed to backfill base currency prices: %v", err)
+	} else if count > 0 {
+		log.Printf("Backfilled base currency prices of %d products", count)
+	}
+	categoryRepo := repository.NewCategoryRepository(esClient, cfg.CategoryIndex)
+	productRepo.SetTaxonomy(categoryRepo)
+	if count, err := productRepo.BackfillCategoryPaths(context.Background()); err != nil {
+		log.Printf("Failed to backfill category paths: %v", err)
+	} else if count > 0 {
+		log.Printf("Backfilled category paths of %d products", count)
+	}
+	go productRepo.PurgeTrashEvery(cfg.TrashPurgeInterval, cfg.TrashRetention)
+	go productRepo.ScheduleEvery(cfg.ScheduleInterval)
+	featureLogRepo := repository.NewFeatureLogRepository(esClient, cfg.FeatureLogIndex, cfg.EventsIndex)
+	productRepo.SetFeatureLogging(featureLogRepo, cfg.LTRSampleRate)
+	suggestionRepo, err := repository.NewSuggestionRepository(esClient, cfg.SuggestionIndex, cfg.AnalyticsIndex, cfg.SuggestionWindow, cfg.SuggestionMinCount, cfg.SuggestionBlocklist, cfg.SuggestionRefresh)
+	if err != nil {
+		log.Fatalf("Invalid suggestion configuration: %v", err)
+	}
+	go suggestionRepo.RefreshEvery()
+	alertRepo, err := repository.NewAlertRepository(esClient, cfg.AlertIndex, cfg.AlertQueueIndex, productRepo, notifier, cfg.AlertPollInterval)
+	if err != nil {
+		log.Fatalf("Invalid alert configuration: %v", err)
+	}
+	go alertRepo.Run()
+	webhookRepo := repository.NewWebhookRepository(esClient, cfg.WebhookIndex, cfg.DeliveryIndex)
+	auditRepo := repository.NewAuditRepository(esClient, cfg.AuditIndex, productRepo)
+	productRepo.SetHistory(auditRepo)
+	productRepo.SetProductListeners(alertRepo, webhookRepo, changeFeed)
+	dispatcher, err := webhook.NewDispatcher(webhookRepo, cfg.WebhookMaxAttempts, cfg.WebhookRetryBase, cfg.WebhookPollInterval)
+	if err != nil {
+		log.Fatalf("Invalid webhook configuration: %v", err)
+	}
+	go dispatcher.Run()
+
+	shadowEvaluator := shadow.NewEvaluator(productRepo, shadowCandidate, cfg.ShadowSampleRate, cfg.SearchFallbackSteps)
 
 	// Initialize Gin router
 	router := gin.Default()
 
 	// Setup routes
-	routes.SetupRoutes(router, productHandler)
+	routes.SetupRoutes(router, &routes.Handlers{
+		Product:        handlers.NewProductHandler(productRepo, eventRepo, searchLogRepo, experiments, shadowEvaluator, cfg.SearchFallbackSteps),
+		Event:          handlers.NewEventHandler(eventRepo, experiments),
+		Recommendation: handlers.NewRecommendationHandler(productRepo, coOccurrenceRepo, trendingRepo, cfg.TrendingWindow),
+		Experiment:     handlers.NewExperimentHandler(experiments, eventRepo),
+		Suggestion:     handlers.NewSuggestionHandler(productRepo, suggestionRepo),
+		Alert:          handlers.NewAlertHandler(alertRepo),
+		Webhook:        handlers.NewWebhookHandler(webhookRepo),
+		Change:         changeHandler,
+		Audit:          handlers.NewAuditHandler(auditRepo),
+		Promotion:      handlers.NewPromotionHandler(promotionRepo),
+		Currency:       handlers.NewCurrencyHandler(currencyRepo, productRepo),
+		Category:       handlers.NewCategoryHandler(categoryRepo, productRepo),
+		Admin:          handlers.NewAdminHandler(shadowEvaluator, featureLogRepo, searchLogRepo, suggestionRepo),
+	})
 
 	// Start server
 	addr := fmt.Sprintf(":%s", cfg.ServerPort)
-	log.Printf("Server starting on %s", addr)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: addr, Handler: router}
+	go func() {
+		log.Printf("Server starting on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Stop on SIGINT/SIGTERM, writing out the buffered search logs
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down server...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown incomplete: %v", err)
 	}
+	searchLogRepo.Close()
 }
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// SavedSearch is a search a shopper is alerted about when a matching product
+// is added or restocked. Only the query, syntax, category, price and stock
+// parameters of the search are used.
+type SavedSearch struct {
+	ID        string               `json:"id"`
+	UserID    string               `json:"user_id" binding:"required"`
+	Name      string               `json:"name"`
+	Search    ProductSearchRequest `json:"search"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// Reasons a saved search alert fires
+const (
+	AlertReasonNewProduct  = "new_product"  // a matching product was created
+	AlertReasonRestocked   = "restocked"    // a matching product came back in stock
+	AlertReasonNowMatching = "now_matching" // an update made a product match, e.g. a price drop
+)
+
+// AlertNotification tells a shopper that a product matches their saved search
+type AlertNotification struct {
+	AlertID   string    `json:"alert_id"`
+	AlertName string    `json:"alert_name,omitempty"`
+	UserID    string    `json:"user_id"`
+	Reason    string    `json:"reason"`
+	Product   Product   `json:"product"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AlertChange is a product change queued for matching against saved searches
+type AlertChange struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"product_id"`
+	Before    *Product  `json:"before,omitempty"` // nil when the product is new to shoppers
+	After     Product   `json:"after"`
+	QueuedAt  time.Time `json:"queued_at"`
+}
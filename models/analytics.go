@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// SearchLogEntry records one served search for analytics
+type SearchLogEntry struct {
+	SearchID    string    `json:"search_id"`
+	Query       string    `json:"query"`             // normalized: lowercase, single spaces
+	Filters     []string  `json:"filters,omitempty"` // request parameters in use, e.g. "category", "price", "in_stock"
+	Category    string    `json:"category,omitempty"`
+	Total       int       `json:"total"`
+	ZeroResults bool      `json:"zero_results"`         // nothing matched the request as sent, even if a fallback step did
+	Relaxation  string    `json:"relaxation,omitempty"` // fallback step that produced the results
+	LatencyMs   int64     `json:"latency_ms"`
+	Page        int       `json:"page"`
+	UserID      string    `json:"user_id,omitempty"`
+	SessionID   string    `json:"session_id,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	Clicked     bool      `json:"clicked,omitempty"` // a click event carried the search ID
+}
+
+// QueryStats aggregates the searches of one normalized query
+type QueryStats struct {
+	Query        string    `json:"query"`
+	Searches     int       `json:"searches"`
+	ZeroResults  int       `json:"zero_results"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// QueryCTR is the share of a query's searches followed by a click
+type QueryCTR struct {
+	Query           string  `json:"query"`
+	Searches        int     `json:"searches"`
+	ClickedSearches int     `json:"clicked_searches"`
+	CTR             float64 `json:"ctr"`
+}
+
+// FilterUsage counts the searches using a filter
+type FilterUsage struct {
+	Filter   string  `json:"filter"`
+	Searches int     `json:"searches"`
+	Share    float64 `json:"share"` // fraction of all searches
+}
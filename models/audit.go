@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// AuditActionPurged is the history action of permanently deleting a product
+// that was already in the trash; other actions are the change types
+const AuditActionPurged = "purged"
+
+// AuditRecord is one version in the history of a product
+type AuditRecord struct {
+	ProductID    string                 `json:"product_id"`
+	Version      int                    `json:"version"`                 // starts at 1 when the product is created
+	Action       string                 `json:"action"`                  // created, updated, deleted or purged
+	RevertedFrom int                    `json:"reverted_from,omitempty"` // version restored by a revert
+	Actor        string                 `json:"actor"`
+	Changes      map[string]FieldChange `json:"changes,omitempty"`
+	Snapshot     *Product               `json:"snapshot"` // the product after the change; the last version for a deletion
+	Timestamp    time.Time              `json:"timestamp"`
+}
+
+// FieldChange is the value of a field before and after a change
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// ProductDiff returns the JSON fields that differ between two versions of a
+// product; either may be nil. updated_at is left out since every write changes it.
+func ProductDiff(before, after *Product) (map[string]FieldChange, error) {
+	beforeFields, err := productFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := productFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]FieldChange)
+	for name, value := range afterFields {
+		if !reflect.DeepEqual(beforeFields[name], value) {
+			diff[name] = FieldChange{Before: beforeFields[name], After: value}
+		}
+	}
+	for name, value := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			diff[name] = FieldChange{Before: value}
+		}
+	}
+	delete(diff, "updated_at")
+	return diff, nil
+}
+
+// ChangedFields lists the names of a diff in order
+func ChangedFields(diff map[string]FieldChange) []string {
+	fields := make([]string, 0, len(diff))
+	for name := range diff {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// productFields decodes a product into its JSON fields; nil has none
+func productFields(product *Product) (map[string]interface{}, error) {
+	if product == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// CategoryPathSeparator joins the category IDs of a path, e.g.
+// "electronics/audio/headphones"
+const CategoryPathSeparator = "/"
+
+// maxCategoryDepth bounds path walks in case the stored tree has a cycle
+const maxCategoryDepth = 32
+
+// Category is a node of the category taxonomy. Products reference it by ID
+// in their category field.
+type Category struct {
+	ID        string    `json:"id"`                      // slug, e.g. "headphones"; set from the URL on update
+	Name      string    `json:"name" binding:"required"` // display name, e.g. "Headphones"
+	ParentID  string    `json:"parent_id,omitempty"`     // empty for a top-level category
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Taxonomy is the category tree, keyed by category ID
+type Taxonomy map[string]Category
+
+// Ancestry returns a category and its ancestors, top-level category first, or
+// nil for an unknown category
+func (t Taxonomy) Ancestry(id string) []Category {
+	var ancestry []Category
+	for id != "" && len(ancestry) < maxCategoryDepth {
+		category, ok := t[id]
+		if !ok {
+			break
+		}
+		ancestry = append([]Category{category}, ancestry...)
+		id = category.ParentID
+	}
+	return ancestry
+}
+
+// Path returns the indexed path of a category. A category missing from the
+// taxonomy is its own top-level path.
+func (t Taxonomy) Path(id string) string {
+	ancestry := t.Ancestry(id)
+	if len(ancestry) == 0 {
+		return id
+	}
+	ids := make([]string, len(ancestry))
+	for i, category := range ancestry {
+		ids[i] = category.ID
+	}
+	return strings.Join(ids, CategoryPathSeparator)
+}
+
+// Paths returns the path of a category and of each of its ancestors,
+// top-level category first, e.g. "electronics", "electronics/audio" and
+// "electronics/audio/headphones". Products are indexed with all of them, so a
+// filter on an ancestor path matches the category.
+func (t Taxonomy) Paths(id string) []string {
+	if id == "" {
+		return nil
+	}
+	ids := strings.Split(t.Path(id), CategoryPathSeparator)
+	paths := make([]string, len(ids))
+	for i := range ids {
+		paths[i] = strings.Join(ids[:i+1], CategoryPathSeparator)
+	}
+	return paths
+}
+
+// Breadcrumbs returns the trail from the top-level category down to a category
+func (t Taxonomy) Breadcrumbs(id string) []Breadcrumb {
+	ancestry := t.Ancestry(id)
+	breadcrumbs := make([]Breadcrumb, len(ancestry))
+	for i, category := range ancestry {
+		breadcrumbs[i] = Breadcrumb{ID: category.ID, Name: category.Name}
+	}
+	return breadcrumbs
+}
+
+// Children returns the direct subcategories of a category, sorted by name; an
+// empty ID returns the top-level categories
+func (t Taxonomy) Children(id string) []Category {
+	children := []Category{}
+	for _, category := range t {
+		if category.ParentID == id {
+			children = append(children, category)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// Subtree returns the IDs of a category and all of its descendants
+func (t Taxonomy) Subtree(id string) []string {
+	ids := []string{id}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range t.Children(ids[i]) {
+			ids = append(ids, child.ID)
+		}
+	}
+	return ids
+}
+
+// CategoryNode is a category with its subcategories, as listed by the API
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children,omitempty"`
+}
+
+// Tree returns the taxonomy as nested nodes below a category; an empty ID
+// returns the whole tree
+func (t Taxonomy) Tree(id string) []CategoryNode {
+	children := t.Children(id)
+	nodes := make([]CategoryNode, len(children))
+	for i, child := range children {
+		nodes[i] = CategoryNode{Category: child, Children: t.Tree(child.ID)}
+	}
+	return nodes
+}
+
+// Breadcrumb is a step of the trail to a category
+type Breadcrumb struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CategoryFacet counts the results in a category, including its subcategories
+type CategoryFacet struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	Count    int             `json:"count"`
+	Children []CategoryFacet `json:"children,omitempty"`
+}
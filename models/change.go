@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Catalog change types, also the SSE event names of the changes stream
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// ProductChange is one entry of the catalog changes stream
+type ProductChange struct {
+	ID               string    `json:"id"` // "<epoch>-<sequence>"; the sequence increases by one per change and the epoch changes when the server restarts
+	Type             string    `json:"type"`
+	ProductID        string    `json:"product_id"`
+	Category         string    `json:"category"`
+	PreviousCategory string    `json:"previous_category,omitempty"` // set when an update moved the product
+	Fields           []string  `json:"fields,omitempty"`            // fields an update changed
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// Matches reports whether the change concerns a category; an empty category matches all
+func (c ProductChange) Matches(category string) bool {
+	return category == "" || c.Category == category || c.PreviousCategory == category
+}
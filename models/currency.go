@@ -0,0 +1,98 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Currency is an entry of the exchange rates table
+type Currency struct {
+	Code      string    `json:"code"`
+	Rate      float64   `json:"rate"`     // units of this currency per unit of the base currency
+	Decimals  int       `json:"decimals"` // digits of the minor unit prices are rounded to, e.g. 0 for IDR
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// zeroDecimalCurrencies are priced in whole units
+var zeroDecimalCurrencies = map[string]bool{
+	"IDR": true,
+	"JPY": true,
+	"KRW": true,
+	"VND": true,
+}
+
+// DefaultDecimals returns the usual minor unit digits of a currency
+func DefaultDecimals(code string) int {
+	if zeroDecimalCurrencies[code] {
+		return 0
+	}
+	return 2
+}
+
+// DecimalsTable returns the minor unit digits of every currency in the table,
+// or without a table the currencies that differ from the usual two digits
+func (r *CurrencyRates) DecimalsTable() map[string]int {
+	decimals := map[string]int{}
+	if r == nil {
+		for code := range zeroDecimalCurrencies {
+			decimals[code] = 0
+		}
+		return decimals
+	}
+	for code, currency := range r.Currencies {
+		decimals[code] = currency.Decimals
+	}
+	return decimals
+}
+
+// Round rounds an amount to the minor unit of the currency
+func (c Currency) Round(amount float64) float64 {
+	scale := math.Pow(10, float64(c.Decimals))
+	return math.Round(amount*scale) / scale
+}
+
+// CurrencyRates is the exchange rates table. The base currency has rate 1 and
+// is the currency of normalized prices.
+type CurrencyRates struct {
+	Base       string              `json:"base"`
+	Currencies map[string]Currency `json:"currencies"`
+}
+
+// Lookup returns a currency of the table; an empty code is the base currency
+func (r CurrencyRates) Lookup(code string) (Currency, bool) {
+	if code == "" {
+		code = r.Base
+	}
+	currency, ok := r.Currencies[code]
+	return currency, ok
+}
+
+// ToBase converts an amount to the base currency, unrounded
+func (r CurrencyRates) ToBase(amount float64, code string) (float64, bool) {
+	currency, ok := r.Lookup(code)
+	if !ok {
+		return 0, false
+	}
+	return amount / currency.Rate, true
+}
+
+// Convert converts an amount between currencies, rounded to the minor unit of
+// the target currency
+func (r CurrencyRates) Convert(amount float64, from, to string) (float64, bool) {
+	base, ok := r.ToBase(amount, from)
+	if !ok {
+		return 0, false
+	}
+	target, ok := r.Lookup(to)
+	if !ok {
+		return 0, false
+	}
+	return target.Round(base * target.Rate), true
+}
+
+// ConvertedPrice is a product price in the currency requested by the client
+type ConvertedPrice struct {
+	Currency  string   `json:"currency"`
+	Price     float64  `json:"price"`
+	SalePrice *float64 `json:"sale_price,omitempty"` // set while a promotion is active
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Event types accepted by the events endpoint
+const (
+	EventTypeView      = "view"        // product page view
+	EventTypeClick     = "click"       // click on a product in search results or listings
+	EventTypeAddToCart = "add_to_cart" // product added to the cart
+	EventTypePurchase  = "purchase"    // an order containing one or more products
+
+	// EventTypeSearch is recorded by the API for searches served in an
+	// experiment; it is not accepted by the events endpoint
+	EventTypeSearch = "search"
+)
+
+// Event represents a shopper interaction posted to the events endpoint
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type" binding:"required,oneof=view click add_to_cart purchase"`
+	ProductIDs []string  `json:"product_ids" binding:"required,min=1,dive,required"`
+	OrderID    string    `json:"order_id,omitempty"`
+	UserID     string    `json:"user_id,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	SearchID   string    `json:"search_id,omitempty"`  // search_id of the search response that led to the event
+	Experiment string    `json:"experiment,omitempty"` // set by the API from the shopper's experiment bucket
+	Variant    string    `json:"variant,omitempty"`
+	Timestamp  time.Time `json:"timestamp"` // defaults to the time the event is received
+}
+
+// CoPurchase counts how often a product was bought together with another
+type CoPurchase struct {
+	ProductID string `json:"product_id"`
+	Count     int    `json:"count"`
+}
+
+// TrendingScore is the time-decayed popularity of a product over a window
+type TrendingScore struct {
+	ProductID string  `json:"product_id"`
+	Score     float64 `json:"score"`
+}
@@ -0,0 +1,45 @@
+package models
+
+// RankingProfile holds the tunable constants of the scoring formula. Zero
+// weights disable the optional factors.
+type RankingProfile struct {
+	OutOfStockMultiplier   float64 `json:"out_of_stock_multiplier"`  // S for out-of-stock products
+	RatingBase             float64 `json:"rating_base"`              // R at 0 stars
+	RatingRange            float64 `json:"rating_range"`             // R gained from 0 to 5 stars
+	ReviewWeight           float64 `json:"review_weight"`            // Re per log₁₀ of review count
+	PopularityWeight       float64 `json:"popularity_weight"`        // P per log₁₀ of sales count
+	CTRWeight              float64 `json:"ctr_weight"`               // E per unit of CTR
+	ViewWeight             float64 `json:"view_weight"`              // E per log₁₀ of view count
+	PromotedBoost          float64 `json:"promoted_boost"`           // B for promoted products
+	MarginWeight           float64 `json:"margin_weight"`            // B per unit of margin
+	TrendingWeight         float64 `json:"trending_weight"`          // T per log₁₀ of trending score
+	FreshnessWeight        float64 `json:"freshness_weight"`         // F for a brand new product
+	AffinityCategoryWeight float64 `json:"affinity_category_weight"` // A for a user's only category
+	AffinityPriceWeight    float64 `json:"affinity_price_weight"`    // A for a user's only price band
+}
+
+// ExperimentAssignment identifies the experiment variant a shopper is bucketed into
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// VariantReport compares the engagement of one experiment variant
+type VariantReport struct {
+	Variant        string  `json:"variant"`
+	Shoppers       int     `json:"shoppers"`        // distinct users or sessions with events
+	Searches       int     `json:"searches"`        // searches served by the variant
+	Views          int     `json:"views"`           // product page views
+	Clicks         int     `json:"clicks"`          // clicks on search results or listings
+	AddToCarts     int     `json:"add_to_carts"`    // products added to the cart
+	Purchases      int     `json:"purchases"`       // purchase events
+	Buyers         int     `json:"buyers"`          // distinct shoppers with a purchase
+	CTR            float64 `json:"ctr"`             // clicks per search
+	ConversionRate float64 `json:"conversion_rate"` // buyers per shopper
+}
+
+// ExperimentReport compares the variants of an experiment
+type ExperimentReport struct {
+	Experiment string          `json:"experiment"`
+	Variants   []VariantReport `json:"variants"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Product lifecycle statuses
+const (
+	StatusDraft     = "draft"     // being prepared; hidden from shoppers
+	StatusPublished = "published" // searchable and listed
+	StatusArchived  = "archived"  // withdrawn; may be published again
+)
+
+// statusTransitions lists the statuses each status may change to
+var statusTransitions = map[string][]string{
+	StatusDraft:     {StatusPublished, StatusArchived},
+	StatusPublished: {StatusDraft, StatusArchived},
+	StatusArchived:  {StatusPublished},
+}
+
+// CanTransition reports whether a product may change from one status to another
+func CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LifecycleStatus is the status of a product; products stored before
+// lifecycles existed have none and count as published
+func (p *Product) LifecycleStatus() string {
+	if p.Status == "" {
+		return StatusPublished
+	}
+	return p.Status
+}
+
+// IsLive reports whether shoppers can see the product at a time
+func (p *Product) IsLive(now time.Time) bool {
+	return p.DeletedAt == nil && p.LifecycleStatus() == StatusPublished &&
+		(p.UnpublishAt == nil || p.UnpublishAt.After(now))
+}
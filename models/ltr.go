@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// FeatureRow is the logged feature vector of one product in a search response
+type FeatureRow struct {
+	SearchID  string             `json:"search_id"`
+	Query     string             `json:"query"`
+	ProductID string             `json:"product_id"`
+	Position  int                `json:"position"` // 1-based rank in the response
+	Features  map[string]float64 `json:"features"` // "bm25" and the scoring formula factors
+	UserID    string             `json:"user_id,omitempty"`
+	SessionID string             `json:"session_id,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+	Label     int                `json:"label"` // set on export from the outcome events
+}
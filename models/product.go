@@ -4,29 +4,128 @@ import "time"
 
 // Product represents a product entity
 type Product struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name" binding:"required"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price" binding:"required,gt=0"`
-	Category    string    `json:"category" binding:"required"`
-	Stock       int       `json:"stock" binding:"required,gte=0"`
-	Rating      float64   `json:"rating" binding:"gte=0,lte=5"`        // 0-5 stars
-	ReviewCount int       `json:"review_count" binding:"gte=0"`        // number of reviews
-	SalesCount  int       `json:"sales_count" binding:"gte=0"`         // total sales
-	ViewCount   int       `json:"view_count" binding:"gte=0"`          // product page views
-	CTR         float64   `json:"ctr" binding:"gte=0,lte=1"`           // click-through rate (0-1)
-	IsPromoted  bool      `json:"is_promoted"`                         // featured/promoted product
-	Margin      float64   `json:"margin" binding:"gte=0,lte=1"`        // profit margin (0-1)
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string          `json:"id"`
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description"`
+	Price       float64         `json:"price" binding:"required,gt=0"`
+	Currency    string          `json:"currency" binding:"omitempty,len=3"` // ISO 4217 code of the price; the base currency when empty
+	Category    string          `json:"category" binding:"required"`
+	Stock       int             `json:"stock" binding:"required,gte=0"`
+	Rating      float64         `json:"rating" binding:"gte=0,lte=5"` // 0-5 stars
+	ReviewCount int             `json:"review_count" binding:"gte=0"` // number of reviews
+	SalesCount  int             `json:"sales_count" binding:"gte=0"`  // total sales
+	ViewCount   int             `json:"view_count" binding:"gte=0"`   // product page views
+	CTR         float64         `json:"ctr" binding:"gte=0,lte=1"`    // click-through rate (0-1)
+	IsPromoted  bool            `json:"is_promoted"`                  // featured/promoted product
+	Margin      float64         `json:"margin" binding:"gte=0,lte=1"` // profit margin (0-1)
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   *time.Time      `json:"deleted_at,omitempty"` // set while the product is in the trash
+	Status      string          `json:"status" binding:"omitempty,oneof=draft published archived"`
+	PublishAt   *time.Time      `json:"publish_at,omitempty"`            // when a draft is published
+	UnpublishAt *time.Time      `json:"unpublish_at,omitempty"`          // when a published product is archived
+	Sale        *Sale           `json:"sale,omitempty" binding:"-"`      // set in responses while a promotion is active; never stored
+	Converted   *ConvertedPrice `json:"converted,omitempty" binding:"-"` // set in responses for a requested currency; never stored
 }
 
 // ProductSearchRequest represents search query parameters
 type ProductSearchRequest struct {
-	Query    string  `form:"q" json:"q"`
-	Category string  `form:"category" json:"category"`
-	MinPrice float64 `form:"min_price" json:"min_price"`
-	MaxPrice float64 `form:"max_price" json:"max_price"`
-	Page     int     `form:"page" json:"page"`
-	PageSize int     `form:"page_size" json:"page_size"`
+	Query     string  `form:"q" json:"q"`
+	Syntax    string  `form:"syntax" json:"syntax" binding:"omitempty,oneof=simple advanced"`                         // "advanced" enables the query language
+	Mode      string  `form:"mode" json:"mode" binding:"omitempty,oneof=keyword hybrid"`                              // "hybrid" adds semantic kNN retrieval
+	Sort      string  `form:"sort" json:"sort" binding:"omitempty,oneof=relevance new_arrivals price_asc price_desc"` // "new_arrivals" lists recent products newest first
+	Category  string  `form:"category" json:"category"`
+	MinPrice  float64 `form:"min_price" json:"min_price"`
+	MaxPrice  float64 `form:"max_price" json:"max_price"`
+	Currency  string  `form:"currency" json:"currency,omitempty"` // currency of the price filters, facets and converted prices
+	InStock   bool    `form:"in_stock" json:"in_stock"`
+	UserID    string  `form:"user_id" json:"user_id,omitempty"`       // personalizes ranking; empty for anonymous shoppers
+	SessionID string  `form:"session_id" json:"session_id,omitempty"` // buckets anonymous shoppers into experiments
+	Page      int     `form:"page" json:"page"`
+	PageSize  int     `form:"page_size" json:"page_size"`
+
+	// Category diversity re-ranking
+	Diversify      bool `form:"diversify" json:"diversify"`               // cap results per category in the top window
+	MaxPerCategory int  `form:"max_per_category" json:"max_per_category"` // per-category cap (default: 3)
+
+	// Facets adds price range and category counts to the result
+	Facets bool `form:"facets" json:"facets,omitempty"`
+
+	// Ranking overrides the default scoring constants, e.g. for an experiment variant
+	Ranking *RankingProfile `form:"-" json:"-"`
+
+	// SearchID identifies the response for feature logging; empty disables logging
+	SearchID string `form:"-" json:"-"`
+}
+
+// SearchResult represents a page of search results
+type SearchResult struct {
+	Products       []Product            `json:"products"`
+	Total          int                  `json:"total"`
+	Relaxation     *SearchRelaxation    `json:"relaxation,omitempty"`      // set when a fallback step produced the results
+	Interpretation *QueryInterpretation `json:"interpretation,omitempty"`  // set when intent was detected in the query
+	ParsedQuery    string               `json:"parsed_query,omitempty"`    // normalized form of an advanced syntax query
+	PriceFacets    []PriceFacet         `json:"price_facets,omitempty"`    // set when facets are requested
+	CategoryFacets []CategoryFacet      `json:"category_facets,omitempty"` // set when facets are requested
+	Breadcrumbs    []Breadcrumb         `json:"breadcrumbs,omitempty"`     // trail to the filtered category
+}
+
+// PriceFacet counts the results in a price range, by effective (sale) price
+type PriceFacet struct {
+	Key   string  `json:"key"`
+	From  float64 `json:"from,omitempty"`
+	To    float64 `json:"to,omitempty"` // exclusive; zero for the open-ended top range
+	Count int     `json:"count"`
+}
+
+// Retrieval modes accepted in ProductSearchRequest.Mode
+const (
+	SearchModeKeyword = "keyword" // BM25 text matching (default)
+	SearchModeHybrid  = "hybrid"  // BM25 and kNN candidates merged with reciprocal rank fusion
+)
+
+// Listing orders accepted in ProductSearchRequest.Sort
+const (
+	SortRelevance   = "relevance"    // scoring formula (default)
+	SortNewArrivals = "new_arrivals" // products created within the new-arrivals period, newest first
+	SortPriceAsc    = "price_asc"    // cheapest first, by effective (sale) price
+	SortPriceDesc   = "price_desc"   // most expensive first, by effective (sale) price
+)
+
+// Query syntaxes accepted in ProductSearchRequest.Syntax
+const (
+	SyntaxSimple   = "simple"   // free text with query understanding (default)
+	SyntaxAdvanced = "advanced" // field filters, comparisons, negation, phrases and OR
+)
+
+// SearchRelaxation describes the fallback step that produced results for a zero-result search
+type SearchRelaxation struct {
+	Step    string               `json:"step"`    // e.g. "drop_price", "drop_category", "relax_text", "trending"
+	Request ProductSearchRequest `json:"request"` // the relaxed request that was actually run
+}
+
+// Ways a category detected in the query is applied
+const (
+	CategoryIntentFilter = "filter" // query names only the category: restrict results to it
+	CategoryIntentBoost  = "boost"  // category mentioned alongside other terms: rank it higher
+)
+
+// QueryInterpretation describes the intent extracted from a free-text query
+type QueryInterpretation struct {
+	Original     string  `json:"original"`                // query as typed by the user
+	Text         string  `json:"text"`                    // remaining text matched against name/description
+	Category     string  `json:"category,omitempty"`      // detected category
+	CategoryMode string  `json:"category_mode,omitempty"` // "filter" or "boost"
+	MinPrice     float64 `json:"min_price,omitempty"`     // from "over 50", "between 50 and 100"
+	MaxPrice     float64 `json:"max_price,omitempty"`     // from "under 50", "between 50 and 100"
+	InStock      bool    `json:"in_stock,omitempty"`      // from "in stock"
+}
+
+// SimilarProductsRequest represents query parameters for similar product lookups
+type SimilarProductsRequest struct {
+	Size        int     `form:"size" binding:"gte=0,lte=50"`      // number of results (default: 10)
+	AnyCategory bool    `form:"any_category"`                     // allow results outside the source category
+	PriceBand   float64 `form:"price_band" binding:"gte=0,lte=1"` // +/- fraction of the source price, e.g. 0.3
+	MinPrice    float64 `form:"min_price" binding:"gte=0"`        // explicit lower price bound, in the source currency
+	MaxPrice    float64 `form:"max_price" binding:"gte=0"`        // explicit upper price bound, in the source currency
 }
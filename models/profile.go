@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// UserProfile holds a shopper's decayed interest per category and price band,
+// derived from their events
+type UserProfile struct {
+	UserID     string             `json:"user_id"`
+	Categories map[string]float64 `json:"categories"`  // affinity by category
+	PriceBands map[string]float64 `json:"price_bands"` // affinity by price band, e.g. "50-100"
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
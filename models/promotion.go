@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Promotion is a time-boxed discount on a set of products and categories.
+// Exactly one of SalePrice and PercentOff is set.
+type Promotion struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name" binding:"required"`
+	SalePrice  float64   `json:"sale_price,omitempty" binding:"gte=0"`         // fixed price during the promotion
+	Currency   string    `json:"currency,omitempty" binding:"omitempty,len=3"` // currency of SalePrice; the base currency when empty
+	PercentOff float64   `json:"percent_off,omitempty" binding:"gte=0,lt=100"` // discount off the list price
+	StartsAt   time.Time `json:"starts_at" binding:"required"`
+	EndsAt     time.Time `json:"ends_at" binding:"required"`
+	ProductIDs []string  `json:"product_ids,omitempty"` // targeted products
+	Categories []string  `json:"categories,omitempty"`  // targeted categories
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ActiveAt reports whether the promotion window contains t
+func (p Promotion) ActiveAt(t time.Time) bool {
+	return !t.Before(p.StartsAt) && t.Before(p.EndsAt)
+}
+
+// Targets reports whether the promotion applies to a product, directly or
+// through its category or one of the ancestors of the category in taxonomy
+func (p Promotion) Targets(product *Product, taxonomy Taxonomy) bool {
+	for _, id := range p.ProductIDs {
+		if id == product.ID {
+			return true
+		}
+	}
+	ancestry := strings.Split(taxonomy.Path(product.Category), CategoryPathSeparator)
+	for _, category := range p.Categories {
+		for _, id := range ancestry {
+			if category == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PriceFor returns the promotional price of a product in its own currency.
+// Percentages are rounded to the minor unit of the product currency; a sale
+// price is converted from the promotion currency with rates, or used as is
+// when rates is nil. It reports false when the sale price cannot be converted.
+func (p Promotion) PriceFor(product *Product, rates *CurrencyRates) (float64, bool) {
+	if p.SalePrice <= 0 {
+		currency := Currency{Code: product.Currency, Decimals: DefaultDecimals(product.Currency)}
+		if rates != nil {
+			if known, ok := rates.Lookup(product.Currency); ok {
+				currency = known
+			}
+		}
+		return currency.Round(product.Price * (100 - p.PercentOff) / 100), true
+	}
+	if rates == nil {
+		return p.SalePrice, true
+	}
+	return rates.Convert(p.SalePrice, p.Currency, product.Currency)
+}
+
+// Sale is the promotional price of a product while a promotion is active
+type Sale struct {
+	Price       float64   `json:"price"`
+	PromotionID string    `json:"promotion_id"`
+	EndsAt      time.Time `json:"ends_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// ShadowComparison compares the top results of a search with those of the
+// shadow candidate ranking
+type ShadowComparison struct {
+	Query       string    `json:"query"`
+	Category    string    `json:"category,omitempty"`
+	Jaccard     float64   `json:"jaccard"`               // overlap of the two top 10s (1 = same products)
+	KendallTau  *float64  `json:"kendall_tau,omitempty"` // order agreement of shared products; unset with fewer than 2
+	NewInTop10  int       `json:"new_in_top10"`          // candidate top 10 products missing from production
+	Production  []string  `json:"production"`            // production top 10 product IDs
+	Candidate   []string  `json:"candidate"`             // candidate top 10 product IDs
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// ShadowSummary aggregates the shadow comparisons since startup
+type ShadowSummary struct {
+	Enabled        bool               `json:"enabled"`
+	SampleRate     float64            `json:"sample_rate"`
+	Candidate      RankingProfile     `json:"candidate"`
+	Evaluated      int                `json:"evaluated"`
+	Dropped        int                `json:"dropped"` // sampled searches skipped because the queue was full
+	Failed         int                `json:"failed"`
+	MeanJaccard    float64            `json:"mean_jaccard"`
+	MeanKendallTau float64            `json:"mean_kendall_tau"`
+	MeanNewInTop10 float64            `json:"mean_new_in_top10"`
+	IdenticalTop10 float64            `json:"identical_top10"` // share of searches with the same top 10 in the same order
+	Recent         []ShadowComparison `json:"recent"`          // latest comparisons, newest first
+}
@@ -0,0 +1,22 @@
+package models
+
+// AutocompleteRequest represents autocomplete query parameters
+type AutocompleteRequest struct {
+	Query string `form:"q" binding:"required"`
+	Size  int    `form:"size" binding:"omitempty,min=1,max=20"` // total suggestions (default: 10)
+}
+
+// Suggestion types returned by autocomplete
+const (
+	SuggestionTypeQuery   = "query"   // a popular query of other shoppers
+	SuggestionTypeProduct = "product" // a product name
+)
+
+// Suggestion is one autocomplete completion
+type Suggestion struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	ProductID string `json:"product_id,omitempty"`
+	Category  string `json:"category,omitempty"`
+	Searches  int    `json:"searches,omitempty"` // successful searches of a query suggestion in the mining window
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Product change event types sent to webhooks
+const (
+	WebhookEventProductCreated = "product.created"
+	WebhookEventProductUpdated = "product.updated"
+	WebhookEventProductDeleted = "product.deleted"
+)
+
+// Webhook is an endpoint notified of product changes
+type Webhook struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url" binding:"required,url"`
+	EventTypes []string  `json:"event_types" binding:"dive,oneof=product.created product.updated product.deleted"` // empty for every type
+	Secret     string    `json:"secret,omitempty"`                                                                 // HMAC key; generated when empty and only returned on creation
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the webhook receives events of a type
+func (w Webhook) Subscribes(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, subscribed := range w.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the payload POSTed to webhooks
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Product   *Product  `json:"product"` // the product after the change; the last version for a deletion
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"   // waiting for its next attempt
+	DeliveryDelivered = "delivered" // the endpoint accepted it
+	DeliveryDead      = "dead"      // out of attempts; listed as a dead letter until replayed
+)
+
+// DeliveryAttempt is one HTTP call of a delivery
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// WebhookDelivery is an event queued for one webhook, with its attempts
+type WebhookDelivery struct {
+	ID            string            `json:"id"`
+	WebhookID     string            `json:"webhook_id"`
+	EventType     string            `json:"event_type"`
+	Event         WebhookEvent      `json:"event"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"` // attempts since the delivery was queued or last replayed
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	LastError     string            `json:"last_error,omitempty"`
+	History       []DeliveryAttempt `json:"history"` // every attempt, oldest first
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
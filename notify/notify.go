@@ -0,0 +1,122 @@
+// Package notify delivers saved search alerts to shoppers.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// webhookTimeout bounds one webhook delivery
+const webhookTimeout = 5 * time.Second
+
+// Notifier delivers an alert notification
+type Notifier interface {
+	Notify(ctx context.Context, notification models.AlertNotification) error
+}
+
+// New returns the notifier of a kind: "log", "file" (target is the path of a
+// JSON lines file) or "webhook" (target is the URL notifications are POSTed to)
+func New(kind, target string) (Notifier, error) {
+	switch kind {
+	case "log":
+		return LogNotifier{}, nil
+	case "file":
+		if target == "" {
+			return nil, fmt.Errorf("file notifier needs a path")
+		}
+		return NewFileNotifier(target), nil
+	case "webhook":
+		if target == "" {
+			return nil, fmt.Errorf("webhook notifier needs a URL")
+		}
+		return NewWebhookNotifier(target), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier: %s", kind)
+	}
+}
+
+// LogNotifier writes notifications to the log, for local testing
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, notification models.AlertNotification) error {
+	log.Printf("[ALERT] User: %s, Alert: %s (%s), Reason: %s, Product: %s (%s)",
+		notification.UserID, notification.AlertID, notification.AlertName, notification.Reason,
+		notification.Product.ID, notification.Product.Name)
+	return nil
+}
+
+// FileNotifier appends notifications to a JSON lines file, for local testing
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, notification models.AlertNotification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening notification file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing notification: %w", err)
+	}
+	return nil
+}
+
+// WebhookNotifier POSTs each notification as JSON to a URL
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification models.AlertNotification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("webhook responded %d: %s", res.StatusCode, string(body))
+	}
+	return nil
+}
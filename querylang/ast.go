@@ -0,0 +1,113 @@
+// Package querylang implements the advanced search syntax used by power users, e.g.
+//
+//	category:gaming price:<200 rating:>=4 -refurbished "wireless mouse"
+//
+// Queries are parsed into a validated AST which is translated into an
+// Elasticsearch bool query.
+package querylang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is an element of a parsed query
+type Node interface {
+	String() string
+}
+
+// AndNode matches when all children match (implicit between terms, or explicit AND)
+type AndNode struct {
+	Children []Node
+}
+
+// OrNode matches when any child matches
+type OrNode struct {
+	Children []Node
+}
+
+// NotNode matches when its child does not match (-term or NOT term)
+type NotNode struct {
+	Child Node
+}
+
+// TermNode is a free-text word matched against name and description
+type TermNode struct {
+	Text string
+	Pos  int
+}
+
+// PhraseNode is a quoted phrase matched as a phrase against name and description
+type PhraseNode struct {
+	Text string
+	Pos  int
+}
+
+// FieldNode is a field filter such as category:gaming, price:<200 or price:10..50
+type FieldNode struct {
+	Field string
+	Op    string // one of the Op* constants
+	Value string // raw value; for OpRange the lower bound
+	To    string // upper bound for OpRange
+	Pos   int
+}
+
+// Comparison operators for field filters
+const (
+	OpEq    = "="
+	OpLt    = "<"
+	OpLte   = "<="
+	OpGt    = ">"
+	OpGte   = ">="
+	OpRange = ".."
+)
+
+func (n *AndNode) String() string {
+	parts := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		parts[i] = child.String()
+	}
+	return "(" + strings.Join(parts, " AND ") + ")"
+}
+
+func (n *OrNode) String() string {
+	parts := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		parts[i] = child.String()
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+func (n *NotNode) String() string {
+	return "NOT " + n.Child.String()
+}
+
+func (n *TermNode) String() string {
+	return n.Text
+}
+
+func (n *PhraseNode) String() string {
+	return fmt.Sprintf("%q", n.Text)
+}
+
+func (n *FieldNode) String() string {
+	switch n.Op {
+	case OpEq:
+		return fmt.Sprintf("%s:%q", n.Field, n.Value)
+	case OpRange:
+		return fmt.Sprintf("%s:%s..%s", n.Field, n.Value, n.To)
+	default:
+		return fmt.Sprintf("%s:%s%s", n.Field, n.Op, n.Value)
+	}
+}
+
+// ParseError reports an invalid query together with the 1-based character
+// position where the problem was found
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+}
@@ -0,0 +1,131 @@
+package querylang
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokField
+	tokLParen
+	tokRParen
+	tokMinus
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // word or phrase text
+	field string // field name for tokField
+	value string // raw field value (operator included) for tokField
+	pos   int    // 1-based position of the first character
+}
+
+// lex splits a query into tokens
+func lex(input string) ([]token, error) {
+	runes := []rune(input)
+	var tokens []token
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, pos: pos})
+			i++
+		case r == '"':
+			text, next, err := readPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: text, pos: pos})
+			i = next
+		case r == '-':
+			if i+1 >= len(runes) || unicode.IsSpace(runes[i+1]) || runes[i+1] == ')' {
+				return nil, &ParseError{Pos: pos, Msg: "'-' must be followed by a term"}
+			}
+			tokens = append(tokens, token{kind: tokMinus, pos: pos})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !isDelimiter(runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if colon := strings.IndexRune(word, ':'); colon > 0 && isIdentifier(word[:colon]) {
+				value := word[colon+1:]
+				// Quoted value: category:"home office"
+				if i < len(runes) && runes[i] == '"' && (value == "" || isOperator(value)) {
+					text, next, err := readPhrase(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					value += text
+					i = next
+				}
+				tokens = append(tokens, token{kind: tokField, field: word[:colon], value: value, pos: pos})
+				continue
+			}
+
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokAnd, pos: pos})
+			case "OR":
+				tokens = append(tokens, token{kind: tokOr, pos: pos})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokNot, pos: pos})
+			default:
+				tokens = append(tokens, token{kind: tokWord, text: word, pos: pos})
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// readPhrase reads a double-quoted phrase starting at runes[start] and returns
+// its text and the index just after the closing quote
+func readPhrase(runes []rune, start int) (string, int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '"' {
+			return string(runes[start+1 : i]), i + 1, nil
+		}
+	}
+	return "", 0, &ParseError{Pos: start + 1, Msg: "unterminated quoted phrase"}
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+func isIdentifier(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isOperator(s string) bool {
+	switch s {
+	case OpEq, OpLt, OpLte, OpGt, OpGte:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package querylang
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxDepth limits nesting of parentheses and negations
+const maxDepth = 32
+
+type fieldKind int
+
+const (
+	kindKeyword fieldKind = iota
+	kindText
+	kindNumber
+	kindBool
+)
+
+// fields maps the names accepted in queries (including aliases) to index fields
+var fields = map[string]string{
+	"category":     "category",
+	"name":         "name",
+	"description":  "description",
+	"price":        "price",
+	"rating":       "rating",
+	"stock":        "stock",
+	"review_count": "review_count",
+	"reviews":      "review_count",
+	"sales_count":  "sales_count",
+	"sales":        "sales_count",
+	"view_count":   "view_count",
+	"views":        "view_count",
+	"ctr":          "ctr",
+	"margin":       "margin",
+	"is_promoted":  "is_promoted",
+	"promoted":     "is_promoted",
+}
+
+// fieldKinds describes how each index field can be filtered
+var fieldKinds = map[string]fieldKind{
+	"category":     kindKeyword,
+	"name":         kindText,
+	"description":  kindText,
+	"price":        kindNumber,
+	"rating":       kindNumber,
+	"stock":        kindNumber,
+	"review_count": kindNumber,
+	"sales_count":  kindNumber,
+	"view_count":   kindNumber,
+	"ctr":          kindNumber,
+	"margin":       kindNumber,
+	"is_promoted":  kindBool,
+}
+
+// Parse parses an advanced search query into a validated AST
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, &ParseError{Pos: tok.pos, Msg: "unexpected ')'"}
+		}
+		return nil, &ParseError{Pos: tok.pos, Msg: "unexpected token"}
+	}
+
+	return node, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseOr parses: and ( OR and )*
+func (p *parser) parseOr(depth int) (Node, error) {
+	first, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	children := []Node{first}
+	for p.peek().kind == tokOr {
+		p.next()
+		child, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &OrNode{Children: children}, nil
+}
+
+// parseAnd parses a sequence of unary expressions joined implicitly or by AND
+func (p *parser) parseAnd(depth int) (Node, error) {
+	var children []Node
+
+	for {
+		tok := p.peek()
+		if tok.kind == tokEOF || tok.kind == tokRParen || tok.kind == tokOr {
+			break
+		}
+		if tok.kind == tokAnd {
+			if len(children) == 0 {
+				return nil, &ParseError{Pos: tok.pos, Msg: "AND must follow a term"}
+			}
+			p.next()
+			if next := p.peek(); next.kind == tokEOF || next.kind == tokRParen || next.kind == tokOr || next.kind == tokAnd {
+				return nil, &ParseError{Pos: next.pos, Msg: "expected a term after AND"}
+			}
+			continue
+		}
+
+		child, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 0 {
+		tok := p.peek()
+		if tok.kind == tokOr {
+			return nil, &ParseError{Pos: tok.pos, Msg: "OR must be between two terms"}
+		}
+		return nil, &ParseError{Pos: tok.pos, Msg: "expected a search term"}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &AndNode{Children: children}, nil
+}
+
+// parseUnary parses an optionally negated primary expression
+func (p *parser) parseUnary(depth int) (Node, error) {
+	tok := p.peek()
+	if tok.kind == tokMinus || tok.kind == tokNot {
+		if depth >= maxDepth {
+			return nil, &ParseError{Pos: tok.pos, Msg: "query is nested too deeply"}
+		}
+		p.next()
+		if next := p.peek(); next.kind == tokEOF || next.kind == tokRParen || next.kind == tokOr || next.kind == tokAnd {
+			return nil, &ParseError{Pos: next.pos, Msg: "expected a term to negate"}
+		}
+		child, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Child: child}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+// parsePrimary parses a word, phrase, field filter or parenthesized group
+func (p *parser) parsePrimary(depth int) (Node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokLParen:
+		if depth >= maxDepth {
+			return nil, &ParseError{Pos: tok.pos, Msg: "query is nested too deeply"}
+		}
+		node, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, &ParseError{Pos: tok.pos, Msg: "missing closing ')'"}
+		}
+		p.next()
+		return node, nil
+	case tokWord:
+		return &TermNode{Text: tok.text, Pos: tok.pos}, nil
+	case tokPhrase:
+		if strings.TrimSpace(tok.text) == "" {
+			return nil, &ParseError{Pos: tok.pos, Msg: "empty quoted phrase"}
+		}
+		return &PhraseNode{Text: tok.text, Pos: tok.pos}, nil
+	case tokField:
+		return parseField(tok)
+	case tokRParen:
+		return nil, &ParseError{Pos: tok.pos, Msg: "unexpected ')'"}
+	default:
+		return nil, &ParseError{Pos: tok.pos, Msg: "expected a search term"}
+	}
+}
+
+// parseField validates a field filter token against the known fields and types
+func parseField(tok token) (Node, error) {
+	field, ok := fields[strings.ToLower(tok.field)]
+	if !ok {
+		return nil, &ParseError{Pos: tok.pos, Msg: fmt.Sprintf("unknown field %q (supported: %s)", tok.field, supportedFields())}
+	}
+	kind := fieldKinds[field]
+	valuePos := tok.pos + len([]rune(tok.field)) + 1
+
+	op, value := splitOperator(tok.value)
+	if value == "" {
+		return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("missing value for field %q", tok.field)}
+	}
+
+	node := &FieldNode{Field: field, Op: op, Value: value, Pos: tok.pos}
+
+	switch kind {
+	case kindKeyword, kindText:
+		if op != OpEq {
+			return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("field %q does not support comparison %q", tok.field, op)}
+		}
+	case kindBool:
+		if op != OpEq {
+			return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("field %q does not support comparison %q", tok.field, op)}
+		}
+		switch strings.ToLower(value) {
+		case "true", "yes", "1":
+			node.Value = "true"
+		case "false", "no", "0":
+			node.Value = "false"
+		default:
+			return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("field %q expects true or false, got %q", tok.field, value)}
+		}
+	case kindNumber:
+		if op == OpEq && strings.Contains(value, "..") {
+			return parseRange(node, tok, valuePos)
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("field %q expects a number, got %q", tok.field, value)}
+		}
+	}
+
+	return node, nil
+}
+
+// parseRange parses an inclusive numeric range such as 10..50, 10.. or ..50
+func parseRange(node *FieldNode, tok token, valuePos int) (Node, error) {
+	parts := strings.SplitN(node.Value, "..", 2)
+	from, to := parts[0], parts[1]
+
+	for _, bound := range []string{from, to} {
+		if bound == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(bound, 64); err != nil {
+			return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("field %q expects a numeric range, got %q", tok.field, node.Value)}
+		}
+	}
+
+	switch {
+	case from == "" && to == "":
+		return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("range for field %q needs at least one bound", tok.field)}
+	case from == "":
+		node.Op, node.Value = OpLte, to
+	case to == "":
+		node.Op, node.Value = OpGte, from
+	default:
+		low, _ := strconv.ParseFloat(from, 64)
+		high, _ := strconv.ParseFloat(to, 64)
+		if low > high {
+			return nil, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("range for field %q has lower bound above upper bound", tok.field)}
+		}
+		node.Op, node.Value, node.To = OpRange, from, to
+	}
+
+	return node, nil
+}
+
+// splitOperator separates a leading comparison operator from a field value
+func splitOperator(value string) (string, string) {
+	for _, op := range []string{OpLte, OpGte, OpLt, OpGt, OpEq} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
+		}
+	}
+	return OpEq, value
+}
+
+func supportedFields() string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,135 @@
+package querylang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"single term", "laptop", "laptop"},
+		{"implicit and", "gaming laptop", "(gaming AND laptop)"},
+		{"explicit and", "gaming AND laptop", "(gaming AND laptop)"},
+		{"or", "mouse OR keyboard", "(mouse OR keyboard)"},
+		{"and binds tighter than or", "a b OR c", "((a AND b) OR c)"},
+		{"or of and groups", "a OR b c OR d", "(a OR (b AND c) OR d)"},
+		{"parentheses override precedence", "a (b OR c)", "(a AND (b OR c))"},
+		{"nested parentheses", "((a OR b) c)", "((a OR b) AND c)"},
+		{"minus negation", "mouse -wired", "(mouse AND NOT wired)"},
+		{"not negation", "mouse NOT wired", "(mouse AND NOT wired)"},
+		{"negated group", "-(a OR b)", "NOT (a OR b)"},
+		{"double negation", "NOT -a", "NOT NOT a"},
+		{"lowercase keywords are terms", "a or b", "(a AND or AND b)"},
+		{"phrase", `"wireless mouse"`, `"wireless mouse"`},
+		{"phrase between terms", `cheap "wireless mouse" pro`, `(cheap AND "wireless mouse" AND pro)`},
+		{"phrase ends a word", `pro"max"`, `(pro AND "max")`},
+		{"keyword field", "category:gaming", `category:"gaming"`},
+		{"quoted field value", `category:"home office"`, `category:"home office"`},
+		{"field name is case insensitive", "Category:gaming", `category:"gaming"`},
+		{"field alias", "reviews:>=10", "review_count:>=10"},
+		{"less than", "price:<200", "price:<200"},
+		{"less or equal", "price:<=200", "price:<=200"},
+		{"greater than", "rating:>4", "rating:>4"},
+		{"greater or equal", "rating:>=4.5", "rating:>=4.5"},
+		{"explicit equals", "stock:=0", `stock:"0"`},
+		{"numeric equality", "stock:5", `stock:"5"`},
+		{"closed range", "price:10..50", "price:10..50"},
+		{"open upper range", "price:10..", "price:>=10"},
+		{"open lower range", "price:..50", "price:<=50"},
+		{"boolean field", "promoted:yes", `is_promoted:"true"`},
+		{"boolean false", "is_promoted:0", `is_promoted:"false"`},
+		{"word with leading colon", ":30", ":30"},
+		{
+			"mixed query",
+			`category:gaming price:<200 rating:>=4 -refurbished "wireless mouse"`,
+			`(category:"gaming" AND price:<200 AND rating:>=4 AND NOT refurbished AND "wireless mouse")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantPos int
+		wantMsg string
+	}{
+		{"empty query", "", 1, "expected a search term"},
+		{"unterminated phrase", `mouse "wireless`, 7, "unterminated quoted phrase"},
+		{"unterminated field phrase", `category:"home`, 10, "unterminated quoted phrase"},
+		{"empty phrase", `mouse "  "`, 7, "empty quoted phrase"},
+		{"dangling minus", "mouse -", 7, "'-' must be followed by a term"},
+		{"minus before space", "mouse - wired", 7, "'-' must be followed by a term"},
+		{"not at end", "mouse NOT", 10, "expected a term to negate"},
+		{"not before or", "NOT OR b", 5, "expected a term to negate"},
+		{"leading and", "AND mouse", 1, "AND must follow a term"},
+		{"trailing and", "mouse AND", 10, "expected a term after AND"},
+		{"double and", "a AND AND b", 7, "expected a term after AND"},
+		{"leading or", "OR mouse", 1, "OR must be between two terms"},
+		{"trailing or", "mouse OR", 9, "expected a search term"},
+		{"missing closing paren", "(a OR b", 1, "missing closing ')'"},
+		{"unexpected closing paren", "a)", 2, "unexpected ')'"},
+		{"empty group", "()", 2, "expected a search term"},
+		{"unknown field", "colour:red", 1, `unknown field "colour"`},
+		{"unknown field after term", "mouse 12:30", 7, `unknown field "12"`},
+		{"missing value", "price:", 7, `missing value for field "price"`},
+		{"number expected", "price:cheap", 7, `field "price" expects a number, got "cheap"`},
+		{"comparison on keyword", "category:>a", 10, `field "category" does not support comparison ">"`},
+		{"comparison on boolean", "promoted:<1", 10, `field "promoted" does not support comparison "<"`},
+		{"bad boolean", "promoted:maybe", 10, `field "promoted" expects true or false, got "maybe"`},
+		{"bad range bound", "price:a..5", 7, `field "price" expects a numeric range, got "a..5"`},
+		{"empty range", "price:..", 7, `range for field "price" needs at least one bound`},
+		{"inverted range", "price:50..10", 7, `range for field "price" has lower bound above upper bound`},
+		{"positions count runes", `café "x`, 6, "unterminated quoted phrase"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q) error = %v, want a *ParseError", tt.input, err)
+			}
+			if parseErr.Pos != tt.wantPos {
+				t.Errorf("Parse(%q) error position = %d, want %d (%v)", tt.input, parseErr.Pos, tt.wantPos, err)
+			}
+			if !strings.HasPrefix(parseErr.Msg, tt.wantMsg) {
+				t.Errorf("Parse(%q) error message = %q, want prefix %q", tt.input, parseErr.Msg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestParseDepthLimit(t *testing.T) {
+	input := ""
+	for i := 0; i <= maxDepth; i++ {
+		input += "("
+	}
+	input += "a"
+
+	_, err := Parse(input)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Msg != "query is nested too deeply" {
+		t.Fatalf("Parse of %d nested groups error = %v, want nesting error", maxDepth+1, err)
+	}
+	if parseErr.Pos != maxDepth+1 {
+		t.Errorf("nesting error position = %d, want %d", parseErr.Pos, maxDepth+1)
+	}
+}
@@ -0,0 +1,161 @@
+package querylang
+
+import "strconv"
+
+// CategoryResolver returns the field and value a category filter matches on,
+// such as the category path that subcategories are also indexed with
+type CategoryResolver func(category string) (field, value string)
+
+// Translate converts a parsed query into an Elasticsearch bool query. Free-text
+// terms are matched against textFields and quoted phrases against phraseFields.
+// Category filters go through resolveCategory, or match the category field
+// exactly when it is nil. Field filters are applied in filter context; a query
+// made only of filters or negations still matches with a positive score so it
+// can be re-scored.
+func Translate(node Node, textFields, phraseFields []string, resolveCategory CategoryResolver) map[string]interface{} {
+	t := translator{textFields: textFields, phraseFields: phraseFields, resolveCategory: resolveCategory}
+	if and, ok := node.(*AndNode); ok {
+		return t.and(and.Children)
+	}
+	return t.and([]Node{node})
+}
+
+type translator struct {
+	textFields      []string
+	phraseFields    []string
+	resolveCategory CategoryResolver
+	negated         bool // inside a negation, where fuzzy matching would exclude too much
+}
+
+func (t translator) translate(node Node) map[string]interface{} {
+	switch n := node.(type) {
+	case *AndNode:
+		return t.and(n.Children)
+	case *OrNode:
+		should := make([]map[string]interface{}, len(n.Children))
+		for i, child := range n.Children {
+			should[i] = t.translate(child)
+		}
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               should,
+				"minimum_should_match": 1,
+			},
+		}
+	case *NotNode:
+		return t.and([]Node{n})
+	case *TermNode:
+		multiMatch := map[string]interface{}{
+			"query":  n.Text,
+			"fields": t.textFields,
+			"type":   "best_fields",
+		}
+		if !t.negated {
+			multiMatch["fuzziness"] = "AUTO"
+		}
+		return map[string]interface{}{"multi_match": multiMatch}
+	case *PhraseNode:
+		return map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  n.Text,
+				"fields": t.phraseFields,
+				"type":   "phrase",
+			},
+		}
+	case *FieldNode:
+		return t.field(n)
+	}
+	return map[string]interface{}{"match_none": map[string]interface{}{}}
+}
+
+// and combines children into a bool query: text in must, field filters in
+// filter and negations in must_not
+func (t translator) and(children []Node) map[string]interface{} {
+	must := []map[string]interface{}{}
+	filter := []map[string]interface{}{}
+	mustNot := []map[string]interface{}{}
+
+	for _, child := range children {
+		switch n := child.(type) {
+		case *NotNode:
+			negated := t
+			negated.negated = true
+			mustNot = append(mustNot, negated.translate(n.Child))
+		case *FieldNode:
+			if fieldKinds[n.Field] == kindText {
+				must = append(must, t.field(n))
+			} else {
+				filter = append(filter, t.field(n))
+			}
+		default:
+			must = append(must, t.translate(child))
+		}
+	}
+
+	if len(must) == 0 {
+		must = append(must, map[string]interface{}{"match_all": map[string]interface{}{}})
+	}
+
+	boolQuery := map[string]interface{}{"must": must}
+	if len(filter) > 0 {
+		boolQuery["filter"] = filter
+	}
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+	return map[string]interface{}{"bool": boolQuery}
+}
+
+// field converts a validated field filter into a term, match or range query
+func (t translator) field(n *FieldNode) map[string]interface{} {
+	if n.Field == "category" && t.resolveCategory != nil {
+		field, value := t.resolveCategory(n.Value)
+		return map[string]interface{}{
+			"term": map[string]interface{}{field: value},
+		}
+	}
+
+	switch fieldKinds[n.Field] {
+	case kindText:
+		return map[string]interface{}{
+			"match": map[string]interface{}{
+				n.Field: map[string]interface{}{
+					"query":    n.Value,
+					"operator": "and",
+				},
+			},
+		}
+	case kindBool:
+		return map[string]interface{}{
+			"term": map[string]interface{}{n.Field: n.Value == "true"},
+		}
+	case kindNumber:
+		value, _ := strconv.ParseFloat(n.Value, 64)
+		switch n.Op {
+		case OpEq:
+			return map[string]interface{}{
+				"term": map[string]interface{}{n.Field: value},
+			}
+		case OpRange:
+			to, _ := strconv.ParseFloat(n.To, 64)
+			return rangeQuery(n.Field, map[string]interface{}{"gte": value, "lte": to})
+		case OpLt:
+			return rangeQuery(n.Field, map[string]interface{}{"lt": value})
+		case OpLte:
+			return rangeQuery(n.Field, map[string]interface{}{"lte": value})
+		case OpGt:
+			return rangeQuery(n.Field, map[string]interface{}{"gt": value})
+		case OpGte:
+			return rangeQuery(n.Field, map[string]interface{}{"gte": value})
+		}
+	}
+	return map[string]interface{}{
+		"term": map[string]interface{}{n.Field: n.Value},
+	}
+}
+
+func rangeQuery(field string, bounds map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{field: bounds},
+	}
+}
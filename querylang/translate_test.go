@@ -0,0 +1,134 @@
+package querylang
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var (
+	testTextFields   = []string{"name^2", "description"}
+	testPhraseFields = []string{"name"}
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"fuzzy term",
+			"laptop",
+			`{"bool":{"must":[{"multi_match":{"fields":["name^2","description"],"fuzziness":"AUTO","query":"laptop","type":"best_fields"}}]}}`,
+		},
+		{
+			"phrase",
+			`"wireless mouse"`,
+			`{"bool":{"must":[{"multi_match":{"fields":["name"],"query":"wireless mouse","type":"phrase"}}]}}`,
+		},
+		{
+			"filters only match all",
+			"category:gaming promoted:true",
+			`{"bool":{"filter":[{"term":{"category":"gaming"}},{"term":{"is_promoted":true}}],"must":[{"match_all":{}}]}}`,
+		},
+		{
+			"text field is scored",
+			`name:"pro max"`,
+			`{"bool":{"must":[{"match":{"name":{"operator":"and","query":"pro max"}}}]}}`,
+		},
+		{
+			"numeric comparisons",
+			"price:<200 rating:>=4 stock:5",
+			`{"bool":{"filter":[{"range":{"price":{"lt":200}}},{"range":{"rating":{"gte":4}}},{"term":{"stock":5}}],"must":[{"match_all":{}}]}}`,
+		},
+		{
+			"numeric range",
+			"price:10..50",
+			`{"bool":{"filter":[{"range":{"price":{"gte":10,"lte":50}}}],"must":[{"match_all":{}}]}}`,
+		},
+		{
+			"negated term is exact",
+			"mouse -wired",
+			`{"bool":{"must":[{"multi_match":{"fields":["name^2","description"],"fuzziness":"AUTO","query":"mouse","type":"best_fields"}}],` +
+				`"must_not":[{"multi_match":{"fields":["name^2","description"],"query":"wired","type":"best_fields"}}]}}`,
+		},
+		{
+			"or",
+			"category:a OR category:b",
+			`{"bool":{"must":[{"bool":{"minimum_should_match":1,"should":[{"term":{"category":"a"}},{"term":{"category":"b"}}]}}]}}`,
+		},
+		{
+			"nested group",
+			"price:<100 (mouse OR -wired)",
+			`{"bool":{"filter":[{"range":{"price":{"lt":100}}}],"must":[{"bool":{"minimum_should_match":1,"should":[` +
+				`{"multi_match":{"fields":["name^2","description"],"fuzziness":"AUTO","query":"mouse","type":"best_fields"}},` +
+				`{"bool":{"must":[{"match_all":{}}],"must_not":[{"multi_match":{"fields":["name^2","description"],"query":"wired","type":"best_fields"}}]}}]}}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			got, err := json.Marshal(Translate(node, testTextFields, testPhraseFields, nil))
+			if err != nil {
+				t.Fatalf("marshaling translated query: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Translate(%q) =\n%s\nwant\n%s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateResolvesCategory(t *testing.T) {
+	paths := map[string]string{"headphones": "electronics/audio/headphones"}
+	resolve := func(category string) (string, string) {
+		if path, ok := paths[category]; ok {
+			return "category_paths", path
+		}
+		return "category_paths", category
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"parent category",
+			"category:electronics",
+			`{"bool":{"filter":[{"term":{"category_paths":"electronics"}}],"must":[{"match_all":{}}]}}`,
+		},
+		{
+			"leaf category",
+			"category:headphones price:<100",
+			`{"bool":{"filter":[{"term":{"category_paths":"electronics/audio/headphones"}},{"range":{"price":{"lt":100}}}],"must":[{"match_all":{}}]}}`,
+		},
+		{
+			"negated and nested",
+			"-category:headphones (category:electronics OR sale)",
+			`{"bool":{"must":[{"bool":{"minimum_should_match":1,"should":[{"term":{"category_paths":"electronics"}},` +
+				`{"multi_match":{"fields":["name^2","description"],"fuzziness":"AUTO","query":"sale","type":"best_fields"}}]}}],` +
+				`"must_not":[{"term":{"category_paths":"electronics/audio/headphones"}}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.input, err)
+			}
+			got, err := json.Marshal(Translate(node, testTextFields, testPhraseFields, resolve))
+			if err != nil {
+				t.Fatalf("marshaling translated query: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Translate(%q) =\n%s\nwant\n%s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
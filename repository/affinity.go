@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// priceBandBounds are the upper bounds of the price bands used for affinity;
+// prices at or above the last bound fall into the open-ended top band
+var priceBandBounds = []float64{25, 50, 100, 250, 500, 1000}
+
+// priceBand returns the index of the band containing price
+func priceBand(price float64) int {
+	band := 0
+	for band < len(priceBandBounds) && price >= priceBandBounds[band] {
+		band++
+	}
+	return band
+}
+
+// priceBandLabel names a band by its range, e.g. "50-100" or "1000+"
+func priceBandLabel(band int) string {
+	if band >= len(priceBandBounds) {
+		return fmt.Sprintf("%g+", priceBandBounds[len(priceBandBounds)-1])
+	}
+	lower := 0.0
+	if band > 0 {
+		lower = priceBandBounds[band-1]
+	}
+	return fmt.Sprintf("%g-%g", lower, priceBandBounds[band])
+}
+
+// AffinityTracker maintains user profiles from the event stream. Each event
+// adds its type weight to the category and price band of its products, after
+// decaying the existing affinities by their age.
+type AffinityTracker struct {
+	products *ProductRepository
+	store    ProfileStore
+	halfLife time.Duration
+}
+
+func NewAffinityTracker(products *ProductRepository, store ProfileStore, halfLife time.Duration) *AffinityTracker {
+	return &AffinityTracker{
+		products: products,
+		store:    store,
+		halfLife: halfLife,
+	}
+}
+
+// HandleEvent updates the profile of the event's user; anonymous events are ignored
+func (t *AffinityTracker) HandleEvent(ctx context.Context, event *models.Event) error {
+	weight, ok := eventWeights[event.Type]
+	if !ok || event.UserID == "" {
+		return nil
+	}
+
+	products, err := t.products.GetByIDs(ctx, uniqueIDs(event.ProductIDs))
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return nil
+	}
+
+	return t.store.Update(ctx, event.UserID, func(profile *models.UserProfile) {
+		if !profile.UpdatedAt.IsZero() && t.halfLife > 0 {
+			decay := math.Pow(0.5, float64(event.Timestamp.Sub(profile.UpdatedAt))/float64(t.halfLife))
+			decay = math.Min(decay, 1)
+			for category := range profile.Categories {
+				profile.Categories[category] *= decay
+			}
+			for band := range profile.PriceBands {
+				profile.PriceBands[band] *= decay
+			}
+		}
+
+		for _, product := range products {
+			profile.Categories[product.Category] += weight
+			profile.PriceBands[priceBandLabel(priceBand(product.Price))] += weight
+		}
+	})
+}
+
+// affinityFactor boosts products matching the user's interests:
+// A = 1.0 + category_weight × category_share + price_weight × price_band_share
+// where each share is the fraction of the user's affinity in that category or band
+func affinityFactor(profile *models.UserProfile, categoryWeight, priceWeight float64) formulaFactor {
+	categories := make(map[string]interface{}, len(profile.Categories))
+	for category, share := range normalizeAffinity(profile.Categories) {
+		categories[category] = share
+	}
+
+	bandShares := normalizeAffinity(profile.PriceBands)
+	bands := make([]float64, len(priceBandBounds)+1)
+	for band := range bands {
+		bands[band] = bandShares[priceBandLabel(band)]
+	}
+
+	return formulaFactor{
+		script: `
+					// Personalization: the user's affinity for the category and price band
+					double affinityBoost = 1.0 + params.affinity_category_weight * params.affinity_categories.getOrDefault(doc['category'].value, 0.0);
+					int priceBand = 0;
+					while (priceBand < params.affinity_band_bounds.size() && doc['price'].value >= params.affinity_band_bounds.get(priceBand)) {
+						priceBand++;
+					}
+					affinityBoost += params.affinity_price_weight * params.affinity_price_bands.get(priceBand);
+	`,
+		variable: "affinityBoost",
+		params: map[string]interface{}{
+			"affinity_categories":      categories,
+			"affinity_category_weight": categoryWeight,
+			"affinity_band_bounds":     priceBandBounds,
+			"affinity_price_bands":     bands,
+			"affinity_price_weight":    priceWeight,
+		},
+	}
+}
+
+// normalizeAffinity scales affinities so they sum to 1
+func normalizeAffinity(affinities map[string]float64) map[string]float64 {
+	total := 0.0
+	for _, score := range affinities {
+		total += score
+	}
+
+	shares := make(map[string]float64, len(affinities))
+	if total <= 0 {
+		return shares
+	}
+	for key, score := range affinities {
+		shares[key] = score / total
+	}
+	return shares
+}
+
+// SetPersonalization enables per-user affinity boosts for searches with a user
+// ID, weighted by the affinity weights of the ranking profile
+func (r *ProductRepository) SetPersonalization(store ProfileStore) {
+	r.profiles = store
+}
+
+// userAffinityFactor returns the affinity factor of a user, or false when the
+// request is anonymous, the user has no profile yet, or affinity is disabled
+func (r *ProductRepository) userAffinityFactor(ctx context.Context, userID string, ranking models.RankingProfile) (formulaFactor, bool) {
+	if r.profiles == nil || userID == "" {
+		return formulaFactor{}, false
+	}
+	if ranking.AffinityCategoryWeight <= 0 && ranking.AffinityPriceWeight <= 0 {
+		return formulaFactor{}, false
+	}
+
+	profile, err := r.profiles.Get(ctx, userID)
+	if err != nil {
+		log.Printf("[SEARCH] Failed to load profile of user %s, ranking without it: %v", userID, err)
+		return formulaFactor{}, false
+	}
+	if profile == nil || len(profile.Categories) == 0 {
+		return formulaFactor{}, false
+	}
+
+	return affinityFactor(profile, ranking.AffinityCategoryWeight, ranking.AffinityPriceWeight), true
+}
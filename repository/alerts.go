@@ -0,0 +1,392 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/notify"
+	"github.com/aditya/elasticsearch-products-api/querylang"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAlertMatches caps the saved searches notified about one product change
+	maxAlertMatches = 1000
+
+	// alertQueueBatch is the most queued product changes matched per poll
+	alertQueueBatch = 100
+
+	// alertMatchTimeout bounds matching and notifying one queued change
+	alertMatchTimeout = time.Minute
+)
+
+var (
+	// ErrAlertNotFound is returned when a saved search ID does not exist
+	ErrAlertNotFound = errors.New("alert not found")
+
+	// ErrInvalidAlert is returned for a saved search that cannot be matched
+	ErrInvalidAlert = errors.New("invalid alert")
+)
+
+// AlertRepository stores saved searches as percolator queries and notifies
+// their owners when a created or updated product matches. Product changes are
+// queued and matched in the background, so notifying never slows down writes.
+type AlertRepository struct {
+	client       *elasticsearch.Client
+	indexName    string
+	queueIndex   string
+	products     *ProductRepository
+	notifier     notify.Notifier
+	pollInterval time.Duration
+}
+
+func NewAlertRepository(client *elasticsearch.Client, indexName, queueIndex string, products *ProductRepository, notifier notify.Notifier, pollInterval time.Duration) (*AlertRepository, error) {
+	if pollInterval <= 0 {
+		return nil, fmt.Errorf("alert poll interval must be positive, got %s", pollInterval)
+	}
+	return &AlertRepository{
+		client:       client,
+		indexName:    indexName,
+		queueIndex:   queueIndex,
+		products:     products,
+		notifier:     notifier,
+		pollInterval: pollInterval,
+	}, nil
+}
+
+// alertDocument is a saved search as stored in the alert index
+type alertDocument struct {
+	Query map[string]interface{} `json:"query"`
+	Alert models.SavedSearch     `json:"alert"`
+}
+
+// Create translates a saved search into its percolator query and stores it
+func (r *AlertRepository) Create(ctx context.Context, alert *models.SavedSearch) error {
+	query, err := r.products.AlertQuery(ctx, alert.Search)
+	if err != nil {
+		return err
+	}
+
+	alert.ID = uuid.New().String()
+	alert.CreatedAt = time.Now()
+
+	data, err := json.Marshal(alertDocument{Query: query, Alert: *alert})
+	if err != nil {
+		return fmt.Errorf("error marshaling alert: %w", err)
+	}
+
+	log.Printf("[ES] CREATE ALERT - Index: %s, DocumentID: %s, Body: %s", r.indexName, alert.ID, string(data))
+
+	req := esapi.IndexRequest{
+		Index:      r.indexName,
+		DocumentID: alert.ID,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing alert: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// ListByUser returns the saved searches of a user, newest first
+func (r *AlertRepository) ListByUser(ctx context.Context, userID string) ([]models.SavedSearch, error) {
+	searchBody := map[string]interface{}{
+		"size":    maxAlertMatches,
+		"_source": []string{"alert"},
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"alert.user_id": userID},
+		},
+		"sort": []map[string]interface{}{
+			{"alert.created_at": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	log.Printf("[ES] LIST ALERTS - Index: %s, UserID: %s", r.indexName, userID)
+
+	var result alertHits
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]models.SavedSearch, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		alerts = append(alerts, hit.Source.Alert)
+	}
+	return alerts, nil
+}
+
+// Delete removes a saved search
+func (r *AlertRepository) Delete(ctx context.Context, id string) error {
+	log.Printf("[ES] DELETE ALERT - Index: %s, DocumentID: %s", r.indexName, id)
+
+	req := esapi.DeleteRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error deleting alert: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return ErrAlertNotFound
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// alertHits decodes saved searches from the alert index, with the slots of
+// the percolated documents each one matched
+type alertHits struct {
+	Hits struct {
+		Hits []struct {
+			Source struct {
+				Alert models.SavedSearch `json:"alert"`
+			} `json:"_source"`
+			Fields struct {
+				Slots []int `json:"_percolator_document_slot"`
+			} `json:"fields"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// HandleProductChange queues a change for matching against saved searches.
+// Only changes shoppers can see count: a product that just went live, e.g. a
+// published draft, is new to them.
+func (r *AlertRepository) HandleProductChange(ctx context.Context, before, after *models.Product) error {
+	now := time.Now()
+	if after == nil || !after.IsLive(now) {
+		return nil
+	}
+	if before != nil && !before.IsLive(now) {
+		before = nil
+	}
+
+	change := models.AlertChange{
+		ID:        uuid.New().String(),
+		ProductID: after.ID,
+		Before:    before,
+		After:     *after,
+		QueuedAt:  now,
+	}
+
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("error marshaling alert change: %w", err)
+	}
+
+	log.Printf("[ES] QUEUE ALERT MATCH - Index: %s, DocumentID: %s, ProductID: %s", r.queueIndex, change.ID, change.ProductID)
+
+	req := esapi.IndexRequest{
+		Index:      r.queueIndex,
+		DocumentID: change.ID,
+		Body:       bytes.NewReader(data),
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error queueing alert change: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// Run matches the queued product changes every poll interval until the
+// process exits
+func (r *AlertRepository) Run() {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.matchQueued()
+	}
+}
+
+// matchQueued matches one batch of queued changes, oldest first. A change
+// leaves the queue once matched; one that fails stays for the next poll.
+func (r *AlertRepository) matchQueued() {
+	searchBody := map[string]interface{}{
+		"size": alertQueueBatch,
+		"sort": []map[string]interface{}{
+			{"queued_at": map[string]interface{}{"order": "asc"}},
+		},
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.AlertChange `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(context.Background(), r.client, r.queueIndex, searchBody, &result); err != nil {
+		log.Printf("[ALERT] Failed to load queued changes: %v", err)
+		return
+	}
+
+	for _, hit := range result.Hits.Hits {
+		change := hit.Source
+		ctx, cancel := context.WithTimeout(context.Background(), alertMatchTimeout)
+		if err := r.match(ctx, change.Before, &change.After); err != nil {
+			log.Printf("[ALERT] Failed to match product %s against alerts: %v", change.ProductID, err)
+		} else if err := r.dequeue(ctx, change.ID); err != nil {
+			log.Printf("[ALERT] Failed to remove queued change %s: %v", change.ID, err)
+		}
+		cancel()
+	}
+}
+
+// dequeue removes a matched change from the queue
+func (r *AlertRepository) dequeue(ctx context.Context, id string) error {
+	req := esapi.DeleteRequest{
+		Index:      r.queueIndex,
+		DocumentID: id,
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error deleting queued change: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// match notifies the owners of saved searches matching a new product, a
+// restocked product, or a product that only matches after the update
+func (r *AlertRepository) match(ctx context.Context, before, after *models.Product) error {
+	// Slot 0 is the product as stored now, slot 1 the previous version.
+	// Documents carry the indexed fields, such as the base currency price.
+	products := []*models.Product{after}
+	if before != nil {
+		products = append(products, before)
+	}
+	documents := make([]*productDocument, 0, len(products))
+	for _, product := range products {
+		doc, err := r.products.document(ctx, product)
+		if err != nil {
+			return fmt.Errorf("error preparing product %s for alerts: %w", product.ID, err)
+		}
+		documents = append(documents, doc)
+	}
+
+	searchBody := map[string]interface{}{
+		"size":    maxAlertMatches,
+		"_source": []string{"alert"},
+		"query": map[string]interface{}{
+			"percolate": map[string]interface{}{
+				"field":     "query",
+				"documents": documents,
+			},
+		},
+	}
+
+	log.Printf("[ES] PERCOLATE - Index: %s, ProductID: %s", r.indexName, after.ID)
+
+	var result alertHits
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return fmt.Errorf("error matching alerts: %w", err)
+	}
+
+	for _, hit := range result.Hits.Hits {
+		matchesAfter, matchesBefore := false, false
+		for _, slot := range hit.Fields.Slots {
+			matchesAfter = matchesAfter || slot == 0
+			matchesBefore = matchesBefore || slot == 1
+		}
+		if !matchesAfter {
+			continue
+		}
+
+		var reason string
+		switch {
+		case before == nil:
+			reason = models.AlertReasonNewProduct
+		case before.Stock == 0 && after.Stock > 0:
+			reason = models.AlertReasonRestocked
+		case !matchesBefore:
+			reason = models.AlertReasonNowMatching
+		default:
+			continue
+		}
+
+		alert := hit.Source.Alert
+		notification := models.AlertNotification{
+			AlertID:   alert.ID,
+			AlertName: alert.Name,
+			UserID:    alert.UserID,
+			Reason:    reason,
+			Product:   *after,
+			Timestamp: time.Now(),
+		}
+		if err := r.notifier.Notify(ctx, notification); err != nil {
+			log.Printf("[ALERT] Failed to notify user %s of alert %s: %v", alert.UserID, alert.ID, err)
+		}
+	}
+	return nil
+}
+
+// AlertQuery translates a saved search into the query that matches its
+// products, interpreted the same way as a search. Price ranges are in the
+// saved search currency. Ranking parameters are ignored since only matching
+// matters.
+func (r *ProductRepository) AlertQuery(ctx context.Context, searchReq models.ProductSearchRequest) (map[string]interface{}, error) {
+	if strings.TrimSpace(searchReq.Query) == "" && searchReq.Category == "" && searchReq.MinPrice <= 0 && searchReq.MaxPrice <= 0 {
+		return nil, fmt.Errorf("%w: a query, category or price range is required", ErrInvalidAlert)
+	}
+
+	conversion, err := r.currencyConversion(ctx, searchReq.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := searchOptions{currency: conversion, taxonomy: r.activeTaxonomy(ctx)}
+	if searchReq.Syntax == models.SyntaxAdvanced {
+		if strings.TrimSpace(searchReq.Query) != "" {
+			node, err := querylang.Parse(searchReq.Query)
+			if err != nil {
+				return nil, err
+			}
+			opts.advancedQuery = querylang.Translate(node, textSearchFields, phraseSearchFields, opts.categoryResolver())
+		}
+	} else {
+		r.understandQuery(ctx, &searchReq, &opts)
+		opts.boostCategory = ""
+	}
+
+	return buildSearchQuery(&searchReq, opts), nil
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// auditWriteAttempts bounds the retries when two writes race for a version number
+const auditWriteAttempts = 3
+
+// AnonymousActor is recorded for changes made without an actor
+const AnonymousActor = "anonymous"
+
+// ErrVersionNotFound is returned when a product has no such version
+var ErrVersionNotFound = errors.New("version not found")
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	revertKey
+)
+
+// WithActor records who makes the product changes done with ctx
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// actorFrom returns the actor set by WithActor
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// ProductHistory records every product change as a version. Unlike a
+// listener, it is part of the change: a failed write fails the request.
+type ProductHistory interface {
+	RecordChange(ctx context.Context, before, after *models.Product) error
+	RecordPurge(ctx context.Context, product *models.Product) error
+}
+
+// SetHistory enables the version history of products
+func (r *ProductRepository) SetHistory(history ProductHistory) {
+	r.history = history
+}
+
+// recordChange writes a stored product change to the history, then notifies
+// the listeners. A history failure is returned after the listeners ran, since
+// the change itself is stored.
+func (r *ProductRepository) recordChange(ctx context.Context, before, after *models.Product) error {
+	var err error
+	if r.history != nil {
+		if historyErr := r.history.RecordChange(ctx, before, after); historyErr != nil {
+			err = fmt.Errorf("product changed but its version was not recorded: %w", historyErr)
+		}
+	}
+	r.notifyListeners(ctx, before, after)
+	return err
+}
+
+// recordPurge writes the permanent deletion of a product already in the trash
+// to the history. Listeners saw the product deleted when it was trashed.
+func (r *ProductRepository) recordPurge(ctx context.Context, product *models.Product) error {
+	if r.history == nil {
+		return nil
+	}
+	if err := r.history.RecordPurge(ctx, product); err != nil {
+		return fmt.Errorf("product purged but its version was not recorded: %w", err)
+	}
+	return nil
+}
+
+// AuditRepository keeps the version history of every product. Each create,
+// update, delete or purge is stored as the next version, with the actor, the
+// field diff and a snapshot that a revert restores.
+type AuditRepository struct {
+	client    *elasticsearch.Client
+	indexName string
+	products  *ProductRepository
+}
+
+func NewAuditRepository(client *elasticsearch.Client, indexName string, products *ProductRepository) *AuditRepository {
+	return &AuditRepository{
+		client:    client,
+		indexName: indexName,
+		products:  products,
+	}
+}
+
+// RecordChange records a product change as its next version
+func (r *AuditRepository) RecordChange(ctx context.Context, before, after *models.Product) error {
+	record := models.AuditRecord{
+		Actor:     actorFrom(ctx),
+		Timestamp: time.Now(),
+	}
+	switch {
+	case before == nil:
+		record.Action, record.Snapshot = models.ChangeCreated, after
+	case after == nil:
+		record.Action, record.Snapshot = models.ChangeDeleted, before
+	default:
+		record.Action, record.Snapshot = models.ChangeUpdated, after
+	}
+	record.ProductID = record.Snapshot.ID
+	if version, ok := ctx.Value(revertKey).(int); ok {
+		record.RevertedFrom = version
+	}
+
+	changes, err := models.ProductDiff(before, after)
+	if err != nil {
+		return fmt.Errorf("error diffing product: %w", err)
+	}
+	record.Changes = changes
+
+	return r.record(ctx, &record)
+}
+
+// RecordPurge records the permanent deletion of a trashed product as its
+// last version
+func (r *AuditRepository) RecordPurge(ctx context.Context, product *models.Product) error {
+	return r.record(ctx, &models.AuditRecord{
+		ProductID: product.ID,
+		Action:    models.AuditActionPurged,
+		Actor:     actorFrom(ctx),
+		Snapshot:  product,
+		Timestamp: time.Now(),
+	})
+}
+
+// record stores a change as the next version of its product. Versions are
+// numbered from the latest stored one; creating the document fails when a
+// concurrent write took the number, and the next is tried.
+func (r *AuditRepository) record(ctx context.Context, record *models.AuditRecord) error {
+	for attempt := 0; attempt < auditWriteAttempts; attempt++ {
+		latest, err := r.latestVersion(ctx, record.ProductID)
+		if err != nil {
+			return err
+		}
+		record.Version = latest + 1
+
+		err = r.create(ctx, record)
+		if !errors.Is(err, errVersionConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("error recording version of product %s: %w", record.ProductID, errVersionConflict)
+}
+
+// errVersionConflict is returned by create when the version is already stored
+var errVersionConflict = errors.New("version already recorded")
+
+// create stores a version; it is searchable once create returns
+func (r *AuditRepository) create(ctx context.Context, record *models.AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit record: %w", err)
+	}
+
+	documentID := fmt.Sprintf("%s:%d", record.ProductID, record.Version)
+	log.Printf("[ES] AUDIT - Index: %s, DocumentID: %s, Action: %s, Actor: %s", r.indexName, documentID, record.Action, record.Actor)
+
+	req := esapi.CreateRequest{
+		Index:      r.indexName,
+		DocumentID: documentID,
+		Body:       bytes.NewReader(data),
+		Refresh:    "wait_for",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing audit record: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 409 {
+			return errVersionConflict
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// latestVersion returns the latest recorded version of a product, 0 for none
+func (r *AuditRepository) latestVersion(ctx context.Context, productID string) (int, error) {
+	searchBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"product_id": productID},
+		},
+		"aggs": map[string]interface{}{
+			"latest": map[string]interface{}{
+				"max": map[string]interface{}{"field": "version"},
+			},
+		},
+	}
+
+	var result struct {
+		Aggregations struct {
+			Latest struct {
+				Value *float64 `json:"value"`
+			} `json:"latest"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return 0, fmt.Errorf("error loading latest version: %w", err)
+	}
+
+	if result.Aggregations.Latest.Value == nil {
+		return 0, nil
+	}
+	return int(*result.Aggregations.Latest.Value), nil
+}
+
+// History returns the versions of a product, newest first. Deleted products
+// keep their history.
+func (r *AuditRepository) History(ctx context.Context, productID string, size int) ([]models.AuditRecord, error) {
+	searchBody := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"product_id": productID},
+		},
+		"sort": []map[string]interface{}{
+			{"version": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	log.Printf("[ES] HISTORY - Index: %s, ProductID: %s", r.indexName, productID)
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.AuditRecord `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	records := make([]models.AuditRecord, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		records = append(records, hit.Source)
+	}
+	return records, nil
+}
+
+// Revert restores a product to the snapshot of one of its versions,
+// recreating it if it was deleted. The revert is recorded as a new version.
+func (r *AuditRepository) Revert(ctx context.Context, productID string, version int) (*models.Product, error) {
+	req := esapi.GetRequest{
+		Index:      r.indexName,
+		DocumentID: fmt.Sprintf("%s:%d", productID, version),
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return nil, fmt.Errorf("error getting version: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return nil, ErrVersionNotFound
+		}
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Source models.AuditRecord `json:"_source"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	product := result.Source.Snapshot
+	log.Printf("[AUDIT] Reverting product %s to version %d", productID, version)
+	if err := r.products.SaveVersion(context.WithValue(ctx, revertKey, version), product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
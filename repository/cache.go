@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cacheRetryDelay is how long a failed refresh is remembered before the next
+// caller loads again, so a failing cluster is not queried by every search
+const cacheRetryDelay = 10 * time.Second
+
+// refreshCache holds a value loaded from Elasticsearch for a TTL. The lock is
+// never held across a load: one caller refreshes while the others keep using
+// the stale value, or wait for the load when there is none.
+type refreshCache[T any] struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	value      T
+	loaded     bool
+	loadedAt   time.Time
+	err        error // error of the last load, served until failedAt+cacheRetryDelay
+	failedAt   time.Time
+	generation int           // bumped by invalidate, so a load racing a write is not cached
+	refreshing chan struct{} // closed when the running load ends; nil when none runs
+}
+
+func newRefreshCache[T any](ttl time.Duration) *refreshCache[T] {
+	return &refreshCache[T]{ttl: ttl}
+}
+
+// get returns the cached value, calling load when it is stale or missing.
+// After a failed load the stale value is served, or the error returned when
+// there is none, until cacheRetryDelay has passed.
+func (c *refreshCache[T]) get(ctx context.Context, load func(ctx context.Context) (T, error)) (T, error) {
+	for {
+		c.mu.Lock()
+		backingOff := c.err != nil && time.Since(c.failedAt) < cacheRetryDelay
+		if c.loaded && (c.refreshing != nil || backingOff || time.Since(c.loadedAt) <= c.ttl) {
+			value := c.value
+			c.mu.Unlock()
+			return value, nil
+		}
+		if wait := c.refreshing; wait != nil {
+			c.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				var zero T
+				return zero, ctx.Err()
+			}
+		}
+		if backingOff {
+			err := c.err
+			c.mu.Unlock()
+			var zero T
+			return zero, err
+		}
+		done := make(chan struct{})
+		c.refreshing = done
+		generation := c.generation
+		c.mu.Unlock()
+
+		value, err := load(ctx)
+
+		c.mu.Lock()
+		c.refreshing = nil
+		close(done)
+		if generation == c.generation {
+			if err != nil {
+				c.err, c.failedAt = err, time.Now()
+			} else {
+				c.value, c.loaded, c.loadedAt, c.err = value, true, time.Now(), nil
+			}
+		}
+		c.mu.Unlock()
+		return value, err
+	}
+}
+
+// invalidate drops the cached value after a write, so the next get loads again
+func (c *refreshCache[T]) invalidate() {
+	c.mu.Lock()
+	var zero T
+	c.value, c.loaded, c.err = zero, false, nil
+	c.generation++
+	c.mu.Unlock()
+}
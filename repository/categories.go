@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// maxCategories caps the categories loaded into the taxonomy
+	maxCategories = 5000
+
+	// taxonomyTTL is how long the taxonomy is cached. Writes through the
+	// repository clear the cache.
+	taxonomyTTL = time.Minute
+)
+
+var (
+	// ErrCategoryNotFound is returned when a category ID does not exist
+	ErrCategoryNotFound = errors.New("category not found")
+
+	// ErrCategoryExists is returned when creating a category with a used ID
+	ErrCategoryExists = errors.New("category already exists")
+
+	// ErrInvalidCategory is returned for a category change that would break
+	// the tree, e.g. an unknown parent or a cycle
+	ErrInvalidCategory = errors.New("invalid category")
+)
+
+// CategoryRepository stores the category taxonomy, one document per category
+// keyed by its ID. Products reference categories by ID and are indexed with
+// the path of their category.
+type CategoryRepository struct {
+	client    *elasticsearch.Client
+	indexName string
+
+	// cached taxonomy
+	taxonomy *refreshCache[models.Taxonomy]
+}
+
+func NewCategoryRepository(client *elasticsearch.Client, indexName string) *CategoryRepository {
+	return &CategoryRepository{
+		client:    client,
+		indexName: indexName,
+		taxonomy:  newRefreshCache[models.Taxonomy](taxonomyTTL),
+	}
+}
+
+// validateCategory checks that a category fits in the tree: its parent exists
+// and is not the category itself or one of its descendants
+func validateCategory(taxonomy models.Taxonomy, category *models.Category) error {
+	if category.ID == "" || strings.Contains(category.ID, models.CategoryPathSeparator) {
+		return fmt.Errorf("%w: id must be non-empty and cannot contain %q", ErrInvalidCategory, models.CategoryPathSeparator)
+	}
+	if category.ParentID == "" {
+		return nil
+	}
+	if _, ok := taxonomy[category.ParentID]; !ok {
+		return fmt.Errorf("%w: unknown parent %s", ErrInvalidCategory, category.ParentID)
+	}
+	for _, ancestor := range taxonomy.Ancestry(category.ParentID) {
+		if ancestor.ID == category.ID {
+			return fmt.Errorf("%w: %s cannot be moved below itself", ErrInvalidCategory, category.ID)
+		}
+	}
+	return nil
+}
+
+// Create adds a category to the taxonomy
+func (r *CategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	taxonomy, err := r.Taxonomy(ctx)
+	if err != nil {
+		return err
+	}
+	if err := validateCategory(taxonomy, category); err != nil {
+		return err
+	}
+
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+
+	data, err := json.Marshal(category)
+	if err != nil {
+		return fmt.Errorf("error marshaling category: %w", err)
+	}
+
+	log.Printf("[ES] CREATE CATEGORY - Index: %s, DocumentID: %s, Parent: %s", r.indexName, category.ID, category.ParentID)
+
+	req := esapi.CreateRequest{
+		Index:      r.indexName,
+		DocumentID: category.ID,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing category: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 409 {
+			return fmt.Errorf("%w: %s", ErrCategoryExists, category.ID)
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// Update renames or moves a category, keeping its ID and creation time
+func (r *CategoryRepository) Update(ctx context.Context, id string, category *models.Category) error {
+	taxonomy, err := r.Taxonomy(ctx)
+	if err != nil {
+		return err
+	}
+	existing, ok := taxonomy[id]
+	if !ok {
+		return ErrCategoryNotFound
+	}
+
+	category.ID = id
+	if err := validateCategory(taxonomy, category); err != nil {
+		return err
+	}
+	category.CreatedAt = existing.CreatedAt
+	category.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(category)
+	if err != nil {
+		return fmt.Errorf("error marshaling category: %w", err)
+	}
+
+	log.Printf("[ES] UPDATE CATEGORY - Index: %s, DocumentID: %s, Parent: %s", r.indexName, id, category.ParentID)
+
+	req := esapi.IndexRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error updating category: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// Delete removes a category without subcategories. Its products keep their
+// category, which becomes a top-level path.
+func (r *CategoryRepository) Delete(ctx context.Context, id string) error {
+	taxonomy, err := r.Taxonomy(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := taxonomy[id]; !ok {
+		return ErrCategoryNotFound
+	}
+	if children := taxonomy.Children(id); len(children) > 0 {
+		return fmt.Errorf("%w: %s has %d subcategories", ErrInvalidCategory, id, len(children))
+	}
+
+	log.Printf("[ES] DELETE CATEGORY - Index: %s, DocumentID: %s", r.indexName, id)
+
+	req := esapi.DeleteRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error deleting category: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return ErrCategoryNotFound
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// Taxonomy returns the category tree, cached for a short time
+func (r *CategoryRepository) Taxonomy(ctx context.Context) (models.Taxonomy, error) {
+	return r.taxonomy.get(ctx, r.loadTaxonomy)
+}
+
+// loadTaxonomy reads every category document into the tree
+func (r *CategoryRepository) loadTaxonomy(ctx context.Context) (models.Taxonomy, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.Category `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, map[string]interface{}{"size": maxCategories}, &result); err != nil {
+		return nil, fmt.Errorf("error loading categories: %w", err)
+	}
+
+	taxonomy := make(models.Taxonomy, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		taxonomy[hit.Source.ID] = hit.Source
+	}
+
+	return taxonomy, nil
+}
+
+// invalidate clears the cached taxonomy after a write
+func (r *CategoryRepository) invalidate() {
+	r.taxonomy.invalidate()
+}
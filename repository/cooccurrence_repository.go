@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// maxOrderProducts caps the products per order used for co-occurrence, since
+// pairs grow quadratically with order size
+const maxOrderProducts = 50
+
+// CoOccurrenceRepository maintains how often products are bought together
+type CoOccurrenceRepository struct {
+	client    *elasticsearch.Client
+	indexName string
+}
+
+func NewCoOccurrenceRepository(client *elasticsearch.Client, indexName string) *CoOccurrenceRepository {
+	return &CoOccurrenceRepository{
+		client:    client,
+		indexName: indexName,
+	}
+}
+
+// HandleEvent increments the pair counts for every two distinct products of a purchase
+func (r *CoOccurrenceRepository) HandleEvent(ctx context.Context, event *models.Event) error {
+	if event.Type != models.EventTypePurchase {
+		return nil
+	}
+
+	productIDs := uniqueIDs(event.ProductIDs)
+	if len(productIDs) > maxOrderProducts {
+		productIDs = productIDs[:maxOrderProducts]
+	}
+	if len(productIDs) < 2 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, productID := range productIDs {
+		for _, relatedID := range productIDs {
+			if productID == relatedID {
+				continue
+			}
+			action := map[string]interface{}{
+				"update": map[string]interface{}{
+					"_index":            r.indexName,
+					"_id":               productID + ":" + relatedID,
+					"retry_on_conflict": 3,
+				},
+			}
+			update := map[string]interface{}{
+				"script": map[string]interface{}{
+					"source": "ctx._source.count += 1; ctx._source.last_purchased_at = params.timestamp",
+					"params": map[string]interface{}{"timestamp": event.Timestamp},
+				},
+				"upsert": map[string]interface{}{
+					"product_id":        productID,
+					"related_id":        relatedID,
+					"count":             1,
+					"last_purchased_at": event.Timestamp,
+				},
+			}
+			if err := encoder.Encode(action); err != nil {
+				return fmt.Errorf("error encoding bulk action: %w", err)
+			}
+			if err := encoder.Encode(update); err != nil {
+				return fmt.Errorf("error encoding bulk update: %w", err)
+			}
+		}
+	}
+
+	log.Printf("[ES] CO-OCCURRENCE UPDATE - Index: %s, Order: %s, Products: %d", r.indexName, event.OrderID, len(productIDs))
+
+	res, err := r.client.Bulk(
+		&body,
+		r.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating co-occurrence: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk co-occurrence update had failures: %s", string(resBody))
+	}
+
+	return nil
+}
+
+// TopRelated returns the products most often bought together with productID
+func (r *CoOccurrenceRepository) TopRelated(ctx context.Context, productID string, limit int) ([]models.CoPurchase, error) {
+	searchBody := map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"product_id": productID},
+		},
+		"size": limit,
+		"sort": []map[string]interface{}{
+			{"count": map[string]interface{}{"order": "desc"}},
+			{"last_purchased_at": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
+		return nil, fmt.Errorf("error encoding search query: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.indexName),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error executing search: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					RelatedID string `json:"related_id"`
+					Count     int    `json:"count"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	related := make([]models.CoPurchase, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		related = append(related, models.CoPurchase{
+			ProductID: hit.Source.RelatedID,
+			Count:     hit.Source.Count,
+		})
+	}
+	return related, nil
+}
+
+// uniqueIDs removes duplicates while keeping the original order
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// maxCurrencies caps the currencies loaded from the rates table
+	maxCurrencies = 500
+
+	// currencyRatesTTL is how long the rates table is cached. Rate updates
+	// through the repository clear the cache.
+	currencyRatesTTL = time.Minute
+)
+
+var (
+	// ErrUnknownCurrency is returned for a currency missing from the rates table
+	ErrUnknownCurrency = errors.New("unknown currency")
+
+	// ErrInvalidCurrency is returned for a rate update that cannot be applied
+	ErrInvalidCurrency = errors.New("invalid currency")
+)
+
+// CurrencyRepository stores the exchange rates table, one document per
+// currency. The base currency is fixed by configuration and always has rate 1.
+type CurrencyRepository struct {
+	client    *elasticsearch.Client
+	indexName string
+	base      string
+
+	// cached rates table
+	rates *refreshCache[models.CurrencyRates]
+}
+
+func NewCurrencyRepository(client *elasticsearch.Client, indexName, base string) *CurrencyRepository {
+	return &CurrencyRepository{
+		client:    client,
+		indexName: indexName,
+		base:      strings.ToUpper(base),
+		rates:     newRefreshCache[models.CurrencyRates](currencyRatesTTL),
+	}
+}
+
+// ParseRates parses "CODE:rate" entries such as "IDR:16000" into currencies
+func ParseRates(entries []string) ([]models.Currency, error) {
+	currencies := make([]models.Currency, 0, len(entries))
+	for _, entry := range entries {
+		code, value, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("rate %q must be CODE:rate", entry)
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("rate %q must be a positive number", entry)
+		}
+		code = strings.ToUpper(strings.TrimSpace(code))
+		currencies = append(currencies, models.Currency{Code: code, Rate: rate, Decimals: models.DefaultDecimals(code)})
+	}
+	return currencies, nil
+}
+
+// Seed adds the given currencies to the rates table unless they are already in
+// it, so rates updated through the API are kept across restarts
+func (r *CurrencyRepository) Seed(ctx context.Context, currencies []models.Currency) error {
+	for _, currency := range currencies {
+		if err := validateCurrency(currency, r.base); err != nil {
+			return err
+		}
+		currency.UpdatedAt = time.Now()
+
+		data, err := json.Marshal(currency)
+		if err != nil {
+			return fmt.Errorf("error marshaling currency: %w", err)
+		}
+
+		req := esapi.CreateRequest{
+			Index:      r.indexName,
+			DocumentID: currency.Code,
+			Body:       bytes.NewReader(data),
+			Refresh:    "true",
+		}
+
+		res, err := req.Do(ctx, r.client)
+		if err != nil {
+			return fmt.Errorf("error seeding currency: %w", err)
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.IsError() && res.StatusCode != 409 {
+			return fmt.Errorf("error response: %s", string(resBody))
+		}
+		if !res.IsError() {
+			log.Printf("[CURRENCY] Seeded %s at rate %g", currency.Code, currency.Rate)
+		}
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// validateCurrency checks a rates table entry
+func validateCurrency(currency models.Currency, base string) error {
+	if len(currency.Code) != 3 {
+		return fmt.Errorf("%w: code must have 3 letters", ErrInvalidCurrency)
+	}
+	if currency.Code == base {
+		return fmt.Errorf("%w: %s is the base currency with a fixed rate of 1", ErrInvalidCurrency, base)
+	}
+	if currency.Rate <= 0 {
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidCurrency)
+	}
+	if currency.Decimals < 0 || currency.Decimals > 4 {
+		return fmt.Errorf("%w: decimals must be between 0 and 4", ErrInvalidCurrency)
+	}
+	return nil
+}
+
+// SetRate adds or updates a currency of the rates table
+func (r *CurrencyRepository) SetRate(ctx context.Context, currency *models.Currency) error {
+	currency.Code = strings.ToUpper(currency.Code)
+	if err := validateCurrency(*currency, r.base); err != nil {
+		return err
+	}
+	currency.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(currency)
+	if err != nil {
+		return fmt.Errorf("error marshaling currency: %w", err)
+	}
+
+	log.Printf("[ES] SET RATE - Index: %s, Currency: %s, Rate: %g", r.indexName, currency.Code, currency.Rate)
+
+	req := esapi.IndexRequest{
+		Index:      r.indexName,
+		DocumentID: currency.Code,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing currency: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// List returns the rates table sorted by code, including the base currency
+func (r *CurrencyRepository) List(ctx context.Context) ([]models.Currency, error) {
+	rates, err := r.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := make([]models.Currency, 0, len(rates.Currencies))
+	for _, currency := range rates.Currencies {
+		currencies = append(currencies, currency)
+	}
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i].Code < currencies[j].Code
+	})
+	return currencies, nil
+}
+
+// Rates returns the rates table, cached for a short time
+func (r *CurrencyRepository) Rates(ctx context.Context) (models.CurrencyRates, error) {
+	return r.rates.get(ctx, r.loadRates)
+}
+
+// loadRates reads the rates table, adding the base currency
+func (r *CurrencyRepository) loadRates(ctx context.Context) (models.CurrencyRates, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.Currency `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, map[string]interface{}{"size": maxCurrencies}, &result); err != nil {
+		return models.CurrencyRates{}, fmt.Errorf("error loading currency rates: %w", err)
+	}
+
+	rates := models.CurrencyRates{
+		Base: r.base,
+		Currencies: map[string]models.Currency{
+			r.base: {Code: r.base, Rate: 1, Decimals: models.DefaultDecimals(r.base)},
+		},
+	}
+	for _, hit := range result.Hits.Hits {
+		if hit.Source.Code != r.base {
+			rates.Currencies[hit.Source.Code] = hit.Source
+		}
+	}
+
+	return rates, nil
+}
+
+// invalidate clears the cached rates table after a write
+func (r *CurrencyRepository) invalidate() {
+	r.rates.invalidate()
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+const (
+	// diversityWindow is the number of top-ranked candidates that are re-ordered.
+	// Results beyond the window keep their original ranking, so every page is
+	// cut from the same ordering regardless of which page is requested.
+	diversityWindow = 100
+
+	// defaultMaxPerCategory is the per-category cap used when the request does not set one
+	defaultMaxPerCategory = 3
+)
+
+// searchDiversified runs a search and re-orders the top candidates so that no
+// category holds more than maxPerCategory slots in each round of results
+func (r *ProductRepository) searchDiversified(ctx context.Context, scoringQuery map[string]interface{}, from, size, maxPerCategory int) ([]models.Product, int, error) {
+	if maxPerCategory < 1 {
+		maxPerCategory = defaultMaxPerCategory
+	}
+
+	// Page lies entirely beyond the window: ranking is untouched there
+	if from >= diversityWindow {
+		return r.scoredSearch(ctx, scoringQuery, from, size)
+	}
+
+	candidates, total, err := r.scoredSearch(ctx, scoringQuery, 0, diversityWindow)
+	if err != nil {
+		return nil, 0, err
+	}
+	ranked := diversifyByCategory(candidates, maxPerCategory)
+
+	end := from + size
+	if end <= len(ranked) || len(candidates) < diversityWindow {
+		if from >= len(ranked) {
+			return []models.Product{}, total, nil
+		}
+		if end > len(ranked) {
+			end = len(ranked)
+		}
+		return ranked[from:end], total, nil
+	}
+
+	// Page straddles the window boundary: fill the remainder from the regular ranking
+	products := append([]models.Product{}, ranked[from:]...)
+	rest, _, err := r.scoredSearch(ctx, scoringQuery, diversityWindow, end-diversityWindow)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(products, rest...), total, nil
+}
+
+// diversifyByCategory re-orders products in rounds. Each round takes, in score
+// order, at most maxPerCategory of the remaining products from every category,
+// so a single dominant category cannot fill the top of the list.
+func diversifyByCategory(products []models.Product, maxPerCategory int) []models.Product {
+	ranked := make([]models.Product, 0, len(products))
+	remaining := products
+
+	for len(remaining) > 0 {
+		counts := make(map[string]int)
+		var deferred []models.Product
+
+		for _, product := range remaining {
+			if counts[product.Category] < maxPerCategory {
+				counts[product.Category]++
+				ranked = append(ranked, product)
+			} else {
+				deferred = append(deferred, product)
+			}
+		}
+
+		remaining = deferred
+	}
+
+	return ranked
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/google/uuid"
+)
+
+// EventListener is notified of every recorded event, e.g. to maintain
+// statistics derived from the event stream
+type EventListener interface {
+	HandleEvent(ctx context.Context, event *models.Event) error
+}
+
+// eventWeights is how strongly each event type signals interest in a product,
+// shared by the statistics derived from events
+var eventWeights = map[string]float64{
+	models.EventTypeView:      1,
+	models.EventTypeClick:     2,
+	models.EventTypeAddToCart: 4,
+	models.EventTypePurchase:  8,
+}
+
+type EventRepository struct {
+	client    *elasticsearch.Client
+	indexName string
+	listeners []EventListener
+}
+
+func NewEventRepository(client *elasticsearch.Client, indexName string, listeners ...EventListener) *EventRepository {
+	return &EventRepository{
+		client:    client,
+		indexName: indexName,
+		listeners: listeners,
+	}
+}
+
+// Record stores an event and passes it to the registered listeners. Listener
+// failures are logged and do not fail the request, since the event is stored.
+func (r *EventRepository) Record(ctx context.Context, event *models.Event) error {
+	event.ID = uuid.New().String()
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	log.Printf("[ES] EVENT - Index: %s, DocumentID: %s, Body: %s", r.indexName, event.ID, string(data))
+
+	req := esapi.IndexRequest{
+		Index:      r.indexName,
+		DocumentID: event.ID,
+		Body:       bytes.NewReader(data),
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing event: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	for _, listener := range r.listeners {
+		if err := listener.HandleEvent(ctx, event); err != nil {
+			log.Printf("[EVENT] Listener failed for event %s: %v", event.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// shopperScript identifies the shopper of an event the same way experiments
+// bucket them: the user ID when present, otherwise the session ID
+const shopperScript = "doc['user_id'].size() > 0 && doc['user_id'].value != '' ? doc['user_id'].value : doc['session_id'].value"
+
+// identifiedShopper matches events with a non-empty user or session ID
+func identifiedShopper() map[string]interface{} {
+	nonEmpty := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter":   map[string]interface{}{"exists": map[string]interface{}{"field": field}},
+				"must_not": map[string]interface{}{"term": map[string]interface{}{field: ""}},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               []map[string]interface{}{nonEmpty("user_id"), nonEmpty("session_id")},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// VariantStats aggregates the events of an experiment by variant
+func (r *EventRepository) VariantStats(ctx context.Context, experiment string) (map[string]models.VariantReport, error) {
+	// Anonymous events without a session are not a shopper
+	shoppers := map[string]interface{}{
+		"filter": identifiedShopper(),
+		"aggs": map[string]interface{}{
+			"count": map[string]interface{}{
+				"cardinality": map[string]interface{}{
+					"script": map[string]interface{}{"source": shopperScript},
+				},
+			},
+		},
+	}
+
+	searchBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"experiment": experiment},
+		},
+		"aggs": map[string]interface{}{
+			"variants": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "variant", "size": 100},
+				"aggs": map[string]interface{}{
+					"shoppers": shoppers,
+					"types": map[string]interface{}{
+						"terms": map[string]interface{}{"field": "type", "size": 10},
+					},
+					"purchases": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"term": map[string]interface{}{"type": models.EventTypePurchase},
+						},
+						"aggs": map[string]interface{}{"buyers": shoppers},
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
+		return nil, fmt.Errorf("error encoding experiment query: %w", err)
+	}
+
+	log.Printf("[ES] EXPERIMENT REPORT - Index: %s, Experiment: %s", r.indexName, experiment)
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.indexName),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error executing experiment query: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	type count struct {
+		Count struct {
+			Value int `json:"value"`
+		} `json:"count"`
+	}
+	var result struct {
+		Aggregations struct {
+			Variants struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					Shoppers count  `json:"shoppers"`
+					Types    struct {
+						Buckets []struct {
+							Key      string `json:"key"`
+							DocCount int    `json:"doc_count"`
+						} `json:"buckets"`
+					} `json:"types"`
+					Purchases struct {
+						Buyers count `json:"buyers"`
+					} `json:"purchases"`
+				} `json:"buckets"`
+			} `json:"variants"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	stats := make(map[string]models.VariantReport, len(result.Aggregations.Variants.Buckets))
+	for _, bucket := range result.Aggregations.Variants.Buckets {
+		report := models.VariantReport{
+			Variant:  bucket.Key,
+			Shoppers: bucket.Shoppers.Count.Value,
+			Buyers:   bucket.Purchases.Buyers.Count.Value,
+		}
+		for _, eventType := range bucket.Types.Buckets {
+			switch eventType.Key {
+			case models.EventTypeSearch:
+				report.Searches = eventType.DocCount
+			case models.EventTypeView:
+				report.Views = eventType.DocCount
+			case models.EventTypeClick:
+				report.Clicks = eventType.DocCount
+			case models.EventTypeAddToCart:
+				report.AddToCarts = eventType.DocCount
+			case models.EventTypePurchase:
+				report.Purchases = eventType.DocCount
+			}
+		}
+		if report.Searches > 0 {
+			report.CTR = float64(report.Clicks) / float64(report.Searches)
+		}
+		if report.Shoppers > 0 {
+			report.ConversionRate = float64(report.Buyers) / float64(report.Shoppers)
+		}
+		stats[bucket.Key] = report
+	}
+	return stats, nil
+}
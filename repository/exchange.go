@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// RateSource provides the exchange rates table
+type RateSource interface {
+	Rates(ctx context.Context) (models.CurrencyRates, error)
+}
+
+// SetCurrencies enables multi-currency pricing: products are indexed with
+// their price in the base currency, and searches filter, sort and facet in the
+// requested currency
+func (r *ProductRepository) SetCurrencies(source RateSource) {
+	r.currencies = source
+}
+
+// repriceScript recomputes the base currency price of a product from params.rates
+const repriceScript = `
+	String currency = ctx._source.currency == null || ctx._source.currency == '' ? params.base : ctx._source.currency;
+	if (params.rates.containsKey(currency)) {
+		ctx._source.base_price = ((Number) ctx._source.price).doubleValue() / ((Number) params.rates.get(currency)).doubleValue();
+	} else {
+		ctx.op = 'noop';
+	}
+`
+
+// prepareCurrency defaults the currency of a product to the base currency and
+// checks that it is in the rates table
+func (r *ProductRepository) prepareCurrency(ctx context.Context, product *models.Product) error {
+	if r.currencies == nil {
+		return nil
+	}
+	rates, err := r.currencies.Rates(ctx)
+	if err != nil {
+		return err
+	}
+
+	product.Currency = strings.ToUpper(product.Currency)
+	if product.Currency == "" {
+		product.Currency = rates.Base
+	}
+	if _, ok := rates.Lookup(product.Currency); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCurrency, product.Currency)
+	}
+	return nil
+}
+
+// activeRates returns the exchange rates table, or nil when currencies are not
+// enabled
+func (r *ProductRepository) activeRates(ctx context.Context) (*models.CurrencyRates, error) {
+	if r.currencies == nil {
+		return nil, nil
+	}
+	rates, err := r.currencies.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+// currencyConversion prices a search in the requested currency
+type currencyConversion struct {
+	rates  models.CurrencyRates
+	target models.Currency
+}
+
+// currencyConversion returns the conversion to a requested currency (the base
+// currency when empty), or nil when currencies are not enabled
+func (r *ProductRepository) currencyConversion(ctx context.Context, code string) (*currencyConversion, error) {
+	if r.currencies == nil {
+		if code != "" {
+			return nil, fmt.Errorf("%w: currency conversion is not enabled", ErrUnknownCurrency)
+		}
+		return nil, nil
+	}
+	rates, err := r.currencies.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := rates.Lookup(strings.ToUpper(code))
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCurrency, code)
+	}
+	return &currencyConversion{rates: rates, target: target}, nil
+}
+
+// priceField is the indexed price compared across products
+func (c *currencyConversion) priceField() string {
+	if c == nil {
+		return "price"
+	}
+	return "base_price"
+}
+
+// toBase converts an amount in the requested currency to the base currency
+func (c *currencyConversion) toBase(amount float64) float64 {
+	if c == nil {
+		return amount
+	}
+	return amount / c.target.Rate
+}
+
+// facetBound converts a base currency facet boundary to the requested
+// currency, rounded to two significant digits (e.g. 25 USD = 34 SGD)
+func (c *currencyConversion) facetBound(bound float64) float64 {
+	if c == nil || c.target.Rate == 1 {
+		return bound
+	}
+	amount := bound * c.target.Rate
+	unit := math.Pow(10, math.Ceil(math.Log10(amount))-2)
+	return math.Round(amount/unit) * unit
+}
+
+// apply sets the price and sale price of products in the requested currency
+func (c *currencyConversion) apply(products []models.Product) {
+	if c == nil {
+		return
+	}
+	for i := range products {
+		product := &products[i]
+		price, ok := c.rates.Convert(product.Price, product.Currency, c.target.Code)
+		if !ok {
+			continue
+		}
+		product.Converted = &models.ConvertedPrice{Currency: c.target.Code, Price: price}
+		if product.Sale != nil {
+			if salePrice, ok := c.rates.Convert(product.Sale.Price, product.Currency, c.target.Code); ok {
+				product.Converted.SalePrice = &salePrice
+			}
+		}
+	}
+}
+
+// ConvertPrices adds the price of each product in a currency
+func (r *ProductRepository) ConvertPrices(ctx context.Context, products []models.Product, code string) error {
+	conversion, err := r.currencyConversion(ctx, code)
+	if err != nil {
+		return err
+	}
+	conversion.apply(products)
+	return nil
+}
+
+// RepriceCurrency recomputes the base currency price of the products priced in
+// a currency after its rate changed, and returns how many were updated
+func (r *ProductRepository) RepriceCurrency(ctx context.Context, code string) (int, error) {
+	query := map[string]interface{}{
+		"term": map[string]interface{}{"currency": code},
+	}
+	return r.reprice(ctx, query)
+}
+
+// BackfillBasePrices computes the base currency price of products indexed
+// before multi-currency pricing, treating a missing currency as the base currency
+func (r *ProductRepository) BackfillBasePrices(ctx context.Context) (int, error) {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": map[string]interface{}{
+				"exists": map[string]interface{}{"field": "base_price"},
+			},
+		},
+	}
+	return r.reprice(ctx, query)
+}
+
+// reprice recomputes the base currency price of the products matching a query
+func (r *ProductRepository) reprice(ctx context.Context, query map[string]interface{}) (int, error) {
+	if r.currencies == nil {
+		return 0, nil
+	}
+	rates, err := r.currencies.Rates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rateParams := make(map[string]float64, len(rates.Currencies))
+	for code, currency := range rates.Currencies {
+		rateParams[code] = currency.Rate
+	}
+
+	return r.updateByQuery(ctx, "REPRICE", query, map[string]interface{}{
+		"lang":   "painless",
+		"source": repriceScript,
+		"params": map[string]interface{}{"base": rates.Base, "rates": rateParams},
+	})
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/querylang"
+)
+
+// Fallback steps applied, in order, when a search returns no results.
+// Each step relaxes the request further on top of the previous ones.
+const (
+	FallbackDropPrice    = "drop_price"    // remove the min/max price filter
+	FallbackDropCategory = "drop_category" // remove the category filter
+	FallbackRelaxText    = "relax_text"    // loosen operator and fuzziness of the text match
+	FallbackTrending     = "trending"      // popular products in the requested category
+)
+
+// ValidateFallbackSteps checks that every configured fallback step is known
+func ValidateFallbackSteps(steps []string) error {
+	for _, step := range steps {
+		switch step {
+		case FallbackDropPrice, FallbackDropCategory, FallbackRelaxText, FallbackTrending:
+		default:
+			return fmt.Errorf("unknown fallback step: %s", step)
+		}
+	}
+	return nil
+}
+
+// SearchWithFallback interprets the query, runs the search and, if it finds
+// nothing, walks the fallback chain until a relaxation step produces results.
+// The returned result reports the interpreted query and which step (if any)
+// produced the products along with the request that was run.
+func (r *ProductRepository) SearchWithFallback(ctx context.Context, searchReq *models.ProductSearchRequest, steps []string) (*models.SearchResult, error) {
+	opts, err := r.requestOptions(ctx, searchReq)
+	if err != nil {
+		return nil, err
+	}
+	var interpretation *models.QueryInterpretation
+	var parsedQuery string
+
+	if searchReq.Syntax == models.SyntaxAdvanced {
+		if strings.TrimSpace(searchReq.Query) != "" {
+			node, err := querylang.Parse(searchReq.Query)
+			if err != nil {
+				return nil, err
+			}
+			opts.advancedQuery = querylang.Translate(node, textSearchFields, phraseSearchFields, opts.categoryResolver())
+			parsedQuery = node.String()
+		}
+	} else {
+		interpretation = r.understandQuery(ctx, searchReq, &opts)
+	}
+
+	products, total, err := r.search(ctx, searchReq, opts)
+	if err != nil {
+		return nil, err
+	}
+	if total > 0 {
+		result := &models.SearchResult{Products: products, Total: total, Interpretation: interpretation, ParsedQuery: parsedQuery}
+		return r.withNavigation(ctx, result, searchReq, opts)
+	}
+
+	relaxed := *searchReq
+
+	for _, step := range steps {
+		switch step {
+		case FallbackDropPrice:
+			if relaxed.MinPrice == 0 && relaxed.MaxPrice == 0 {
+				continue
+			}
+			relaxed.MinPrice = 0
+			relaxed.MaxPrice = 0
+			products, total, err = r.search(ctx, &relaxed, opts)
+		case FallbackDropCategory:
+			if relaxed.Category == "" {
+				continue
+			}
+			relaxed.Category = ""
+			products, total, err = r.search(ctx, &relaxed, opts)
+		case FallbackRelaxText:
+			if relaxed.Query == "" || opts.advancedQuery != nil {
+				continue
+			}
+			opts.relaxText = true
+			products, total, err = r.search(ctx, &relaxed, opts)
+		case FallbackTrending:
+			relaxed = models.ProductSearchRequest{
+				Category: searchReq.Category,
+				Page:     searchReq.Page,
+				PageSize: searchReq.PageSize,
+			}
+			products, total, err = r.trendingInCategory(ctx, relaxed.Category, relaxed.Page, relaxed.PageSize)
+			if searchReq.Currency != "" {
+				relaxed.Currency = searchReq.Currency
+				opts.currency.apply(products)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if total > 0 {
+			log.Printf("[SEARCH] FALLBACK - Query: %q, Step: %s, Total: %d", searchReq.Query, step, total)
+			result := &models.SearchResult{
+				Products: products,
+				Total:    total,
+				Relaxation: &models.SearchRelaxation{
+					Step:    step,
+					Request: relaxed,
+				},
+				Interpretation: interpretation,
+				ParsedQuery:    parsedQuery,
+			}
+			if step == FallbackTrending {
+				result.Breadcrumbs = opts.taxonomy.Breadcrumbs(relaxed.Category)
+				return result, nil
+			}
+			return r.withNavigation(ctx, result, &relaxed, opts)
+		}
+	}
+
+	return &models.SearchResult{Products: products, Total: total, Interpretation: interpretation, ParsedQuery: parsedQuery}, nil
+}
+
+// withNavigation adds the breadcrumbs of the category filter of the request
+// that produced a result and, when the request asks for them, its facets
+func (r *ProductRepository) withNavigation(ctx context.Context, result *models.SearchResult, searchReq *models.ProductSearchRequest, opts searchOptions) (*models.SearchResult, error) {
+	result.Breadcrumbs = opts.taxonomy.Breadcrumbs(searchReq.Category)
+	if !searchReq.Facets {
+		return result, nil
+	}
+	priceFacets, err := r.priceFacets(ctx, searchReq, opts)
+	if err != nil {
+		return nil, err
+	}
+	categoryFacets, err := r.categoryFacets(ctx, searchReq, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.PriceFacets = priceFacets
+	result.CategoryFacets = categoryFacets
+	return result, nil
+}
+
+// trendingInCategory lists trending products, optionally within a category.
+// Without trending data it falls back to lifetime sales and views.
+func (r *ProductRepository) trendingInCategory(ctx context.Context, category string, page, pageSize int) ([]models.Product, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	from := (page - 1) * pageSize
+
+	if r.trending != nil {
+		trending, err := r.trendingCandidates(ctx, category)
+		if err != nil {
+			log.Printf("[SEARCH] Failed to load trending scores, using lifetime popularity: %v", err)
+		} else {
+			products, total, err := r.TrendingProducts(ctx, trending, category, from, pageSize)
+			if err != nil || total > 0 {
+				return products, total, err
+			}
+		}
+	}
+
+	query := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+	if category != "" {
+		query = r.categoryFilter(ctx, category)
+	}
+
+	searchBody := map[string]interface{}{
+		"query": query,
+		"from":  from,
+		"size":  pageSize,
+		"sort": []map[string]interface{}{
+			{"sales_count": map[string]interface{}{"order": "desc"}},
+			{"view_count": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	return r.executeSearch(ctx, searchBody)
+}
+
+// trendingCandidates returns the top trending scores, ranked within the
+// category when one is given
+func (r *ProductRepository) trendingCandidates(ctx context.Context, category string) ([]models.TrendingScore, error) {
+	if category != "" {
+		ids, err := r.CategoryProductIDs(ctx, category)
+		if err != nil {
+			return nil, err
+		}
+		return r.trending.TrendingAmong(ctx, ids)
+	}
+
+	scores, err := r.trending.TrendingScores(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trending := make([]models.TrendingScore, 0, len(scores))
+	for id, score := range scores {
+		trending = append(trending, models.TrendingScore{ProductID: id, Score: score})
+	}
+	return trending, nil
+}
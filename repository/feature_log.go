@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+const (
+	// featureLogSlots bounds concurrent feature captures; samples beyond it are skipped
+	featureLogSlots = 4
+
+	// featureLogTimeout bounds one feature capture
+	featureLogTimeout = 10 * time.Second
+
+	// maxFeatureExport caps the rows of one export
+	maxFeatureExport = 100000
+
+	// featureExportBatch is the page size used to read feature rows and events
+	featureExportBatch = 1000
+)
+
+// LTRFeatures lists the logged features in export order. Optional factors
+// that were disabled for a search are exported as 1 (no effect).
+var LTRFeatures = append(append([]string{"bm25", "position"}, formulaFeatures...), "trendingBoost", "freshnessBoost", "affinityBoost")
+
+// outcomeLabels grades the events referencing a search result; a product's
+// label is the highest grade of its events
+var outcomeLabels = map[string]int{
+	models.EventTypeClick:     1,
+	models.EventTypeAddToCart: 2,
+	models.EventTypePurchase:  3,
+}
+
+// FeatureLogRepository stores learning-to-rank feature vectors and exports
+// them joined with the outcome events
+type FeatureLogRepository struct {
+	client      *elasticsearch.Client
+	indexName   string
+	eventsIndex string
+}
+
+func NewFeatureLogRepository(client *elasticsearch.Client, indexName, eventsIndex string) *FeatureLogRepository {
+	return &FeatureLogRepository{
+		client:      client,
+		indexName:   indexName,
+		eventsIndex: eventsIndex,
+	}
+}
+
+// SetFeatureLogging logs the feature vectors of a sampled fraction of searches
+// that carry a search ID
+func (r *ProductRepository) SetFeatureLogging(store *FeatureLogRepository, sampleRate float64) {
+	r.featureLog = store
+	r.featureSampleRate = sampleRate
+	r.featureSlots = make(chan struct{}, featureLogSlots)
+}
+
+// logFeatures captures the features of the returned products in the
+// background, so sampling never slows down the search
+func (r *ProductRepository) logFeatures(searchReq *models.ProductSearchRequest, opts searchOptions, profile models.RankingProfile, factors []formulaFactor, products []models.Product, from int) {
+	if r.featureLog == nil || searchReq.SearchID == "" || len(products) == 0 || rand.Float64() >= r.featureSampleRate {
+		return
+	}
+
+	select {
+	case r.featureSlots <- struct{}{}:
+	default:
+		log.Printf("[LTR] Feature logging busy, skipping search %s", searchReq.SearchID)
+		return
+	}
+
+	req := *searchReq
+	go func() {
+		defer func() { <-r.featureSlots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), featureLogTimeout)
+		defer cancel()
+
+		rows, err := r.featureRows(ctx, &req, opts, profile, factors, products, from)
+		if err == nil {
+			err = r.featureLog.Store(ctx, rows)
+		}
+		if err != nil {
+			log.Printf("[LTR] Failed to log features of search %s: %v", req.SearchID, err)
+		}
+	}()
+}
+
+// featureRows computes the feature vector of each returned product: the text
+// relevance of the retrieval query and the value of every scoring factor
+func (r *ProductRepository) featureRows(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions, profile models.RankingProfile, factors []formulaFactor, products []models.Product, from int) ([]models.FeatureRow, error) {
+	ids := productIDs(products)
+
+	searchBody := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   buildSearchQuery(searchReq, opts),
+				"filter": map[string]interface{}{"ids": map[string]interface{}{"values": ids}},
+			},
+		},
+		"size":          len(ids),
+		"_source":       false,
+		"script_fields": map[string]interface{}{"factors": buildFeatureScript(profile, factors...)},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
+		return nil, fmt.Errorf("error encoding feature query: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.indexName),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error executing feature query: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID     string  `json:"_id"`
+				Score  float64 `json:"_score"`
+				Fields struct {
+					Factors []map[string]float64 `json:"factors"`
+				} `json:"fields"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	features := make(map[string]map[string]float64, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		values := map[string]float64{"bm25": hit.Score}
+		if len(hit.Fields.Factors) > 0 {
+			for name, value := range hit.Fields.Factors[0] {
+				values[name] = value
+			}
+		}
+		features[hit.ID] = values
+	}
+
+	now := time.Now()
+	rows := make([]models.FeatureRow, 0, len(ids))
+	for i, id := range ids {
+		values, ok := features[id]
+		if !ok {
+			continue
+		}
+		values["position"] = float64(from + i + 1)
+		rows = append(rows, models.FeatureRow{
+			SearchID:  searchReq.SearchID,
+			Query:     searchReq.Query,
+			ProductID: id,
+			Position:  from + i + 1,
+			Features:  values,
+			UserID:    searchReq.UserID,
+			SessionID: searchReq.SessionID,
+			Timestamp: now,
+		})
+	}
+	return rows, nil
+}
+
+// Store indexes feature rows, one document per search and product
+func (r *FeatureLogRepository) Store(ctx context.Context, rows []models.FeatureRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, row := range rows {
+		action := map[string]interface{}{
+			"index": map[string]interface{}{
+				"_index": r.indexName,
+				"_id":    row.SearchID + ":" + row.ProductID,
+			},
+		}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("error encoding bulk action: %w", err)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("error encoding feature row: %w", err)
+		}
+	}
+
+	log.Printf("[ES] FEATURE LOG - Index: %s, SearchID: %s, Rows: %d", r.indexName, rows[0].SearchID, len(rows))
+
+	res, err := r.client.Bulk(
+		&body,
+		r.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error storing feature rows: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk feature log had failures: %s", string(resBody))
+	}
+
+	return nil
+}
+
+// Export returns the feature rows logged in [since, until), oldest search
+// first, labelled with the outcome events that reference their search ID
+func (r *FeatureLogRepository) Export(ctx context.Context, since, until time.Time, limit int) ([]models.FeatureRow, error) {
+	if limit <= 0 || limit > maxFeatureExport {
+		limit = maxFeatureExport
+	}
+
+	var rows []models.FeatureRow
+	var searchAfter []interface{}
+	for len(rows) < limit {
+		searchBody := map[string]interface{}{
+			"query": map[string]interface{}{
+				"range": map[string]interface{}{
+					"timestamp": map[string]interface{}{"gte": since, "lt": until},
+				},
+			},
+			"size": min(featureExportBatch, limit-len(rows)),
+			"sort": []map[string]interface{}{
+				{"timestamp": map[string]interface{}{"order": "asc"}},
+				{"search_id": map[string]interface{}{"order": "asc"}},
+				{"position": map[string]interface{}{"order": "asc"}},
+			},
+		}
+		if searchAfter != nil {
+			searchBody["search_after"] = searchAfter
+		}
+
+		var page struct {
+			Hits struct {
+				Hits []struct {
+					Source models.FeatureRow `json:"_source"`
+					Sort   []interface{}     `json:"sort"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := searchIndex(ctx, r.client, r.indexName, searchBody, &page); err != nil {
+			return nil, err
+		}
+
+		for _, hit := range page.Hits.Hits {
+			rows = append(rows, hit.Source)
+		}
+		if len(page.Hits.Hits) < featureExportBatch {
+			break
+		}
+		searchAfter = page.Hits.Hits[len(page.Hits.Hits)-1].Sort
+	}
+
+	labels, err := r.outcomeLabels(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Label = labels[rows[i].SearchID+":"+rows[i].ProductID]
+	}
+	return rows, nil
+}
+
+// outcomeLabels grades every (search ID, product ID) with outcome events
+func (r *FeatureLogRepository) outcomeLabels(ctx context.Context, rows []models.FeatureRow) (map[string]int, error) {
+	seen := make(map[string]bool)
+	var searchIDs []string
+	for _, row := range rows {
+		if !seen[row.SearchID] {
+			seen[row.SearchID] = true
+			searchIDs = append(searchIDs, row.SearchID)
+		}
+	}
+
+	eventTypes := make([]string, 0, len(outcomeLabels))
+	for eventType := range outcomeLabels {
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	labels := make(map[string]int)
+	for start := 0; start < len(searchIDs); start += featureExportBatch {
+		end := min(start+featureExportBatch, len(searchIDs))
+
+		var searchAfter []interface{}
+		for {
+			searchBody := map[string]interface{}{
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"filter": []map[string]interface{}{
+							{"terms": map[string]interface{}{"search_id": searchIDs[start:end]}},
+							{"terms": map[string]interface{}{"type": eventTypes}},
+						},
+					},
+				},
+				"size":    featureExportBatch,
+				"_source": []string{"type", "search_id", "product_ids"},
+				"sort": []map[string]interface{}{
+					{"id": map[string]interface{}{"order": "asc"}},
+				},
+			}
+			if searchAfter != nil {
+				searchBody["search_after"] = searchAfter
+			}
+
+			var page struct {
+				Hits struct {
+					Hits []struct {
+						Source models.Event  `json:"_source"`
+						Sort   []interface{} `json:"sort"`
+					} `json:"hits"`
+				} `json:"hits"`
+			}
+			if err := searchIndex(ctx, r.client, r.eventsIndex, searchBody, &page); err != nil {
+				return nil, err
+			}
+
+			for _, hit := range page.Hits.Hits {
+				grade := outcomeLabels[hit.Source.Type]
+				for _, productID := range hit.Source.ProductIDs {
+					key := hit.Source.SearchID + ":" + productID
+					if grade > labels[key] {
+						labels[key] = grade
+					}
+				}
+			}
+			if len(page.Hits.Hits) < featureExportBatch {
+				break
+			}
+			searchAfter = page.Hits.Hits[len(page.Hits.Hits)-1].Sort
+		}
+	}
+	return labels, nil
+}
+
+// searchIndex runs a search body against an index and decodes the response into result
+func searchIndex(ctx context.Context, client *elasticsearch.Client, index string, searchBody map[string]interface{}, result interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
+		return fmt.Errorf("error encoding search query: %w", err)
+	}
+
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return fmt.Errorf("error executing search: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	if err := json.Unmarshal(resBody, result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
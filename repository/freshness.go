@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// Decay functions accepted for the freshness boost, mapped to their painless
+// score functions
+var freshnessFunctions = map[string]string{
+	"gauss":  "decayDateGauss",
+	"exp":    "decayDateExp",
+	"linear": "decayDateLinear",
+}
+
+// Freshness configures the new-arrival boost on created_at
+type Freshness struct {
+	Function string        // "gauss", "exp" or "linear"
+	Scale    time.Duration // age beyond the offset at which the decay reaches Decay
+	Offset   time.Duration // age during which products get the full boost
+	Decay    float64       // decay value at offset + scale (0-1)
+}
+
+// ValidateFreshness checks the freshness configuration
+func ValidateFreshness(freshness Freshness) error {
+	if _, ok := freshnessFunctions[freshness.Function]; !ok {
+		return fmt.Errorf("unknown freshness function %q (expected gauss, exp or linear)", freshness.Function)
+	}
+	if freshness.Scale <= 0 {
+		return fmt.Errorf("freshness scale must be positive")
+	}
+	if freshness.Offset < 0 {
+		return fmt.Errorf("freshness offset must not be negative")
+	}
+	if freshness.Decay <= 0 || freshness.Decay >= 1 {
+		return fmt.Errorf("freshness decay must be between 0 and 1")
+	}
+	return nil
+}
+
+// SetFreshness sets the decay curve of the freshness factor, applied when the
+// ranking profile has a positive freshness weight, and the age limit of the
+// new_arrivals listing
+func (r *ProductRepository) SetFreshness(freshness Freshness, newArrivalsPeriod time.Duration) {
+	r.freshness = freshness
+	r.newArrivalsPeriod = newArrivalsPeriod
+}
+
+// freshnessFactor boosts recently created products:
+// F = 1.0 + weight × decay(now - created_at)
+// where decay is 1 within the offset and falls to Decay at offset + scale
+func freshnessFactor(freshness Freshness, weight float64, now time.Time) formulaFactor {
+	return formulaFactor{
+		script: `
+					// Freshness: new arrivals get a boost that decays with age
+					double freshnessBoost = 1.0;
+					if (doc['created_at'].size() > 0) {
+						freshnessBoost += params.freshness_weight * ` + freshnessFunctions[freshness.Function] + `(params.freshness_origin, params.freshness_scale, params.freshness_offset, params.freshness_decay, doc['created_at'].value);
+					}
+	`,
+		variable: "freshnessBoost",
+		params: map[string]interface{}{
+			"freshness_origin": now.UTC().Format(time.RFC3339),
+			"freshness_scale":  esDuration(freshness.Scale),
+			"freshness_offset": esDuration(freshness.Offset),
+			"freshness_decay":  freshness.Decay,
+			"freshness_weight": weight,
+		},
+	}
+}
+
+// newArrivalsSearch lists the products created within the new-arrivals period
+// that match the request, newest first
+func (r *ProductRepository) newArrivalsSearch(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions, from int, profile models.RankingProfile, factors []formulaFactor) ([]models.Product, int, error) {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must": buildSearchQuery(searchReq, opts),
+			"filter": map[string]interface{}{
+				"range": map[string]interface{}{
+					"created_at": map[string]interface{}{
+						"gte": time.Now().Add(-r.newArrivalsPeriod).UTC().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	}
+
+	return r.executeSearch(ctx, map[string]interface{}{
+		"query": buildScoringQuery(query, profile, factors...),
+		"from":  from,
+		"size":  searchReq.PageSize,
+		"sort": []map[string]interface{}{
+			{"created_at": map[string]interface{}{"order": "desc"}},
+			{"_score": map[string]interface{}{"order": "desc"}},
+		},
+	})
+}
+
+// esDuration formats a duration as an Elasticsearch time unit
+func esDuration(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
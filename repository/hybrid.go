@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+const (
+	// hybridWindow is the number of candidates taken from each retriever
+	hybridWindow = 100
+
+	// rrfRankConstant dampens the influence of top ranks in reciprocal rank fusion
+	rrfRankConstant = 60
+)
+
+// hybridScoringQuery retrieves candidates with both BM25 and kNN, fuses the two
+// rankings with reciprocal rank fusion (RRF), and returns a scoring query that
+// applies the business formula on top of the fused score
+func (r *ProductRepository) hybridScoringQuery(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions, profile models.RankingProfile, factors []formulaFactor) (map[string]interface{}, error) {
+	if r.embedder == nil {
+		return nil, fmt.Errorf("hybrid search requires an embedder")
+	}
+
+	vector, err := r.embedder.Embed(searchReq.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %w", err)
+	}
+
+	// Keyword leg: the regular retrieval query without business scoring
+	lexical, _, err := r.executeSearch(ctx, map[string]interface{}{
+		"query":   buildSearchQuery(searchReq, opts),
+		"size":    hybridWindow,
+		"_source": []string{"id"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Vector leg: nearest neighbours under the same filters
+	knn := map[string]interface{}{
+		"field":          "embedding",
+		"query_vector":   vector,
+		"k":              hybridWindow,
+		"num_candidates": hybridWindow * 2,
+	}
+	if filters := buildFilterClauses(searchReq, opts); len(filters) > 0 {
+		knn["filter"] = filters
+	}
+	semantic, _, err := r.executeSearch(ctx, map[string]interface{}{
+		"knn":     knn,
+		"size":    hybridWindow,
+		"_source": []string{"id"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fused := reciprocalRankFusion(productIDs(lexical), productIDs(semantic))
+
+	ids := make([]string, len(fused))
+	for i, doc := range fused {
+		ids[i] = doc.id
+	}
+	scores := make(map[string]interface{}, len(fused))
+	for _, doc := range fused {
+		scores[doc.id] = doc.score
+	}
+
+	query := map[string]interface{}{
+		"ids": map[string]interface{}{"values": ids},
+	}
+	return buildFormulaQuery(query, "params.rrf[doc['id'].value]", map[string]interface{}{"rrf": scores}, profile, factors...), nil
+}
+
+type fusedDoc struct {
+	id    string
+	score float64
+}
+
+// reciprocalRankFusion merges rankings: each document scores the sum of
+// 1 / (k + rank) over the rankings it appears in
+func reciprocalRankFusion(rankings ...[]string) []fusedDoc {
+	scores := make(map[string]float64)
+	for _, ranking := range rankings {
+		for i, id := range ranking {
+			scores[id] += 1.0 / float64(rrfRankConstant+i+1)
+		}
+	}
+
+	fused := make([]fusedDoc, 0, len(scores))
+	for id, score := range scores {
+		fused = append(fused, fusedDoc{id: id, score: score})
+	}
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].score != fused[j].score {
+			return fused[i].score > fused[j].score
+		}
+		return fused[i].id < fused[j].id
+	})
+	return fused
+}
+
+func productIDs(products []models.Product) []string {
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
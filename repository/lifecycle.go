@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// scheduleBatch is the most products moved per scheduler run
+	scheduleBatch = 500
+
+	// scheduleTimeout bounds one scheduler run
+	scheduleTimeout = 2 * time.Minute
+
+	// SchedulerActor is recorded for changes made by the lifecycle scheduler
+	SchedulerActor = "scheduler"
+)
+
+// ErrInvalidLifecycle is returned for a disallowed status change or schedule
+var ErrInvalidLifecycle = errors.New("invalid lifecycle")
+
+// notTrashedFilter matches the products outside the trash
+func notTrashedFilter() map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": []map[string]interface{}{
+				{"exists": map[string]interface{}{"field": "deleted_at"}},
+			},
+		},
+	}
+}
+
+// statusFilter matches the products in a lifecycle status. Products stored
+// without a status count as published.
+func statusFilter(status string) map[string]interface{} {
+	if status != models.StatusPublished {
+		return map[string]interface{}{"term": map[string]interface{}{"status": status}}
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"term": map[string]interface{}{"status": models.StatusPublished}},
+				{"bool": map[string]interface{}{
+					"must_not": []map[string]interface{}{
+						{"exists": map[string]interface{}{"field": "status"}},
+					},
+				}},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// visibleFilter matches the products shoppers see: published, not past their
+// unpublish_at, and not in the trash. It mirrors models.Product.IsLive.
+func visibleFilter() map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				notTrashedFilter(),
+				statusFilter(models.StatusPublished),
+			},
+			"must_not": []map[string]interface{}{
+				{"range": map[string]interface{}{"unpublish_at": map[string]interface{}{"lte": "now"}}},
+			},
+		},
+	}
+}
+
+// visibleOnly restricts a search body to visible products. The query keeps
+// its scoring and a kNN search gets the filter as a pre-filter.
+func visibleOnly(searchBody map[string]interface{}) {
+	if knn, ok := searchBody["knn"].(map[string]interface{}); ok {
+		filters := []interface{}{visibleFilter()}
+		switch existing := knn["filter"].(type) {
+		case []map[string]interface{}:
+			for _, filter := range existing {
+				filters = append(filters, filter)
+			}
+		case map[string]interface{}:
+			filters = append(filters, existing)
+		}
+		knn["filter"] = filters
+		if _, ok := searchBody["query"]; !ok {
+			return
+		}
+	}
+
+	query, ok := searchBody["query"]
+	if !ok {
+		query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	searchBody["query"] = map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   query,
+			"filter": visibleFilter(),
+		},
+	}
+}
+
+// prepareLifecycle fills in the status of a product being written and checks
+// it against its stored version, nil for a new product. New products are
+// published unless they are scheduled for later.
+func prepareLifecycle(product, existing *models.Product, now time.Time) error {
+	scheduled := product.PublishAt != nil && product.PublishAt.After(now)
+
+	// A product moved to draft stays a draft: a publish_at that has already
+	// passed would have the scheduler publish it again
+	if product.Status == models.StatusDraft && !scheduled && (existing == nil || existing.LifecycleStatus() != models.StatusDraft) {
+		product.PublishAt = nil
+	}
+
+	switch {
+	case existing != nil && product.Status == "":
+		product.Status = existing.LifecycleStatus()
+	case product.Status == "" && scheduled:
+		product.Status = models.StatusDraft
+	case product.Status == "":
+		product.Status = models.StatusPublished
+	}
+
+	if existing != nil && !models.CanTransition(existing.LifecycleStatus(), product.Status) {
+		return fmt.Errorf("%w: a product cannot change from %s to %s", ErrInvalidLifecycle, existing.LifecycleStatus(), product.Status)
+	}
+	if product.Status == models.StatusPublished && scheduled {
+		return fmt.Errorf("%w: a product scheduled with publish_at must be a draft", ErrInvalidLifecycle)
+	}
+	if product.PublishAt != nil && product.UnpublishAt != nil && !product.UnpublishAt.After(*product.PublishAt) {
+		return fmt.Errorf("%w: unpublish_at must be after publish_at", ErrInvalidLifecycle)
+	}
+	if product.Status == models.StatusPublished && product.UnpublishAt != nil && !product.UnpublishAt.After(now) {
+		return fmt.Errorf("%w: a published product cannot have an unpublish_at in the past", ErrInvalidLifecycle)
+	}
+	return nil
+}
+
+// ListByStatus lists the products outside the trash in any lifecycle
+// status, or one status, most recently updated first
+func (r *ProductRepository) ListByStatus(ctx context.Context, status string, page, pageSize int) ([]models.Product, int, error) {
+	filters := []map[string]interface{}{notTrashedFilter()}
+	if status != "" {
+		filters = append(filters, statusFilter(status))
+	}
+
+	return r.searchProducts(ctx, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"from": (page - 1) * pageSize,
+		"size": pageSize,
+		"sort": []map[string]interface{}{
+			{"updated_at": map[string]interface{}{"order": "desc"}},
+		},
+	})
+}
+
+// ValidateScheduleInterval checks the interval of the publishing scheduler
+func ValidateScheduleInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("publish schedule interval must be positive, got %s", interval)
+	}
+	return nil
+}
+
+// ScheduleEvery applies publish_at and unpublish_at every interval, until the
+// process exits. See ValidateScheduleInterval.
+func (r *ProductRepository) ScheduleEvery(interval time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(WithActor(context.Background(), SchedulerActor), scheduleTimeout)
+		if count, err := r.ApplySchedule(ctx, time.Now()); err != nil {
+			log.Printf("[LIFECYCLE] Failed to apply publishing schedule: %v", err)
+		} else if count > 0 {
+			log.Printf("[LIFECYCLE] Changed the status of %d scheduled products", count)
+		}
+		cancel()
+		time.Sleep(interval)
+	}
+}
+
+// ApplySchedule publishes the drafts whose publish_at has passed and archives
+// the published products whose unpublish_at has passed, and returns how many
+// changed. A draft whose whole window has passed is archived directly.
+func (r *ProductRepository) ApplySchedule(ctx context.Context, now time.Time) (int, error) {
+	due, _, err := r.searchProducts(ctx, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{notTrashedFilter()},
+				"should": []map[string]interface{}{
+					{"bool": map[string]interface{}{
+						"filter": []map[string]interface{}{
+							statusFilter(models.StatusDraft),
+							{"range": map[string]interface{}{"publish_at": map[string]interface{}{"lte": now}}},
+						},
+					}},
+					{"bool": map[string]interface{}{
+						"filter": []map[string]interface{}{
+							statusFilter(models.StatusPublished),
+							{"range": map[string]interface{}{"unpublish_at": map[string]interface{}{"lte": now}}},
+						},
+					}},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+		"size": scheduleBatch,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for i := range due {
+		before := due[i]
+		after := before
+
+		after.Status = models.StatusArchived
+		if before.LifecycleStatus() == models.StatusDraft && (before.UnpublishAt == nil || before.UnpublishAt.After(now)) {
+			// The schedule is used up, so moving the product back to draft
+			// later does not publish it again
+			after.Status = models.StatusPublished
+			after.PublishAt = nil
+		}
+		after.UpdatedAt = now
+
+		if err := r.setStatus(ctx, &after); err != nil {
+			return changed, err
+		}
+		log.Printf("[LIFECYCLE] Product %s changed from %s to %s", after.ID, before.LifecycleStatus(), after.Status)
+		changed++
+		if err := r.recordChange(ctx, &before, &after); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// setStatus stores the status, publish_at and update time of a product
+func (r *ProductRepository) setStatus(ctx context.Context, product *models.Product) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"doc": map[string]interface{}{
+			"status":     product.Status,
+			"publish_at": product.PublishAt,
+			"updated_at": product.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling product update: %w", err)
+	}
+
+	log.Printf("[ES] SET STATUS - Index: %s, DocumentID: %s, Status: %s", r.indexName, product.ID, product.Status)
+
+	req := esapi.UpdateRequest{
+		Index:      r.indexName,
+		DocumentID: product.ID,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error updating product: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// PromotionSource provides the promotions running at a time
+type PromotionSource interface {
+	ActivePromotions(ctx context.Context, now time.Time) ([]models.Promotion, error)
+}
+
+// SetPromotions enables sale pricing: searches filter, sort and facet by the
+// effective price, active promotions boost their products, and returned
+// products carry their sale price
+func (r *ProductRepository) SetPromotions(source PromotionSource) {
+	r.promotions = source
+}
+
+// priceFacetBounds are the boundaries of the price facet ranges, in the base
+// currency. Other currencies use the converted bounds rounded to two
+// significant digits.
+var priceFacetBounds = []float64{25, 50, 100, 250, 500}
+
+// Painless snippets over the active promotions in params.pricing, which maps
+// "product:<id>" and "category:<name>" targets to the best sale price and the
+// best percent off. Sale prices are in the base currency when currencies are
+// enabled and are converted to the currency of each product. Percentages are
+// rounded to the minor unit of the product currency, from the digits by
+// currency in params.pricing.decimals (two when missing).
+const (
+	// Targets of the document, as keyed in params.pricing: the product, its
+	// category and the ancestors of the category, which end its indexed paths
+	promotionTargetsScript = `
+					List promotionTargets = [
+						'product:' + (doc['id'].size() > 0 ? doc['id'].value : ''),
+						'category:' + (doc['category'].size() > 0 ? doc['category'].value : '')
+					];
+					for (String path : doc['category_paths']) {
+						promotionTargets.add('category:' + path.substring(path.lastIndexOf('/') + 1));
+					}
+	`
+
+	// Effective price: the lowest of the list price and every applicable
+	// promotional price. The exchange rate
+	// of the product currency is taken from its list and base prices; without
+	// a base price, prices are compared as they are. effectiveBasePrice is the
+	// effective price normalized to the base currency.
+	effectivePriceScript = promotionTargetsScript + `
+					double listPrice = doc['price'].size() > 0 ? doc['price'].value : 0.0;
+					String currency = doc['currency'].size() > 0 ? doc['currency'].value : params.pricing.base;
+					double minorUnits = Math.pow(10, params.pricing.decimals.containsKey(currency) ? ((Number) params.pricing.decimals.get(currency)).intValue() : 2);
+					double rate = listPrice > 0 && doc['base_price'].size() > 0 && doc['base_price'].value > 0
+						? listPrice / doc['base_price'].value
+						: 1.0;
+					double effectivePrice = listPrice;
+					for (String target : promotionTargets) {
+						if (params.pricing.sale_price.containsKey(target)) {
+							effectivePrice = Math.min(effectivePrice, ((Number) params.pricing.sale_price.get(target)).doubleValue() * rate);
+						}
+						if (params.pricing.percent_off.containsKey(target)) {
+							double percentOff = ((Number) params.pricing.percent_off.get(target)).doubleValue();
+							effectivePrice = Math.min(effectivePrice, Math.round(listPrice * (100 - percentOff) / 100.0 * minorUnits) / minorUnits);
+						}
+					}
+					double effectiveBasePrice = effectivePrice / rate;
+	`
+)
+
+// pricing is the set of promotions active during a search
+type pricing struct {
+	params map[string]interface{}
+}
+
+// newPricing indexes active promotions by target for the painless scripts,
+// keeping only the best discount of each kind per target. With rates, sale
+// prices are converted to the base currency.
+func newPricing(promotions []models.Promotion, rates *models.CurrencyRates) *pricing {
+	salePrice := map[string]float64{}
+	percentOff := map[string]float64{}
+	for _, promotion := range promotions {
+		targets := make([]string, 0, len(promotion.ProductIDs)+len(promotion.Categories))
+		for _, id := range promotion.ProductIDs {
+			targets = append(targets, "product:"+id)
+		}
+		for _, category := range promotion.Categories {
+			targets = append(targets, "category:"+category)
+		}
+
+		price := promotion.SalePrice
+		if price > 0 && rates != nil {
+			var ok bool
+			if price, ok = rates.ToBase(price, promotion.Currency); !ok {
+				log.Printf("[SEARCH] Skipping promotion %s priced in unknown currency %s", promotion.ID, promotion.Currency)
+				continue
+			}
+		}
+
+		for _, target := range targets {
+			if price > 0 {
+				if best, ok := salePrice[target]; !ok || price < best {
+					salePrice[target] = price
+				}
+			} else if promotion.PercentOff > percentOff[target] {
+				percentOff[target] = promotion.PercentOff
+			}
+		}
+	}
+
+	base := ""
+	if rates != nil {
+		base = rates.Base
+	}
+	return &pricing{
+		params: map[string]interface{}{
+			"sale_price":  salePrice,
+			"percent_off": percentOff,
+			"decimals":    rates.DecimalsTable(),
+			"base":        base,
+		},
+	}
+}
+
+// activePricing returns the promotions running now, or nil when there are
+// none and the list price applies
+func (r *ProductRepository) activePricing(ctx context.Context) *pricing {
+	if r.promotions == nil {
+		return nil
+	}
+	promotions, err := r.promotions.ActivePromotions(ctx, time.Now())
+	if err != nil {
+		log.Printf("[SEARCH] Failed to load active promotions, using list prices: %v", err)
+		return nil
+	}
+	if len(promotions) == 0 {
+		return nil
+	}
+	rates, err := r.activeRates(ctx)
+	if err != nil {
+		log.Printf("[SEARCH] Failed to load exchange rates, using list prices: %v", err)
+		return nil
+	}
+	return newPricing(promotions, rates)
+}
+
+// script returns a script computing the effective price, ending with the given
+// painless statement
+func (p *pricing) script(ret string, params map[string]interface{}) map[string]interface{} {
+	scriptParams := map[string]interface{}{"pricing": p.params}
+	for key, value := range params {
+		scriptParams[key] = value
+	}
+	return map[string]interface{}{
+		"source": effectivePriceScript + ret,
+		"params": scriptParams,
+	}
+}
+
+// priceRangeClause filters a search request by its price range, in the
+// requested currency, on the effective price while promotions are active
+func priceRangeClause(searchReq *models.ProductSearchRequest, opts searchOptions) map[string]interface{} {
+	minPrice := opts.currency.toBase(searchReq.MinPrice)
+	maxPrice := opts.currency.toBase(searchReq.MaxPrice)
+
+	if opts.pricing == nil {
+		priceRange := map[string]interface{}{}
+		if searchReq.MinPrice > 0 {
+			priceRange["gte"] = minPrice
+		}
+		if searchReq.MaxPrice > 0 {
+			priceRange["lte"] = maxPrice
+		}
+		return map[string]interface{}{
+			"range": map[string]interface{}{
+				opts.currency.priceField(): priceRange,
+			},
+		}
+	}
+
+	conditions := []string{}
+	params := map[string]interface{}{}
+	if searchReq.MinPrice > 0 {
+		conditions = append(conditions, "effectiveBasePrice >= params.min_price")
+		params["min_price"] = minPrice
+	}
+	if searchReq.MaxPrice > 0 {
+		conditions = append(conditions, "effectiveBasePrice <= params.max_price")
+		params["max_price"] = maxPrice
+	}
+	return map[string]interface{}{
+		"script": map[string]interface{}{
+			"script": opts.pricing.script("return "+strings.Join(conditions, " && ")+";", params),
+		},
+	}
+}
+
+// priceSort orders by the effective price while promotions are active, or by
+// the list price, normalized to the base currency
+func priceSort(order string, opts searchOptions) map[string]interface{} {
+	if opts.pricing == nil {
+		return map[string]interface{}{opts.currency.priceField(): map[string]interface{}{"order": order}}
+	}
+	return map[string]interface{}{
+		"_script": map[string]interface{}{
+			"type":   "number",
+			"script": opts.pricing.script("return effectiveBasePrice;", nil),
+			"order":  order,
+		},
+	}
+}
+
+// boostFactor ranks the products of active promotions like promoted products.
+// Products flagged is_promoted already carry that boost in the formula.
+func (p *pricing) boostFactor() formulaFactor {
+	return formulaFactor{
+		script: promotionTargetsScript + `
+					double promotionBoost = 1.0;
+					if (!doc['is_promoted'].value) {
+						for (String target : promotionTargets) {
+							if (params.pricing.sale_price.containsKey(target) || params.pricing.percent_off.containsKey(target)) {
+								promotionBoost = params.ranking.promoted_boost;
+							}
+						}
+					}
+	`,
+		variable: "promotionBoost",
+		params:   map[string]interface{}{"pricing": p.params},
+	}
+}
+
+// priceSortedSearch lists the products matching the request by effective
+// price, ties broken by the scoring formula
+func (r *ProductRepository) priceSortedSearch(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions, from int, profile models.RankingProfile, factors []formulaFactor) ([]models.Product, int, error) {
+	order := "asc"
+	if searchReq.Sort == models.SortPriceDesc {
+		order = "desc"
+	}
+
+	return r.executeSearch(ctx, map[string]interface{}{
+		"query": buildScoringQuery(buildSearchQuery(searchReq, opts), profile, factors...),
+		"from":  from,
+		"size":  searchReq.PageSize,
+		"sort": []map[string]interface{}{
+			priceSort(order, opts),
+			{"_score": map[string]interface{}{"order": "desc"}},
+		},
+	})
+}
+
+// priceFacets counts the products matching the request in each price range of
+// the requested currency, by effective price. The request's own price filter
+// is left out so every range shows what selecting it would return.
+func (r *ProductRepository) priceFacets(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions) ([]models.PriceFacet, error) {
+	facetReq := *searchReq
+	facetReq.MinPrice = 0
+	facetReq.MaxPrice = 0
+
+	// Facets are reported in the requested currency and bucketed in the base currency
+	facets := make([]models.PriceFacet, 0, len(priceFacetBounds)+1)
+	ranges := make([]map[string]interface{}, 0, len(priceFacetBounds)+1)
+	from := 0.0
+	for _, bound := range priceFacetBounds {
+		to := opts.currency.facetBound(bound)
+		facets = append(facets, models.PriceFacet{Key: formatPrice(from) + "-" + formatPrice(to), From: from, To: to})
+		ranges = append(ranges, map[string]interface{}{"key": facets[len(facets)-1].Key, "from": opts.currency.toBase(from), "to": opts.currency.toBase(to)})
+		from = to
+	}
+	facets = append(facets, models.PriceFacet{Key: formatPrice(from) + "+", From: from})
+	ranges = append(ranges, map[string]interface{}{"key": facets[len(facets)-1].Key, "from": opts.currency.toBase(from)})
+
+	priceRange := map[string]interface{}{"ranges": ranges}
+	if opts.pricing != nil {
+		priceRange["script"] = opts.pricing.script("return effectiveBasePrice;", nil)
+	} else {
+		priceRange["field"] = opts.currency.priceField()
+	}
+
+	searchBody := map[string]interface{}{
+		"query": buildSearchQuery(&facetReq, opts),
+		"size":  0,
+		"aggs": map[string]interface{}{
+			"price": map[string]interface{}{"range": priceRange},
+		},
+	}
+	visibleOnly(searchBody)
+
+	var result struct {
+		Aggregations struct {
+			Price struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"price"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, fmt.Errorf("error computing price facets: %w", err)
+	}
+
+	counts := make(map[string]int, len(result.Aggregations.Price.Buckets))
+	for _, bucket := range result.Aggregations.Price.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+	for i := range facets {
+		facets[i].Count = counts[facets[i].Key]
+	}
+	return facets, nil
+}
+
+// formatPrice formats a facet boundary without trailing zeros
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
+
+// ApplyPromotions sets the sale of each product with an active promotion that
+// lowers its price, choosing the lowest promotional price
+func (r *ProductRepository) ApplyPromotions(ctx context.Context, products []models.Product) {
+	if r.promotions == nil || len(products) == 0 {
+		return
+	}
+	now := time.Now()
+	promotions, err := r.promotions.ActivePromotions(ctx, now)
+	if err != nil {
+		log.Printf("[PRODUCT] Failed to load active promotions, showing list prices: %v", err)
+		return
+	}
+	rates, err := r.activeRates(ctx)
+	if err != nil {
+		log.Printf("[PRODUCT] Failed to load exchange rates, showing list prices: %v", err)
+		return
+	}
+	taxonomy := r.activeTaxonomy(ctx)
+
+	for i := range products {
+		product := &products[i]
+		product.Sale = nil
+		for _, promotion := range promotions {
+			if !promotion.Targets(product, taxonomy) {
+				continue
+			}
+			price, ok := promotion.PriceFor(product, rates)
+			if !ok || price >= product.Price || (product.Sale != nil && price >= product.Sale.Price) {
+				continue
+			}
+			product.Sale = &models.Sale{
+				Price:       price,
+				PromotionID: promotion.ID,
+				EndsAt:      promotion.EndsAt,
+			}
+		}
+	}
+}
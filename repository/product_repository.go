@@ -4,34 +4,188 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"time"
 
+	"github.com/aditya/elasticsearch-products-api/embedding"
 	"github.com/aditya/elasticsearch-products-api/models"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/google/uuid"
 )
 
+// ErrProductNotFound is returned when a product ID does not exist
+var ErrProductNotFound = errors.New("product not found")
+
+// excludedSourceFields are indexed for search but never returned by the API
+var excludedSourceFields = []string{"embedding"}
+
 type ProductRepository struct {
 	client    *elasticsearch.Client
 	indexName string
+	embedder  embedding.Embedder
+
+	// cached category matcher used by query understanding
+	categories *refreshCache[*categoryMatcher]
+
+	// constants of the scoring formula, unless a request carries its own
+	ranking models.RankingProfile
+
+	// optional trending signal for ranking and the trending fallback
+	trending TrendingScorer
+
+	// optional new-arrival boost and the age limit of the new_arrivals listing
+	freshness         Freshness
+	newArrivalsPeriod time.Duration
+
+	// optional per-user affinity profiles for personalized ranking
+	profiles ProfileStore
+
+	// optional learning-to-rank feature logging for sampled searches
+	featureLog        *FeatureLogRepository
+	featureSampleRate float64
+	featureSlots      chan struct{}
+
+	// optional promotions pricing products by their effective (sale) price
+	promotions PromotionSource
+
+	// optional exchange rates normalizing prices to the base currency
+	currencies RateSource
+
+	// optional category taxonomy for hierarchical category filters and facets
+	taxonomy TaxonomySource
+
+	// optional version history, written as part of every change
+	history ProductHistory
+
+	// notified after every create, update and delete, e.g. to match saved
+	// search alerts or call webhooks
+	listeners []ProductListener
+}
+
+// ProductListener is notified after a product is created, updated or deleted.
+// before is nil for a new product and after is nil for a deleted one.
+type ProductListener interface {
+	HandleProductChange(ctx context.Context, before, after *models.Product) error
 }
 
-func NewProductRepository(client *elasticsearch.Client, indexName string) *ProductRepository {
+// TrendingScorer provides the current trending score by product ID, and the
+// top trending products among a set of products
+type TrendingScorer interface {
+	TrendingScores(ctx context.Context) (map[string]float64, error)
+	TrendingAmong(ctx context.Context, productIDs []string) ([]models.TrendingScore, error)
+}
+
+func NewProductRepository(client *elasticsearch.Client, indexName string, embedder embedding.Embedder) *ProductRepository {
 	return &ProductRepository{
-		client:    client,
-		indexName: indexName,
+		client:     client,
+		indexName:  indexName,
+		embedder:   embedder,
+		categories: newRefreshCache[*categoryMatcher](categoryCacheTTL),
+		ranking:    DefaultRankingProfile(),
 	}
 }
 
+// SetRankingProfile sets the default constants of the scoring formula
+func (r *ProductRepository) SetRankingProfile(profile models.RankingProfile) {
+	r.ranking = profile
+}
+
+// SetProductListeners registers the listeners notified of product changes
+func (r *ProductRepository) SetProductListeners(listeners ...ProductListener) {
+	r.listeners = listeners
+}
+
+// notifyListeners passes a product change to the listeners. Listener failures
+// are logged and do not fail the request, since the product is stored.
+func (r *ProductRepository) notifyListeners(ctx context.Context, before, after *models.Product) {
+	for _, listener := range r.listeners {
+		if err := listener.HandleProductChange(ctx, before, after); err != nil {
+			log.Printf("[PRODUCT] Listener failed for product change: %v", err)
+		}
+	}
+}
+
+// SetTrending enables trending data: a positive trending weight in the ranking
+// profile adds a trending factor, and the zero-results fallback lists trending products
+func (r *ProductRepository) SetTrending(scorer TrendingScorer) {
+	r.trending = scorer
+}
+
+// productDocument is the indexed form of a product, including fields derived
+// at index time that are not part of the API model
+type productDocument struct {
+	*models.Product
+	Embedding     []float32 `json:"embedding,omitempty"`
+	BasePrice     *float64  `json:"base_price,omitempty"`     // price in the base currency
+	CategoryPaths []string  `json:"category_paths,omitempty"` // e.g. ["electronics", "electronics/audio"]
+}
+
+// marshalDocument builds the indexed JSON for a product, computing its
+// embedding, base currency price and category paths
+func (r *ProductRepository) marshalDocument(ctx context.Context, product *models.Product) ([]byte, error) {
+	doc, err := r.document(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+	if r.embedder != nil {
+		vector, err := r.embedder.Embed(product.Name + " " + product.Description + " " + product.Category)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding product: %w", err)
+		}
+		doc.Embedding = vector
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling product: %w", err)
+	}
+	return data, nil
+}
+
+// document returns the indexed form of a product with its base currency price
+// and category paths, but without the embedding
+func (r *ProductRepository) document(ctx context.Context, product *models.Product) (*productDocument, error) {
+	doc := &productDocument{Product: product}
+	if r.taxonomy != nil {
+		taxonomy, err := r.taxonomy.Taxonomy(ctx)
+		if err != nil {
+			return nil, err
+		}
+		doc.CategoryPaths = taxonomy.Paths(product.Category)
+	}
+	if r.currencies != nil {
+		rates, err := r.currencies.Rates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		basePrice, ok := rates.ToBase(product.Price, product.Currency)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCurrency, product.Currency)
+		}
+		doc.BasePrice = &basePrice
+	}
+	return doc, nil
+}
+
 // Create creates a new product
 func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
+	if err := prepareLifecycle(product, nil, time.Now()); err != nil {
+		return err
+	}
+	if err := r.prepareCurrency(ctx, product); err != nil {
+		return err
+	}
+
 	product.ID = uuid.New().String()
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
+	product.DeletedAt = nil
+	product.Sale = nil
+	product.Converted = nil
 
 	data, err := json.Marshal(product)
 	if err != nil {
@@ -40,10 +194,15 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 
 	log.Printf("[ES] CREATE - Index: %s, DocumentID: %s, Body: %s", r.indexName, product.ID, string(data))
 
+	body, err := r.marshalDocument(ctx, product)
+	if err != nil {
+		return err
+	}
+
 	req := esapi.IndexRequest{
 		Index:      r.indexName,
 		DocumentID: product.ID,
-		Body:       bytes.NewReader(data),
+		Body:       bytes.NewReader(body),
 		Refresh:    "true",
 	}
 
@@ -60,16 +219,42 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 		return fmt.Errorf("error response: %s", string(resBody))
 	}
 
-	return nil
+	return r.recordChange(ctx, nil, product)
 }
 
-// GetByID retrieves a product by ID
+// GetByID retrieves a product by ID; products in the trash are not found
 func (r *ProductRepository) GetByID(ctx context.Context, id string) (*models.Product, error) {
+	product, err := r.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product.DeletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+// GetLive retrieves a product shoppers can see; drafts, archived products and
+// products past their unpublish_at are not found
+func (r *ProductRepository) GetLive(ctx context.Context, id string) (*models.Product, error) {
+	product, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !product.IsLive(time.Now()) {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+// get retrieves a product by ID, including a product in the trash
+func (r *ProductRepository) get(ctx context.Context, id string) (*models.Product, error) {
 	log.Printf("[ES] GET - Index: %s, DocumentID: %s", r.indexName, id)
 
 	req := esapi.GetRequest{
-		Index:      r.indexName,
-		DocumentID: id,
+		Index:          r.indexName,
+		DocumentID:     id,
+		SourceExcludes: excludedSourceFields,
 	}
 
 	res, err := req.Do(ctx, r.client)
@@ -83,7 +268,7 @@ func (r *ProductRepository) GetByID(ctx context.Context, id string) (*models.Pro
 
 	if res.IsError() {
 		if res.StatusCode == 404 {
-			return nil, fmt.Errorf("product not found")
+			return nil, ErrProductNotFound
 		}
 		return nil, fmt.Errorf("error response: %s", string(resBody))
 	}
@@ -107,16 +292,74 @@ func (r *ProductRepository) GetByID(ctx context.Context, id string) (*models.Pro
 	return &product, nil
 }
 
+// GetByIDs retrieves several products by ID; missing and trashed IDs are skipped
+func (r *ProductRepository) GetByIDs(ctx context.Context, ids []string) ([]models.Product, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"ids": ids}); err != nil {
+		return nil, fmt.Errorf("error encoding mget body: %w", err)
+	}
+
+	log.Printf("[ES] MGET - Index: %s, DocumentIDs: %v", r.indexName, ids)
+
+	res, err := r.client.Mget(
+		&buf,
+		r.client.Mget.WithContext(ctx),
+		r.client.Mget.WithIndex(r.indexName),
+		r.client.Mget.WithSourceExcludes(excludedSourceFields...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting products: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Docs []struct {
+			Found  bool           `json:"found"`
+			Source models.Product `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	products := make([]models.Product, 0, len(result.Docs))
+	for _, doc := range result.Docs {
+		if doc.Found && doc.Source.DeletedAt == nil {
+			products = append(products, doc.Source)
+		}
+	}
+	return products, nil
+}
+
 // Update updates an existing product
 func (r *ProductRepository) Update(ctx context.Context, id string, product *models.Product) error {
 	// First check if product exists
-	_, err := r.GetByID(ctx, id)
+	existing, err := r.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
+	if err := prepareLifecycle(product, existing, time.Now()); err != nil {
+		return err
+	}
+	if err := r.prepareCurrency(ctx, product); err != nil {
+		return err
+	}
 
 	product.ID = id
+	product.CreatedAt = existing.CreatedAt
 	product.UpdatedAt = time.Now()
+	product.DeletedAt = nil
+	product.Sale = nil
+	product.Converted = nil
 
 	data, err := json.Marshal(product)
 	if err != nil {
@@ -125,10 +368,15 @@ func (r *ProductRepository) Update(ctx context.Context, id string, product *mode
 
 	log.Printf("[ES] UPDATE - Index: %s, DocumentID: %s, Body: %s", r.indexName, id, string(data))
 
+	body, err := r.marshalDocument(ctx, product)
+	if err != nil {
+		return err
+	}
+
 	req := esapi.IndexRequest{
 		Index:      r.indexName,
 		DocumentID: id,
-		Body:       bytes.NewReader(data),
+		Body:       bytes.NewReader(body),
 		Refresh:    "true",
 	}
 
@@ -145,40 +393,98 @@ func (r *ProductRepository) Update(ctx context.Context, id string, product *mode
 		return fmt.Errorf("error response: %s", string(resBody))
 	}
 
-	return nil
+	return r.recordChange(ctx, existing, product)
 }
 
-// Delete deletes a product by ID
-func (r *ProductRepository) Delete(ctx context.Context, id string) error {
-	log.Printf("[ES] DELETE - Index: %s, DocumentID: %s", r.indexName, id)
+// SaveVersion writes a previous version of a product back under its ID,
+// recreating the product if it was deleted since
+func (r *ProductRepository) SaveVersion(ctx context.Context, product *models.Product) error {
+	existing, err := r.GetByID(ctx, product.ID)
+	if err != nil && !errors.Is(err, ErrProductNotFound) {
+		return err
+	}
+	if err := prepareLifecycle(product, existing, time.Now()); err != nil {
+		return err
+	}
+	if err := r.prepareCurrency(ctx, product); err != nil {
+		return err
+	}
+
+	product.UpdatedAt = time.Now()
+	product.DeletedAt = nil
+	product.Sale = nil
+	product.Converted = nil
+
+	log.Printf("[ES] SAVE VERSION - Index: %s, DocumentID: %s", r.indexName, product.ID)
 
-	req := esapi.DeleteRequest{
+	body, err := r.marshalDocument(ctx, product)
+	if err != nil {
+		return err
+	}
+
+	req := esapi.IndexRequest{
 		Index:      r.indexName,
-		DocumentID: id,
+		DocumentID: product.ID,
+		Body:       bytes.NewReader(body),
 		Refresh:    "true",
 	}
 
 	res, err := req.Do(ctx, r.client)
 	if err != nil {
-		return fmt.Errorf("error deleting product: %w", err)
+		return fmt.Errorf("error saving product version: %w", err)
 	}
 	defer res.Body.Close()
 
-	resBody, _ := io.ReadAll(res.Body)
-	log.Printf("[ES] DELETE RESPONSE - Status: %d, Response: %s", res.StatusCode, string(resBody))
-
 	if res.IsError() {
-		if res.StatusCode == 404 {
-			return fmt.Errorf("product not found")
-		}
+		resBody, _ := io.ReadAll(res.Body)
 		return fmt.Errorf("error response: %s", string(resBody))
 	}
 
-	return nil
+	return r.recordChange(ctx, existing, product)
+}
+
+// Delete moves a product to the trash. It is hidden from reads and search
+// until restored, and purged once the trash retention has passed.
+func (r *ProductRepository) Delete(ctx context.Context, id string) error {
+	// Listeners receive the last version of the product
+	existing, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now()
+	if err := r.setDeletedAt(ctx, id, &deletedAt); err != nil {
+		return err
+	}
+
+	return r.recordChange(ctx, existing, nil)
 }
 
 // Search searches for products based on criteria
 func (r *ProductRepository) Search(ctx context.Context, searchReq *models.ProductSearchRequest) ([]models.Product, int, error) {
+	opts, err := r.requestOptions(ctx, searchReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r.search(ctx, searchReq, opts)
+}
+
+// requestOptions returns the search options that depend on catalog state: the
+// active promotions, the conversion to the requested currency and the taxonomy
+func (r *ProductRepository) requestOptions(ctx context.Context, searchReq *models.ProductSearchRequest) (searchOptions, error) {
+	conversion, err := r.currencyConversion(ctx, searchReq.Currency)
+	if err != nil {
+		return searchOptions{}, err
+	}
+	return searchOptions{
+		pricing:  r.activePricing(ctx),
+		currency: conversion,
+		taxonomy: r.activeTaxonomy(ctx),
+	}, nil
+}
+
+// search runs a search request with the given query options
+func (r *ProductRepository) search(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions) ([]models.Product, int, error) {
 	// Set default pagination
 	if searchReq.Page < 1 {
 		searchReq.Page = 1
@@ -188,119 +494,241 @@ func (r *ProductRepository) Search(ctx context.Context, searchReq *models.Produc
 	}
 
 	from := (searchReq.Page - 1) * searchReq.PageSize
+	profile := r.rankingProfile(searchReq)
+	factors := r.rankingFactors(ctx, searchReq.UserID, profile)
+	if opts.pricing != nil {
+		factors = append(factors, opts.pricing.boostFactor())
+	}
+
+	products, total, err := r.rankedSearch(ctx, searchReq, opts, from, profile, factors)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r.logFeatures(searchReq, opts, profile, factors, products, from)
+	if searchReq.Currency != "" {
+		opts.currency.apply(products)
+	}
+	return products, total, nil
+}
+
+// rankedSearch runs the retrieval and ranking strategy selected by the request
+func (r *ProductRepository) rankedSearch(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions, from int, profile models.RankingProfile, factors []formulaFactor) ([]models.Product, int, error) {
+	// New arrivals are listed newest first rather than by relevance
+	if searchReq.Sort == models.SortNewArrivals {
+		return r.newArrivalsSearch(ctx, searchReq, opts, from, profile, factors)
+	}
+	if searchReq.Sort == models.SortPriceAsc || searchReq.Sort == models.SortPriceDesc {
+		return r.priceSortedSearch(ctx, searchReq, opts, from, profile, factors)
+	}
+
+	scoringQuery := buildScoringQuery(buildSearchQuery(searchReq, opts), profile, factors...)
+
+	// Hybrid mode fuses keyword and vector candidates before business scoring
+	if searchReq.Mode == models.SearchModeHybrid && searchReq.Query != "" && opts.advancedQuery == nil {
+		var err error
+		scoringQuery, err = r.hybridScoringQuery(ctx, searchReq, opts, profile, factors)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if searchReq.Diversify {
+		return r.searchDiversified(ctx, scoringQuery, from, searchReq.PageSize, searchReq.MaxPerCategory)
+	}
+
+	return r.scoredSearch(ctx, scoringQuery, from, searchReq.PageSize)
+}
+
+// rankingProfile returns the profile of the request (e.g. an experiment
+// variant), or the default profile
+func (r *ProductRepository) rankingProfile(searchReq *models.ProductSearchRequest) models.RankingProfile {
+	if searchReq.Ranking != nil {
+		return *searchReq.Ranking
+	}
+	return r.ranking
+}
+
+// rankingFactors returns the optional signals the profile enables for the
+// scoring formula; userID is empty for anonymous requests
+func (r *ProductRepository) rankingFactors(ctx context.Context, userID string, profile models.RankingProfile) []formulaFactor {
+	var factors []formulaFactor
+
+	if r.trending != nil && profile.TrendingWeight > 0 {
+		scores, err := r.trending.TrendingScores(ctx)
+		if err != nil {
+			log.Printf("[SEARCH] Failed to load trending scores, ranking without them: %v", err)
+		} else if len(scores) > 0 {
+			factors = append(factors, trendingFactor(scores, profile.TrendingWeight))
+		}
+	}
+
+	if profile.FreshnessWeight > 0 {
+		factors = append(factors, freshnessFactor(r.freshness, profile.FreshnessWeight, time.Now()))
+	}
+
+	if factor, ok := r.userAffinityFactor(ctx, userID, profile); ok {
+		factors = append(factors, factor)
+	}
+
+	return factors
+}
 
-	// Build query
-	var query map[string]interface{}
+// Fields matched by free-text terms and by quoted phrases
+var (
+	textSearchFields   = []string{"name.autocomplete^3", "name^2", "description.autocomplete", "description"}
+	phraseSearchFields = []string{"name^2", "description"}
+)
+
+// searchOptions tweaks how a search request is turned into a query
+type searchOptions struct {
+	// advancedQuery replaces the text match with a translated advanced syntax query
+	advancedQuery map[string]interface{}
+
+	// relaxText loosens the text match (used by the zero-results fallback)
+	relaxText bool
+
+	// boostCategory ranks products of this category higher without filtering
+	boostCategory string
+
+	// pricing holds the active promotions; nil filters and sorts by list price
+	pricing *pricing
+
+	// currency converts prices to and from the requested currency; nil
+	// compares the stored prices as they are (e.g. for alerts)
+	currency *currencyConversion
+
+	// taxonomy matches categories by path, including subcategories; nil
+	// matches the flat category (e.g. for alerts)
+	taxonomy models.Taxonomy
+}
 
+// buildSearchQuery builds the retrieval query (text match and filters) for a search request
+func buildSearchQuery(searchReq *models.ProductSearchRequest, opts searchOptions) map[string]interface{} {
 	mustClauses := []map[string]interface{}{}
 
 	// Text search on name and description with edge n-grams for autocomplete and fuzzy matching
-	if searchReq.Query != "" {
+	if opts.advancedQuery != nil {
+		mustClauses = append(mustClauses, opts.advancedQuery)
+	} else if searchReq.Query != "" {
+		multiMatch := map[string]interface{}{
+			"query":     searchReq.Query,
+			"fields":    textSearchFields,
+			"fuzziness": "AUTO",
+			"type":      "best_fields",
+		}
+		if opts.relaxText {
+			// Any single term may match, with wider typo tolerance summed across fields
+			multiMatch["type"] = "most_fields"
+			multiMatch["operator"] = "or"
+			multiMatch["minimum_should_match"] = "1"
+			multiMatch["fuzziness"] = 2
+			multiMatch["prefix_length"] = 0
+		}
 		mustClauses = append(mustClauses, map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":     searchReq.Query,
-				"fields":    []string{"name.autocomplete^3", "name^2", "description.autocomplete", "description"},
-				"fuzziness": "AUTO",
-				"type":      "best_fields",
-			},
+			"multi_match": multiMatch,
 		})
 	}
 
-	// Category filter
+	return buildBoolQuery(append(mustClauses, buildFilterClauses(searchReq, opts)...), opts)
+}
+
+// buildFilterClauses builds the category, price and stock filters of a search request
+func buildFilterClauses(searchReq *models.ProductSearchRequest, opts searchOptions) []map[string]interface{} {
+	filterClauses := []map[string]interface{}{}
+
+	// Category filter, including subcategories
 	if searchReq.Category != "" {
-		mustClauses = append(mustClauses, map[string]interface{}{
+		field, value := categoryTerm(searchReq.Category, opts)
+		filterClauses = append(filterClauses, map[string]interface{}{
 			"term": map[string]interface{}{
-				"category": searchReq.Category,
+				field: value,
 			},
 		})
 	}
 
-	// Price range filter
+	// Price range filter, on the sale price during promotions
 	if searchReq.MinPrice > 0 || searchReq.MaxPrice > 0 {
-		priceRange := map[string]interface{}{}
-		if searchReq.MinPrice > 0 {
-			priceRange["gte"] = searchReq.MinPrice
-		}
-		if searchReq.MaxPrice > 0 {
-			priceRange["lte"] = searchReq.MaxPrice
-		}
-		mustClauses = append(mustClauses, map[string]interface{}{
+		filterClauses = append(filterClauses, priceRangeClause(searchReq, opts))
+	}
+
+	// In-stock filter
+	if searchReq.InStock {
+		filterClauses = append(filterClauses, map[string]interface{}{
 			"range": map[string]interface{}{
-				"price": priceRange,
+				"stock": map[string]interface{}{"gt": 0},
 			},
 		})
 	}
 
-	if len(mustClauses) > 0 {
-		query = map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": mustClauses,
-			},
-		}
-	} else {
-		query = map[string]interface{}{
+	return filterClauses
+}
+
+// buildBoolQuery combines the must clauses of a search with optional boosts
+func buildBoolQuery(mustClauses []map[string]interface{}, opts searchOptions) map[string]interface{} {
+	if len(mustClauses) == 0 {
+		return map[string]interface{}{
 			"match_all": map[string]interface{}{},
 		}
 	}
 
-	// Apply enhanced ecommerce scoring formula
-	// Components:
-	// 1. Base relevance (_score from text matching)
-	// 2. Stock availability (in-stock boost, out-of-stock penalty)
-	// 3. Rating boost (higher rated products rank higher)
-	// 4. Social proof (review count logarithmic boost)
-	// 5. Popularity (sales count logarithmic boost)
-	// 6. Engagement (CTR and view count)
-	// 7. Business rules (promoted products, margin)
-	scoringQuery := map[string]interface{}{
-		"script_score": map[string]interface{}{
-			"query": query,
-			"script": map[string]interface{}{
-				"source": `
-					// Base relevance score from text matching
-					double baseScore = _score;
-					
-					// Stock availability: out-of-stock = 0.3x penalty, in-stock = 1.0x
-					double stockMultiplier = doc['stock'].value > 0 ? 1.0 : 0.3;
-					
-					// Rating boost: normalize 0-5 rating to 0.6-1.2 multiplier
-					// (3 stars = 1.0x, 5 stars = 1.2x, 0 stars = 0.6x)
-					double ratingBoost = doc['review_count'].value > 0 
-						? 0.6 + (doc['rating'].value / 5.0) * 0.6 
-						: 1.0;
-					
-					// Social proof: logarithmic boost from review count
-					// More reviews = more trust (diminishing returns)
-					double reviewBoost = 1.0 + Math.log10(doc['review_count'].value + 1) * 0.1;
-					
-					// Popularity: logarithmic boost from sales count
-					// Best sellers rank higher
-					double popularityBoost = 1.0 + Math.log10(doc['sales_count'].value + 1) * 0.15;
-					
-					// Engagement: CTR and view count combined
-					// High CTR = users find it relevant
-					double engagementBoost = 1.0 + (doc['ctr'].value * 0.2) + (Math.log10(doc['view_count'].value + 1) * 0.05);
-					
-					// Business boost: promoted products + margin consideration
-					// Promoted products get 1.3x boost, high margin products get slight boost
-					double businessBoost = (doc['is_promoted'].value ? 1.3 : 1.0) * (1.0 + doc['margin'].value * 0.1);
-					
-					// Final score: combine all signals
-					return baseScore * stockMultiplier * ratingBoost * reviewBoost * popularityBoost * engagementBoost * businessBoost;
-				`,
+	boolQuery := map[string]interface{}{
+		"must": mustClauses,
+	}
+
+	// Category boost from query understanding
+	if opts.boostCategory != "" {
+		field, value := categoryTerm(opts.boostCategory, opts)
+		boolQuery["should"] = []map[string]interface{}{
+			{
+				"term": map[string]interface{}{
+					field: map[string]interface{}{
+						"value": value,
+						"boost": 2.0,
+					},
+				},
 			},
-		},
+		}
+	}
+
+	return map[string]interface{}{
+		"bool": boolQuery,
 	}
+}
 
+// scoredSearch runs a scoring query for the given page window
+func (r *ProductRepository) scoredSearch(ctx context.Context, scoringQuery map[string]interface{}, from, size int) ([]models.Product, int, error) {
 	searchBody := map[string]interface{}{
 		"query": scoringQuery,
 		"from":  from,
-		"size":  searchReq.PageSize,
+		"size":  size,
 		"sort": []map[string]interface{}{
 			{"_score": map[string]interface{}{"order": "desc"}},
 		},
 	}
 
+	return r.executeSearch(ctx, searchBody)
+}
+
+// executeSearch runs a search over the visible products and decodes the hits
+// with their sale prices
+func (r *ProductRepository) executeSearch(ctx context.Context, searchBody map[string]interface{}) ([]models.Product, int, error) {
+	visibleOnly(searchBody)
+	products, total, err := r.searchProducts(ctx, searchBody)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.ApplyPromotions(ctx, products)
+	return products, total, nil
+}
+
+// searchProducts sends a search body to Elasticsearch and decodes the product hits
+func (r *ProductRepository) searchProducts(ctx context.Context, searchBody map[string]interface{}) ([]models.Product, int, error) {
+	// Index-time fields such as the embedding are never returned
+	if _, ok := searchBody["_source"]; !ok {
+		searchBody["_source"] = map[string]interface{}{"excludes": excludedSourceFields}
+	}
+
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
 		return nil, 0, fmt.Errorf("error encoding search query: %w", err)
@@ -364,3 +792,42 @@ func (r *ProductRepository) GetAll(ctx context.Context, page, pageSize int) ([]m
 	}
 	return r.Search(ctx, searchReq)
 }
+
+// updateByQuery runs a script over the products matching a query and returns
+// how many were updated; action names the update in the log
+func (r *ProductRepository) updateByQuery(ctx context.Context, action string, query, script map[string]interface{}) (int, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"query":  query,
+		"script": script,
+	}); err != nil {
+		return 0, fmt.Errorf("error encoding update by query: %w", err)
+	}
+
+	log.Printf("[ES] %s - Index: %s, Query: %v", action, r.indexName, query)
+
+	res, err := r.client.UpdateByQuery(
+		[]string{r.indexName},
+		r.client.UpdateByQuery.WithContext(ctx),
+		r.client.UpdateByQuery.WithBody(&buf),
+		r.client.UpdateByQuery.WithConflicts("proceed"),
+		r.client.UpdateByQuery.WithRefresh(true),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error updating products: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return 0, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Updated int `json:"updated"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return 0, fmt.Errorf("error decoding response: %w", err)
+	}
+	return result.Updated, nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// ProfileStore persists per-user affinity profiles
+type ProfileStore interface {
+	// Get returns the profile of a user, or nil when the user has none
+	Get(ctx context.Context, userID string) (*models.UserProfile, error)
+
+	// Update applies fn to the profile of a user, creating an empty profile
+	// first when needed. Updates of the same user must not interleave.
+	Update(ctx context.Context, userID string, fn func(profile *models.UserProfile)) error
+}
+
+// MemoryProfileStore keeps profiles in process memory. When full, the least
+// recently updated profile is evicted. Profiles are lost on restart.
+type MemoryProfileStore struct {
+	mu       sync.Mutex
+	profiles map[string]*models.UserProfile
+	maxUsers int
+}
+
+func NewMemoryProfileStore(maxUsers int) *MemoryProfileStore {
+	return &MemoryProfileStore{
+		profiles: make(map[string]*models.UserProfile),
+		maxUsers: maxUsers,
+	}
+}
+
+// Get returns a copy of the profile of a user, or nil when the user has none
+func (s *MemoryProfileStore) Get(ctx context.Context, userID string) (*models.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile, ok := s.profiles[userID]
+	if !ok {
+		return nil, nil
+	}
+	return cloneProfile(profile), nil
+}
+
+// Update applies fn to the profile of a user under the store lock
+func (s *MemoryProfileStore) Update(ctx context.Context, userID string, fn func(profile *models.UserProfile)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile, ok := s.profiles[userID]
+	if !ok {
+		if s.maxUsers > 0 && len(s.profiles) >= s.maxUsers {
+			s.evictOldest()
+		}
+		profile = &models.UserProfile{
+			UserID:     userID,
+			Categories: make(map[string]float64),
+			PriceBands: make(map[string]float64),
+		}
+		s.profiles[userID] = profile
+	}
+
+	fn(profile)
+	profile.UpdatedAt = time.Now()
+	return nil
+}
+
+// evictOldest removes the least recently updated profile
+func (s *MemoryProfileStore) evictOldest() {
+	var oldestID string
+	var oldest time.Time
+	for id, profile := range s.profiles {
+		if oldestID == "" || profile.UpdatedAt.Before(oldest) {
+			oldestID = id
+			oldest = profile.UpdatedAt
+		}
+	}
+	delete(s.profiles, oldestID)
+}
+
+func cloneProfile(profile *models.UserProfile) *models.UserProfile {
+	clone := *profile
+	clone.Categories = make(map[string]float64, len(profile.Categories))
+	for category, score := range profile.Categories {
+		clone.Categories[category] = score
+	}
+	clone.PriceBands = make(map[string]float64, len(profile.PriceBands))
+	for band, score := range profile.PriceBands {
+		clone.PriceBands[band] = score
+	}
+	return &clone
+}
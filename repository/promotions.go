@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxPromotions caps the promotions loaded per listing and per refresh of
+	// the active promotions
+	maxPromotions = 1000
+
+	// activePromotionsTTL is how long the current and upcoming promotions are
+	// cached between searches. Writes through the repository clear the cache.
+	activePromotionsTTL = 30 * time.Second
+)
+
+var (
+	// ErrPromotionNotFound is returned when a promotion ID does not exist
+	ErrPromotionNotFound = errors.New("promotion not found")
+
+	// ErrInvalidPromotion is returned for a promotion without a discount,
+	// targets or a valid window
+	ErrInvalidPromotion = errors.New("invalid promotion")
+)
+
+// PromotionRepository stores time-boxed promotions. Searches price products by
+// the promotions active at the time, so nothing is written to the products index.
+type PromotionRepository struct {
+	client     *elasticsearch.Client
+	indexName  string
+	currencies RateSource
+
+	// cached promotions that have not ended yet
+	mu         sync.Mutex
+	cache      []models.Promotion
+	cachedAt   time.Time
+	generation int           // bumped by writes, so a refresh racing a write is not cached
+	refreshing chan struct{} // closed when the running refresh ends; nil when none runs
+}
+
+func NewPromotionRepository(client *elasticsearch.Client, indexName string) *PromotionRepository {
+	return &PromotionRepository{
+		client:    client,
+		indexName: indexName,
+	}
+}
+
+// SetCurrencies checks the currency of sale prices against the rates table
+func (r *PromotionRepository) SetCurrencies(source RateSource) {
+	r.currencies = source
+}
+
+// prepareCurrency defaults the currency of a sale price to the base currency
+// and checks that it is in the rates table. Percentages have no currency.
+func (r *PromotionRepository) prepareCurrency(ctx context.Context, promotion *models.Promotion) error {
+	promotion.Currency = strings.ToUpper(promotion.Currency)
+	if promotion.SalePrice <= 0 {
+		promotion.Currency = ""
+		return nil
+	}
+	if r.currencies == nil {
+		return nil
+	}
+	rates, err := r.currencies.Rates(ctx)
+	if err != nil {
+		return err
+	}
+
+	if promotion.Currency == "" {
+		promotion.Currency = rates.Base
+	}
+	if _, ok := rates.Lookup(promotion.Currency); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCurrency, promotion.Currency)
+	}
+	return nil
+}
+
+// validatePromotion checks the discount, targets and window of a promotion
+func validatePromotion(promotion *models.Promotion) error {
+	if (promotion.SalePrice > 0) == (promotion.PercentOff > 0) {
+		return fmt.Errorf("%w: exactly one of sale_price and percent_off is required", ErrInvalidPromotion)
+	}
+	if len(promotion.ProductIDs) == 0 && len(promotion.Categories) == 0 {
+		return fmt.Errorf("%w: product_ids or categories is required", ErrInvalidPromotion)
+	}
+	if !promotion.EndsAt.After(promotion.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromotion)
+	}
+	return nil
+}
+
+// Create stores a new promotion
+func (r *PromotionRepository) Create(ctx context.Context, promotion *models.Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	if err := r.prepareCurrency(ctx, promotion); err != nil {
+		return err
+	}
+
+	promotion.ID = uuid.New().String()
+	promotion.CreatedAt = time.Now()
+	promotion.UpdatedAt = promotion.CreatedAt
+
+	log.Printf("[ES] CREATE PROMOTION - Index: %s, DocumentID: %s, Name: %s", r.indexName, promotion.ID, promotion.Name)
+	return r.put(ctx, promotion)
+}
+
+// Update replaces a promotion, keeping its creation time
+func (r *PromotionRepository) Update(ctx context.Context, id string, promotion *models.Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	if err := r.prepareCurrency(ctx, promotion); err != nil {
+		return err
+	}
+
+	existing, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	promotion.ID = id
+	promotion.CreatedAt = existing.CreatedAt
+	promotion.UpdatedAt = time.Now()
+
+	log.Printf("[ES] UPDATE PROMOTION - Index: %s, DocumentID: %s, Name: %s", r.indexName, id, promotion.Name)
+	return r.put(ctx, promotion)
+}
+
+// put indexes a promotion and clears the active promotions cache
+func (r *PromotionRepository) put(ctx context.Context, promotion *models.Promotion) error {
+	data, err := json.Marshal(promotion)
+	if err != nil {
+		return fmt.Errorf("error marshaling promotion: %w", err)
+	}
+
+	req := esapi.IndexRequest{
+		Index:      r.indexName,
+		DocumentID: promotion.ID,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing promotion: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// Get returns a promotion by ID
+func (r *PromotionRepository) Get(ctx context.Context, id string) (*models.Promotion, error) {
+	req := esapi.GetRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return nil, fmt.Errorf("error getting promotion: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return nil, ErrPromotionNotFound
+		}
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Source models.Promotion `json:"_source"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return &result.Source, nil
+}
+
+// List returns the promotions, latest start first. activeOnly limits the
+// list to the promotions running now.
+func (r *PromotionRepository) List(ctx context.Context, activeOnly bool) ([]models.Promotion, error) {
+	searchBody := map[string]interface{}{
+		"size": maxPromotions,
+		"sort": []map[string]interface{}{
+			{"starts_at": map[string]interface{}{"order": "desc"}},
+		},
+	}
+	if activeOnly {
+		now := time.Now()
+		searchBody["query"] = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{
+					{"range": map[string]interface{}{"starts_at": map[string]interface{}{"lte": now}}},
+					{"range": map[string]interface{}{"ends_at": map[string]interface{}{"gt": now}}},
+				},
+			},
+		}
+	}
+	return r.search(ctx, searchBody)
+}
+
+// Delete removes a promotion
+func (r *PromotionRepository) Delete(ctx context.Context, id string) error {
+	log.Printf("[ES] DELETE PROMOTION - Index: %s, DocumentID: %s", r.indexName, id)
+
+	req := esapi.DeleteRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error deleting promotion: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return ErrPromotionNotFound
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	r.invalidate()
+	return nil
+}
+
+// ActivePromotions returns the promotions running at a time. Promotions that
+// have not ended are cached, so a cached promotion starts on time.
+func (r *PromotionRepository) ActivePromotions(ctx context.Context, now time.Time) ([]models.Promotion, error) {
+	pending, err := r.pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []models.Promotion{}
+	for _, promotion := range pending {
+		if promotion.ActiveAt(now) {
+			active = append(active, promotion)
+		}
+	}
+	return active, nil
+}
+
+// pending returns the promotions that have not ended, refreshing the cache
+// when it is stale. The lock is never held across the search: one caller
+// refreshes while the others keep using the stale cache, or wait for the
+// refresh when a write cleared it.
+func (r *PromotionRepository) pending(ctx context.Context) ([]models.Promotion, error) {
+	for {
+		r.mu.Lock()
+		if r.cache != nil && (r.refreshing != nil || time.Since(r.cachedAt) <= activePromotionsTTL) {
+			cache := r.cache
+			r.mu.Unlock()
+			return cache, nil
+		}
+		if wait := r.refreshing; wait != nil {
+			r.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		r.refreshing = done
+		generation := r.generation
+		r.mu.Unlock()
+
+		// Oldest start first, so the cap drops far-future promotions rather
+		// than running ones
+		pending, err := r.search(ctx, map[string]interface{}{
+			"query": map[string]interface{}{
+				"range": map[string]interface{}{
+					"ends_at": map[string]interface{}{"gt": time.Now()},
+				},
+			},
+			"size": maxPromotions,
+			"sort": []map[string]interface{}{
+				{"starts_at": map[string]interface{}{"order": "asc"}},
+			},
+		})
+
+		r.mu.Lock()
+		r.refreshing = nil
+		close(done)
+		if err == nil && generation == r.generation {
+			r.cache = pending
+			r.cachedAt = time.Now()
+		}
+		r.mu.Unlock()
+		return pending, err
+	}
+}
+
+// invalidate clears the active promotions cache after a write
+func (r *PromotionRepository) invalidate() {
+	r.mu.Lock()
+	r.cache = nil
+	r.generation++
+	r.mu.Unlock()
+}
+
+// search runs a search over the promotions index
+func (r *PromotionRepository) search(ctx context.Context, searchBody map[string]interface{}) ([]models.Promotion, error) {
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.Promotion `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	promotions := make([]models.Promotion, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		promotions = append(promotions, hit.Source)
+	}
+	return promotions, nil
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// categoryCacheTTL controls how often the known category terms are refreshed
+const categoryCacheTTL = 5 * time.Minute
+
+var (
+	pricePattern    = `\$?\s*(\d+(?:\.\d+)?)`
+	betweenPattern  = regexp.MustCompile(`\bbetween\s+` + pricePattern + `\s+(?:and|to)\s+` + pricePattern)
+	maxPricePattern = regexp.MustCompile(`\b(?:under|below|less than|cheaper than|up to)\s+` + pricePattern)
+	minPricePattern = regexp.MustCompile(`\b(?:over|above|more than|at least)\s+` + pricePattern)
+	inStockPattern  = regexp.MustCompile(`\bin[\s-]stock\b`)
+	spacePattern    = regexp.MustCompile(`\s+`)
+)
+
+// understandQuery extracts category, price and stock intent from the free-text
+// query and applies it to the request. Explicit request parameters always win
+// over detected intent. Returns nil when nothing was detected.
+func (r *ProductRepository) understandQuery(ctx context.Context, searchReq *models.ProductSearchRequest, opts *searchOptions) *models.QueryInterpretation {
+	if strings.TrimSpace(searchReq.Query) == "" {
+		return nil
+	}
+
+	categories, err := r.knownCategories(ctx)
+	if err != nil {
+		log.Printf("[SEARCH] Failed to load categories for query understanding: %v", err)
+	}
+
+	interpretation := interpretQuery(searchReq.Query, categories)
+	if interpretation == nil {
+		return nil
+	}
+
+	searchReq.Query = interpretation.Text
+	if interpretation.MinPrice > 0 && searchReq.MinPrice == 0 {
+		searchReq.MinPrice = interpretation.MinPrice
+	}
+	if interpretation.MaxPrice > 0 && searchReq.MaxPrice == 0 {
+		searchReq.MaxPrice = interpretation.MaxPrice
+	}
+	if interpretation.InStock {
+		searchReq.InStock = true
+	}
+	if interpretation.Category != "" && searchReq.Category == "" {
+		if interpretation.CategoryMode == models.CategoryIntentFilter {
+			searchReq.Category = interpretation.Category
+		} else {
+			opts.boostCategory = interpretation.Category
+		}
+	}
+
+	log.Printf("[SEARCH] QUERY UNDERSTANDING - Original: %q, Interpreted: %+v", interpretation.Original, *interpretation)
+	return interpretation
+}
+
+// interpretQuery parses price phrases ("under 50", "between 10 and 20"), "in stock"
+// and known category tokens out of a query
+func interpretQuery(query string, categories *categoryMatcher) *models.QueryInterpretation {
+	interpretation := &models.QueryInterpretation{Original: query}
+	text := strings.ToLower(query)
+	detected := false
+
+	if m := betweenPattern.FindStringSubmatch(text); m != nil {
+		low, _ := strconv.ParseFloat(m[1], 64)
+		high, _ := strconv.ParseFloat(m[2], 64)
+		if low > high {
+			low, high = high, low
+		}
+		interpretation.MinPrice, interpretation.MaxPrice = low, high
+		text = strings.Replace(text, m[0], " ", 1)
+		detected = true
+	}
+	if m := maxPricePattern.FindStringSubmatch(text); m != nil {
+		interpretation.MaxPrice, _ = strconv.ParseFloat(m[1], 64)
+		text = strings.Replace(text, m[0], " ", 1)
+		detected = true
+	}
+	if m := minPricePattern.FindStringSubmatch(text); m != nil {
+		interpretation.MinPrice, _ = strconv.ParseFloat(m[1], 64)
+		text = strings.Replace(text, m[0], " ", 1)
+		detected = true
+	}
+	if inStockPattern.MatchString(text) {
+		interpretation.InStock = true
+		text = inStockPattern.ReplaceAllString(text, " ")
+		detected = true
+	}
+
+	text = strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+
+	if category, token := categories.match(text); category != "" {
+		interpretation.Category = category
+		detected = true
+
+		// A query that is nothing but the category name is a category browse;
+		// otherwise the token may also describe the product ("gaming mouse"),
+		// so keep it in the text and only boost the category
+		if rest := strings.TrimSpace(strings.Replace(text, token, "", 1)); rest == "" {
+			interpretation.CategoryMode = models.CategoryIntentFilter
+			text = ""
+		} else {
+			interpretation.CategoryMode = models.CategoryIntentBoost
+		}
+	}
+
+	if !detected {
+		return nil
+	}
+
+	interpretation.Text = text
+	return interpretation
+}
+
+// categoryMatcher finds known categories in a query by looking up its words
+// and word sequences, so matching costs the same however many categories exist
+type categoryMatcher struct {
+	forms    map[string]string // singular and plural forms of each name to the category
+	maxWords int               // words in the longest category name
+}
+
+// newCategoryMatcher indexes the lowercase singular and plural forms of the
+// category names; a form shared by two categories goes to the longer name
+func newCategoryMatcher(names []string) *categoryMatcher {
+	m := &categoryMatcher{forms: make(map[string]string, len(names)*3)}
+	for _, category := range names {
+		name := strings.ToLower(category)
+		if name == "" {
+			continue
+		}
+		for _, form := range []string{name, strings.TrimSuffix(name, "s"), name + "s"} {
+			if form == "" {
+				continue
+			}
+			if existing, ok := m.forms[form]; !ok || len(category) > len(existing) {
+				m.forms[form] = category
+			}
+		}
+		if words := len(strings.Fields(name)); words > m.maxWords {
+			m.maxWords = words
+		}
+	}
+	return m
+}
+
+// match finds a known category mentioned as whole words (singular or plural)
+// in the text, preferring the longest category name. It returns the category
+// and the token as it appears in the text.
+func (m *categoryMatcher) match(text string) (string, string) {
+	if m == nil {
+		return "", ""
+	}
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+
+	bestCategory, bestToken := "", ""
+	for n := 1; n <= m.maxWords; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			token := strings.Join(words[i:i+n], " ")
+			category, ok := m.forms[token]
+			if !ok || len(category) <= len(bestCategory) || !strings.Contains(text, token) {
+				continue
+			}
+			bestCategory, bestToken = category, token
+		}
+	}
+	return bestCategory, bestToken
+}
+
+// knownCategories returns the matcher of the live category terms and the
+// taxonomy categories, cached for categoryCacheTTL
+func (r *ProductRepository) knownCategories(ctx context.Context) (*categoryMatcher, error) {
+	return r.categories.get(ctx, r.loadCategories)
+}
+
+// loadCategories builds the category matcher from a terms aggregation over
+// the visible products and the taxonomy
+func (r *ProductRepository) loadCategories(ctx context.Context) (*categoryMatcher, error) {
+	searchBody := map[string]interface{}{
+		"size":  0,
+		"query": visibleFilter(),
+		"aggs": map[string]interface{}{
+			"categories": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "category",
+					"size":  1000,
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
+		return nil, fmt.Errorf("error encoding category aggregation: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.indexName),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error executing category aggregation: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Aggregations struct {
+			Categories struct {
+				Buckets []struct {
+					Key string `json:"key"`
+				} `json:"buckets"`
+			} `json:"categories"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	categories := make([]string, 0, len(result.Aggregations.Categories.Buckets))
+	for _, bucket := range result.Aggregations.Categories.Buckets {
+		categories = append(categories, bucket.Key)
+	}
+	// Parent categories have no products of their own but still name a browse
+	for id := range r.activeTaxonomy(ctx) {
+		categories = append(categories, id)
+	}
+
+	return newCategoryMatcher(categories), nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// maxTrendingCategoryProducts caps the products of a category whose trending
+// scores are compared, the best sellers first. It stays within the default
+// result window of a search.
+const maxTrendingCategoryProducts = 10000
+
+// BoughtTogether loads the in-stock products among the given co-purchases and
+// ranks them by co-purchase count weighted by rating and popularity
+func (r *ProductRepository) BoughtTogether(ctx context.Context, related []models.CoPurchase, size int) ([]models.Product, error) {
+	if len(related) == 0 {
+		return []models.Product{}, nil
+	}
+
+	ids := make([]string, 0, len(related))
+	counts := make(map[string]interface{}, len(related))
+	for _, coPurchase := range related {
+		ids = append(ids, coPurchase.ProductID)
+		counts[coPurchase.ProductID] = coPurchase.Count
+	}
+
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"ids": map[string]interface{}{"values": ids}},
+				{"range": map[string]interface{}{"stock": map[string]interface{}{"gt": 0}}},
+			},
+		},
+	}
+
+	searchBody := map[string]interface{}{
+		"query": buildCoPurchaseScoringQuery(query, counts),
+		"size":  size,
+		"sort": []map[string]interface{}{
+			{"_score": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	products, _, err := r.executeSearch(ctx, searchBody)
+	return products, err
+}
+
+// CategoryProductIDs returns the IDs of the visible products in a category
+// and its subcategories, best sellers first, so trending scores can be ranked
+// within the category rather than filtered after a global cut
+func (r *ProductRepository) CategoryProductIDs(ctx context.Context, category string) ([]string, error) {
+	searchBody := map[string]interface{}{
+		"query":   r.categoryFilter(ctx, category),
+		"_source": false,
+		"size":    maxTrendingCategoryProducts,
+		"sort": []map[string]interface{}{
+			{"sales_count": map[string]interface{}{"order": "desc"}},
+		},
+	}
+	visibleOnly(searchBody)
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, fmt.Errorf("error listing category products: %w", err)
+	}
+
+	ids := make([]string, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids, nil
+}
+
+// TrendingProducts loads the products among the given trending scores, optionally
+// restricted to a category, ordered by trending score. It returns the page of
+// products and the number of trending products that matched.
+func (r *ProductRepository) TrendingProducts(ctx context.Context, scores []models.TrendingScore, category string, from, size int) ([]models.Product, int, error) {
+	if len(scores) == 0 {
+		return []models.Product{}, 0, nil
+	}
+
+	ids := make([]string, 0, len(scores))
+	trending := make(map[string]interface{}, len(scores))
+	for _, score := range scores {
+		ids = append(ids, score.ProductID)
+		trending[score.ProductID] = score.Score
+	}
+
+	filterClauses := []map[string]interface{}{
+		{"ids": map[string]interface{}{"values": ids}},
+	}
+	if category != "" {
+		filterClauses = append(filterClauses, r.categoryFilter(ctx, category))
+	}
+
+	searchBody := map[string]interface{}{
+		"query": map[string]interface{}{
+			"script_score": map[string]interface{}{
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{"filter": filterClauses},
+				},
+				"script": map[string]interface{}{
+					"source": "params.trending[doc['id'].value]",
+					"params": map[string]interface{}{"trending": trending},
+				},
+			},
+		},
+		"from": from,
+		"size": size,
+		"sort": []map[string]interface{}{
+			{"_score": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	return r.executeSearch(ctx, searchBody)
+}
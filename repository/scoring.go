@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+// Painless snippets for each factor of the ecommerce scoring formula. They are
+// shared by every script that applies (part of) the formula so the factors stay
+// identical across search and recommendations. Constants come from the ranking
+// profile in params.ranking.
+const (
+	// Stock availability: out-of-stock = 0.3x penalty, in-stock = 1.0x
+	stockFactorScript = `
+					double stockMultiplier = doc['stock'].value > 0 ? 1.0 : params.ranking.out_of_stock_multiplier;
+	`
+
+	// Rating boost: normalize 0-5 rating to 0.6-1.2 multiplier
+	// (3 stars = 1.0x, 5 stars = 1.2x, 0 stars = 0.6x)
+	ratingFactorScript = `
+					double ratingBoost = doc['review_count'].value > 0 
+						? params.ranking.rating_base + (doc['rating'].value / 5.0) * params.ranking.rating_range 
+						: 1.0;
+	`
+
+	// Social proof: logarithmic boost from review count
+	// More reviews = more trust (diminishing returns)
+	reviewFactorScript = `
+					double reviewBoost = 1.0 + Math.log10(doc['review_count'].value + 1) * params.ranking.review_weight;
+	`
+
+	// Popularity: logarithmic boost from sales count
+	// Best sellers rank higher
+	popularityFactorScript = `
+					double popularityBoost = 1.0 + Math.log10(doc['sales_count'].value + 1) * params.ranking.popularity_weight;
+	`
+
+	// Engagement: CTR and view count combined
+	// High CTR = users find it relevant
+	engagementFactorScript = `
+					double engagementBoost = 1.0 + (doc['ctr'].value * params.ranking.ctr_weight) + (Math.log10(doc['view_count'].value + 1) * params.ranking.view_weight);
+	`
+
+	// Business boost: promoted products + margin consideration
+	// Promoted products get 1.3x boost, high margin products get slight boost
+	businessFactorScript = `
+					double businessBoost = (doc['is_promoted'].value ? params.ranking.promoted_boost : 1.0) * (1.0 + doc['margin'].value * params.ranking.margin_weight);
+	`
+)
+
+// DefaultRankingProfile returns the standard constants of the scoring formula,
+// with the optional factors disabled
+func DefaultRankingProfile() models.RankingProfile {
+	return models.RankingProfile{
+		OutOfStockMultiplier: 0.3,
+		RatingBase:           0.6,
+		RatingRange:          0.6,
+		ReviewWeight:         0.1,
+		PopularityWeight:     0.15,
+		CTRWeight:            0.2,
+		ViewWeight:           0.05,
+		PromotedBoost:        1.3,
+		MarginWeight:         0.1,
+	}
+}
+
+// ValidateRankingProfile checks that the constants of a profile are in range
+func ValidateRankingProfile(profile models.RankingProfile) error {
+	if profile.OutOfStockMultiplier < 0 || profile.OutOfStockMultiplier > 1 {
+		return fmt.Errorf("out_of_stock_multiplier must be between 0 and 1")
+	}
+	if profile.RatingBase < 0 || profile.PromotedBoost <= 0 {
+		return fmt.Errorf("rating_base must not be negative and promoted_boost must be positive")
+	}
+	weights := map[string]float64{
+		"rating_range":             profile.RatingRange,
+		"review_weight":            profile.ReviewWeight,
+		"popularity_weight":        profile.PopularityWeight,
+		"ctr_weight":               profile.CTRWeight,
+		"view_weight":              profile.ViewWeight,
+		"margin_weight":            profile.MarginWeight,
+		"trending_weight":          profile.TrendingWeight,
+		"freshness_weight":         profile.FreshnessWeight,
+		"affinity_category_weight": profile.AffinityCategoryWeight,
+		"affinity_price_weight":    profile.AffinityPriceWeight,
+	}
+	for name, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// rankingParams exposes the formula constants of a profile to painless
+func rankingParams(profile models.RankingProfile) map[string]interface{} {
+	return map[string]interface{}{
+		"out_of_stock_multiplier": profile.OutOfStockMultiplier,
+		"rating_base":             profile.RatingBase,
+		"rating_range":            profile.RatingRange,
+		"review_weight":           profile.ReviewWeight,
+		"popularity_weight":       profile.PopularityWeight,
+		"ctr_weight":              profile.CTRWeight,
+		"view_weight":             profile.ViewWeight,
+		"promoted_boost":          profile.PromotedBoost,
+		"margin_weight":           profile.MarginWeight,
+	}
+}
+
+// formulaFactor is an optional multiplicative signal appended to the scoring
+// formula. Its script must declare the double named by variable; params are
+// merged into the script params.
+type formulaFactor struct {
+	script   string
+	variable string
+	params   map[string]interface{}
+}
+
+// buildScoringQuery wraps a retrieval query with the ecommerce scoring formula
+func buildScoringQuery(query map[string]interface{}, profile models.RankingProfile, extra ...formulaFactor) map[string]interface{} {
+	return buildFormulaQuery(query, "_score", nil, profile, extra...)
+}
+
+// buildFormulaQuery wraps a query with the ecommerce scoring formula, using the
+// painless expression baseScore (e.g. "_score") as the relevance component
+func buildFormulaQuery(query map[string]interface{}, baseScore string, params map[string]interface{}, profile models.RankingProfile, extra ...formulaFactor) map[string]interface{} {
+	// Apply enhanced ecommerce scoring formula
+	// Components:
+	// 1. Base relevance (_score from text matching)
+	// 2. Stock availability (in-stock boost, out-of-stock penalty)
+	// 3. Rating boost (higher rated products rank higher)
+	// 4. Social proof (review count logarithmic boost)
+	// 5. Popularity (sales count logarithmic boost)
+	// 6. Engagement (CTR and view count)
+	// 7. Business rules (promoted products, margin)
+	// plus any optional factors (e.g. trending)
+	scriptParams := map[string]interface{}{"ranking": rankingParams(profile)}
+	for key, value := range params {
+		scriptParams[key] = value
+	}
+
+	extraScript := ""
+	extraProduct := ""
+	for _, factor := range extra {
+		extraScript += factor.script
+		extraProduct += " * " + factor.variable
+		for key, value := range factor.params {
+			scriptParams[key] = value
+		}
+	}
+
+	source := `
+					// Base relevance score from text matching
+					double baseScore = ` + baseScore + `;
+	` + stockFactorScript + ratingFactorScript + reviewFactorScript + popularityFactorScript + engagementFactorScript + businessFactorScript + extraScript + `
+					// Final score: combine all signals
+					return baseScore * stockMultiplier * ratingBoost * reviewBoost * popularityBoost * engagementBoost * businessBoost` + extraProduct + `;
+	`
+
+	return map[string]interface{}{
+		"script_score": map[string]interface{}{
+			"query": query,
+			"script": map[string]interface{}{
+				"source": source,
+				"params": scriptParams,
+			},
+		},
+	}
+}
+
+// formulaFeatures are the factor variables of the scoring formula, in the
+// order they are exported as learning-to-rank features
+var formulaFeatures = []string{"stockMultiplier", "ratingBoost", "reviewBoost", "popularityBoost", "engagementBoost", "businessBoost"}
+
+// buildFeatureScript returns a script field computing every factor of the
+// formula (and the optional factors) for a document, as a map by variable name
+func buildFeatureScript(profile models.RankingProfile, extra ...formulaFactor) map[string]interface{} {
+	scriptParams := map[string]interface{}{"ranking": rankingParams(profile)}
+
+	values := ""
+	for _, variable := range formulaFeatures {
+		values += "'" + variable + "': " + variable + ", "
+	}
+
+	extraScript := ""
+	for _, factor := range extra {
+		extraScript += factor.script
+		values += "'" + factor.variable + "': " + factor.variable + ", "
+		for key, value := range factor.params {
+			scriptParams[key] = value
+		}
+	}
+
+	source := stockFactorScript + ratingFactorScript + reviewFactorScript + popularityFactorScript + engagementFactorScript + businessFactorScript + extraScript + `
+					return [` + strings.TrimSuffix(values, ", ") + `];
+	`
+
+	return map[string]interface{}{
+		"script": map[string]interface{}{
+			"source": source,
+			"params": scriptParams,
+		},
+	}
+}
+
+// trendingFactor boosts products by their decayed trending score:
+// T = 1.0 + weight × log₁₀(trending + 1)
+func trendingFactor(scores map[string]float64, weight float64) formulaFactor {
+	trending := make(map[string]interface{}, len(scores))
+	for id, score := range scores {
+		trending[id] = score
+	}
+
+	return formulaFactor{
+		script: `
+					// Trending: decayed recent activity (views, clicks, carts, purchases)
+					double trendingBoost = 1.0 + params.trending_weight * Math.log10(params.trending.getOrDefault(doc['id'].value, 0.0) + 1);
+	`,
+		variable: "trendingBoost",
+		params: map[string]interface{}{
+			"trending":        trending,
+			"trending_weight": weight,
+		},
+	}
+}
+
+// buildQualityScoringQuery wraps a query with only the stock and rating factors
+// of the default formula, for recommendations where popularity should not dominate
+func buildQualityScoringQuery(query map[string]interface{}) map[string]interface{} {
+	source := stockFactorScript + ratingFactorScript + `
+					return _score * stockMultiplier * ratingBoost;
+	`
+
+	return map[string]interface{}{
+		"script_score": map[string]interface{}{
+			"query": query,
+			"script": map[string]interface{}{
+				"source": source,
+				"params": map[string]interface{}{"ranking": rankingParams(DefaultRankingProfile())},
+			},
+		},
+	}
+}
+
+// buildCoPurchaseScoringQuery ranks co-purchased products by how often they were
+// bought together (params.counts by product ID), weighted by the rating and
+// popularity factors of the default formula
+func buildCoPurchaseScoringQuery(query map[string]interface{}, counts map[string]interface{}) map[string]interface{} {
+	source := ratingFactorScript + popularityFactorScript + `
+					return params.counts[doc['id'].value] * ratingBoost * popularityBoost;
+	`
+
+	return map[string]interface{}{
+		"script_score": map[string]interface{}{
+			"query": query,
+			"script": map[string]interface{}{
+				"source": source,
+				"params": map[string]interface{}{
+					"counts":  counts,
+					"ranking": rankingParams(DefaultRankingProfile()),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,465 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// searchLogBatch is the most entries written in one bulk request
+	searchLogBatch = 500
+
+	// searchLogTimeout bounds one bulk write
+	searchLogTimeout = 10 * time.Second
+
+	// maxAnalyticsQueries caps the distinct queries considered by a report
+	maxAnalyticsQueries = 1000
+
+	// searchLogRetries is how often a write retries on a version conflict
+	// between the background writer and a click marking the same search
+	searchLogRetries = 3
+)
+
+// SearchLogRepository records served searches in the analytics index and
+// reports on them. Entries are buffered and written in bulk in the background.
+// As an EventListener it marks the searches that clicks lead back to.
+type SearchLogRepository struct {
+	client        *elasticsearch.Client
+	indexName     string
+	entries       chan models.SearchLogEntry
+	flushInterval time.Duration
+	closing       chan struct{}
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+// NewSearchLogRepository starts the background writer, which flushes every
+// flushInterval or as soon as a full batch is buffered. The buffer size and
+// flush interval must be positive.
+func NewSearchLogRepository(client *elasticsearch.Client, indexName string, bufferSize int, flushInterval time.Duration) (*SearchLogRepository, error) {
+	if bufferSize <= 0 {
+		return nil, fmt.Errorf("search log buffer must be positive, got %d", bufferSize)
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("search log flush interval must be positive, got %s", flushInterval)
+	}
+	r := &SearchLogRepository{
+		client:        client,
+		indexName:     indexName,
+		entries:       make(chan models.SearchLogEntry, bufferSize),
+		flushInterval: flushInterval,
+		closing:       make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// NormalizeQuery lowercases a query and collapses its whitespace, so that
+// variants of the same query are counted together
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// Log queues a search for the analytics index. It never blocks: when the
+// buffer is full the entry is dropped.
+func (r *SearchLogRepository) Log(entry models.SearchLogEntry) {
+	select {
+	case r.entries <- entry:
+	default:
+		log.Printf("[ANALYTICS] Buffer full, dropping search %s", entry.SearchID)
+	}
+}
+
+// Close writes the buffered entries and stops the background writer. Entries
+// logged after Close are dropped.
+func (r *SearchLogRepository) Close() {
+	r.closeOnce.Do(func() { close(r.closing) })
+	<-r.closed
+}
+
+// run writes buffered entries until the repository is closed
+func (r *SearchLogRepository) run() {
+	defer close(r.closed)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.SearchLogEntry, 0, searchLogBatch)
+	for {
+		select {
+		case entry := <-r.entries:
+			batch = append(batch, entry)
+			if len(batch) < searchLogBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-r.closing:
+			r.drain(batch)
+			return
+		}
+
+		r.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// drain writes the current batch and everything still buffered
+func (r *SearchLogRepository) drain(batch []models.SearchLogEntry) {
+	for {
+		select {
+		case entry := <-r.entries:
+			batch = append(batch, entry)
+			if len(batch) < searchLogBatch {
+				continue
+			}
+			r.flush(batch)
+			batch = batch[:0]
+		default:
+			if len(batch) > 0 {
+				r.flush(batch)
+			}
+			return
+		}
+	}
+}
+
+// flush writes one batch, logging failures
+func (r *SearchLogRepository) flush(batch []models.SearchLogEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchLogTimeout)
+	defer cancel()
+
+	if err := r.store(ctx, batch); err != nil {
+		log.Printf("[ANALYTICS] Failed to write %d searches: %v", len(batch), err)
+	}
+}
+
+// store indexes entries, one document per search. Entries are upserted so
+// that a click recorded before the entry was written keeps its clicked flag.
+func (r *SearchLogRepository) store(ctx context.Context, entries []models.SearchLogEntry) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, entry := range entries {
+		action := map[string]interface{}{
+			"update": map[string]interface{}{
+				"_index":            r.indexName,
+				"_id":               entry.SearchID,
+				"retry_on_conflict": searchLogRetries,
+			},
+		}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("error encoding bulk action: %w", err)
+		}
+		if err := encoder.Encode(map[string]interface{}{"doc": entry, "doc_as_upsert": true}); err != nil {
+			return fmt.Errorf("error encoding search log entry: %w", err)
+		}
+	}
+
+	log.Printf("[ES] SEARCH LOG - Index: %s, Searches: %d", r.indexName, len(entries))
+
+	res, err := r.client.Bulk(
+		&body,
+		r.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error storing search log: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk search log had failures: %s", string(resBody))
+	}
+
+	return nil
+}
+
+// HandleEvent marks the search a click event carries as clicked. The search
+// may still be buffered, so the flag is upserted and merged into the entry
+// when it is written.
+func (r *SearchLogRepository) HandleEvent(ctx context.Context, event *models.Event) error {
+	if event.Type != models.EventTypeClick || event.SearchID == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"doc":           map[string]interface{}{"clicked": true},
+		"doc_as_upsert": true,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling click: %w", err)
+	}
+
+	retries := searchLogRetries
+	req := esapi.UpdateRequest{
+		Index:           r.indexName,
+		DocumentID:      event.SearchID,
+		Body:            bytes.NewReader(data),
+		RetryOnConflict: &retries,
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error marking search clicked: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// timeRange filters log entries to [since, until)
+func timeRange(since, until time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			"timestamp": map[string]interface{}{"gte": since, "lt": until},
+		},
+	}
+}
+
+// withQuery excludes searches without a text query, such as category browsing
+var withQuery = map[string]interface{}{
+	"bool": map[string]interface{}{
+		"must_not": []map[string]interface{}{
+			{"term": map[string]interface{}{"query": ""}},
+		},
+	},
+}
+
+// TopQueries returns the most frequent queries in [since, until)
+func (r *SearchLogRepository) TopQueries(ctx context.Context, since, until time.Time, size int) ([]models.QueryStats, error) {
+	return r.queryStats(ctx, []map[string]interface{}{timeRange(since, until), withQuery}, size)
+}
+
+// ZeroResultQueries returns the queries that most often matched nothing in
+// [since, until); their counts only include the zero-result searches
+func (r *SearchLogRepository) ZeroResultQueries(ctx context.Context, since, until time.Time, size int) ([]models.QueryStats, error) {
+	return r.queryStats(ctx, []map[string]interface{}{
+		timeRange(since, until),
+		withQuery,
+		{"term": map[string]interface{}{"zero_results": true}},
+	}, size)
+}
+
+// queryStats aggregates the matching searches by query, most frequent first
+func (r *SearchLogRepository) queryStats(ctx context.Context, filters []map[string]interface{}, size int) ([]models.QueryStats, error) {
+	searchBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"aggs": map[string]interface{}{
+			"queries": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "query", "size": size},
+				"aggs": map[string]interface{}{
+					"zero_results": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"term": map[string]interface{}{"zero_results": true},
+						},
+					},
+					"latency":   map[string]interface{}{"avg": map[string]interface{}{"field": "latency_ms"}},
+					"last_seen": map[string]interface{}{"max": map[string]interface{}{"field": "timestamp"}},
+				},
+			},
+		},
+	}
+
+	log.Printf("[ES] QUERY STATS - Index: %s, Size: %d", r.indexName, size)
+
+	var result struct {
+		Aggregations struct {
+			Queries struct {
+				Buckets []struct {
+					Key         string `json:"key"`
+					DocCount    int    `json:"doc_count"`
+					ZeroResults struct {
+						DocCount int `json:"doc_count"`
+					} `json:"zero_results"`
+					Latency struct {
+						Value float64 `json:"value"`
+					} `json:"latency"`
+					LastSeen struct {
+						Value float64 `json:"value"`
+					} `json:"last_seen"`
+				} `json:"buckets"`
+			} `json:"queries"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	stats := make([]models.QueryStats, 0, len(result.Aggregations.Queries.Buckets))
+	for _, bucket := range result.Aggregations.Queries.Buckets {
+		stats = append(stats, models.QueryStats{
+			Query:        bucket.Key,
+			Searches:     bucket.DocCount,
+			ZeroResults:  bucket.ZeroResults.DocCount,
+			AvgLatencyMs: bucket.Latency.Value,
+			LastSeen:     time.UnixMilli(int64(bucket.LastSeen.Value)).UTC(),
+		})
+	}
+	return stats, nil
+}
+
+// LowCTRQueries returns the queries with at least minSearches searches in
+// [since, until) whose searches are least often followed by a click. A search
+// counts as clicked when a click event carries its search ID.
+func (r *SearchLogRepository) LowCTRQueries(ctx context.Context, since, until time.Time, minSearches, size int) ([]models.QueryCTR, error) {
+	searchBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{timeRange(since, until), withQuery},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"queries": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field":         "query",
+					"size":          maxAnalyticsQueries,
+					"min_doc_count": minSearches,
+				},
+				"aggs": map[string]interface{}{
+					"clicked": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"term": map[string]interface{}{"clicked": true},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	log.Printf("[ES] LOW CTR QUERIES - Index: %s, MinSearches: %d", r.indexName, minSearches)
+
+	var result struct {
+		Aggregations struct {
+			Queries struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+					Clicked  struct {
+						DocCount int `json:"doc_count"`
+					} `json:"clicked"`
+				} `json:"buckets"`
+			} `json:"queries"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	stats := make([]models.QueryCTR, 0, len(result.Aggregations.Queries.Buckets))
+	for _, bucket := range result.Aggregations.Queries.Buckets {
+		stats = append(stats, models.QueryCTR{
+			Query:           bucket.Key,
+			Searches:        bucket.DocCount,
+			ClickedSearches: bucket.Clicked.DocCount,
+			CTR:             float64(bucket.Clicked.DocCount) / float64(bucket.DocCount),
+		})
+	}
+
+	// Lowest CTR first; among equal CTRs, the most searched first
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].CTR != stats[j].CTR {
+			return stats[i].CTR < stats[j].CTR
+		}
+		if stats[i].Searches != stats[j].Searches {
+			return stats[i].Searches > stats[j].Searches
+		}
+		return stats[i].Query < stats[j].Query
+	})
+	if len(stats) > size {
+		stats = stats[:size]
+	}
+	return stats, nil
+}
+
+// FilterUsage returns how many searches in [since, until) used each filter,
+// most used first, and the total number of searches
+func (r *SearchLogRepository) FilterUsage(ctx context.Context, since, until time.Time) ([]models.FilterUsage, int, error) {
+	searchBody := map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query":            timeRange(since, until),
+		"aggs": map[string]interface{}{
+			"filters": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "filters", "size": 50},
+			},
+			"unfiltered": map[string]interface{}{
+				"missing": map[string]interface{}{"field": "filters"},
+			},
+		},
+	}
+
+	log.Printf("[ES] FILTER USAGE - Index: %s", r.indexName)
+
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Filters struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"filters"`
+			Unfiltered struct {
+				DocCount int `json:"doc_count"`
+			} `json:"unfiltered"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, 0, err
+	}
+
+	total := result.Hits.Total.Value
+	share := func(count int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(count) / float64(total)
+	}
+
+	usage := make([]models.FilterUsage, 0, len(result.Aggregations.Filters.Buckets)+1)
+	for _, bucket := range result.Aggregations.Filters.Buckets {
+		usage = append(usage, models.FilterUsage{Filter: bucket.Key, Searches: bucket.DocCount, Share: share(bucket.DocCount)})
+	}
+	if unfiltered := result.Aggregations.Unfiltered.DocCount; unfiltered > 0 {
+		usage = append(usage, models.FilterUsage{Filter: "none", Searches: unfiltered, Share: share(unfiltered)})
+	}
+	sort.SliceStable(usage, func(i, j int) bool { return usage[i].Searches > usage[j].Searches })
+	return usage, total, nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+)
+
+const (
+	defaultSimilarSize = 10
+	maxSimilarSize     = 50
+)
+
+// Similar finds products similar to the given product using a more_like_this
+// query over name and description. Results exclude the source product, stay in
+// its category unless AnyCategory is set, and are ranked with the stock and
+// rating factors of the scoring formula.
+func (r *ProductRepository) Similar(ctx context.Context, id string, similarReq *models.SimilarProductsRequest) ([]models.Product, error) {
+	source, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	size := similarReq.Size
+	if size < 1 {
+		size = defaultSimilarSize
+	}
+	if size > maxSimilarSize {
+		size = maxSimilarSize
+	}
+
+	mustClauses := []map[string]interface{}{
+		{
+			"more_like_this": map[string]interface{}{
+				"fields": []string{"name", "description"},
+				"like": []map[string]interface{}{
+					{"_index": r.indexName, "_id": id},
+				},
+				"min_term_freq":   1,
+				"min_doc_freq":    1,
+				"max_query_terms": 25,
+			},
+		},
+	}
+
+	filterClauses := []map[string]interface{}{}
+	if !similarReq.AnyCategory {
+		filterClauses = append(filterClauses, map[string]interface{}{
+			"term": map[string]interface{}{
+				"category": source.Category,
+			},
+		})
+	}
+
+	// Price band: explicit bounds win over a band relative to the source price.
+	// Both are in the currency of the source product and compared on the base
+	// currency price, so products priced in other currencies are banded alike.
+	minPrice, maxPrice := similarReq.MinPrice, similarReq.MaxPrice
+	if similarReq.PriceBand > 0 {
+		if minPrice == 0 {
+			minPrice = source.Price * (1 - similarReq.PriceBand)
+		}
+		if maxPrice == 0 {
+			maxPrice = source.Price * (1 + similarReq.PriceBand)
+		}
+	}
+	if minPrice > 0 || maxPrice > 0 {
+		conversion, err := r.sourceConversion(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		priceRange := map[string]interface{}{}
+		if minPrice > 0 {
+			priceRange["gte"] = conversion.toBase(minPrice)
+		}
+		if maxPrice > 0 {
+			priceRange["lte"] = conversion.toBase(maxPrice)
+		}
+		filterClauses = append(filterClauses, map[string]interface{}{
+			"range": map[string]interface{}{
+				conversion.priceField(): priceRange,
+			},
+		})
+	}
+
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   mustClauses,
+			"filter": filterClauses,
+			"must_not": []map[string]interface{}{
+				{"ids": map[string]interface{}{"values": []string{id}}},
+			},
+		},
+	}
+
+	searchBody := map[string]interface{}{
+		"query": buildQualityScoringQuery(query),
+		"size":  size,
+		"sort": []map[string]interface{}{
+			{"_score": map[string]interface{}{"order": "desc"}},
+		},
+	}
+
+	products, _, err := r.executeSearch(ctx, searchBody)
+	return products, err
+}
+
+// sourceConversion returns the conversion from the currency of a product, or
+// nil when currencies are not enabled
+func (r *ProductRepository) sourceConversion(ctx context.Context, source *models.Product) (*currencyConversion, error) {
+	if r.currencies == nil {
+		return nil, nil
+	}
+	return r.currencyConversion(ctx, source.Currency)
+}
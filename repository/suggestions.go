@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+const (
+	// maxMinedQueries caps the distinct queries kept as suggestions
+	maxMinedQueries = 10000
+
+	// maxSuggestionLength skips queries too long to be useful completions
+	maxSuggestionLength = 100
+
+	// suggestionBatch is the most suggestions written in one bulk request
+	suggestionBatch = 1000
+
+	// suggestionRefreshTimeout bounds one mining run
+	suggestionRefreshTimeout = 5 * time.Minute
+
+	// suggestionRecencyScale is the age at which a query's recency factor halves
+	suggestionRecencyScale = "7d"
+)
+
+// SuggestionRepository mines popular queries from the search analytics index
+// into a suggestion index and completes prefixes from it
+type SuggestionRepository struct {
+	client          *elasticsearch.Client
+	indexName       string
+	analyticsIndex  string
+	window          time.Duration
+	minSearches     int
+	blocklist       map[string]bool
+	refreshInterval time.Duration
+}
+
+// NewSuggestionRepository mines queries searched successfully at least
+// minSearches times within window. Queries containing a blocklisted word or
+// phrase are never suggested. Suggestions are mined again every
+// refreshInterval, which must be positive.
+func NewSuggestionRepository(client *elasticsearch.Client, indexName, analyticsIndex string, window time.Duration, minSearches int, blocklist []string, refreshInterval time.Duration) (*SuggestionRepository, error) {
+	if refreshInterval <= 0 {
+		return nil, fmt.Errorf("suggestion refresh interval must be positive, got %s", refreshInterval)
+	}
+
+	blocked := make(map[string]bool, len(blocklist))
+	for _, term := range blocklist {
+		if term = NormalizeQuery(term); term != "" {
+			blocked[term] = true
+		}
+	}
+
+	return &SuggestionRepository{
+		client:          client,
+		indexName:       indexName,
+		analyticsIndex:  analyticsIndex,
+		window:          window,
+		minSearches:     minSearches,
+		blocklist:       blocked,
+		refreshInterval: refreshInterval,
+	}, nil
+}
+
+// minedQuery is a suggestion document
+type minedQuery struct {
+	Query    string    `json:"query"`
+	Text     string    `json:"text"`
+	Searches int       `json:"searches"`
+	LastSeen time.Time `json:"last_seen"`
+	MinedAt  time.Time `json:"mined_at"`
+}
+
+// RefreshEvery mines suggestions now and then every refresh interval, until
+// the process exits
+func (r *SuggestionRepository) RefreshEvery() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), suggestionRefreshTimeout)
+		if count, err := r.Refresh(ctx); err != nil {
+			log.Printf("[SUGGEST] Failed to refresh query suggestions: %v", err)
+		} else {
+			log.Printf("[SUGGEST] Refreshed %d query suggestions", count)
+		}
+		cancel()
+		time.Sleep(r.refreshInterval)
+	}
+}
+
+// Refresh replaces the suggestions with the queries mined from the current
+// window and returns how many were stored. Suggestions no longer mined, such
+// as expired or newly blocklisted queries, are removed.
+func (r *SuggestionRepository) Refresh(ctx context.Context) (int, error) {
+	minedAt := time.Now()
+
+	queries, err := r.mine(ctx, minedAt.Add(-r.window), minedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(queries); start += suggestionBatch {
+		end := min(start+suggestionBatch, len(queries))
+		if err := r.store(ctx, queries[start:end]); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := r.prune(ctx, minedAt); err != nil {
+		return 0, err
+	}
+	return len(queries), nil
+}
+
+// mine aggregates the successful searches since a time by normalized query
+func (r *SuggestionRepository) mine(ctx context.Context, since, minedAt time.Time) ([]minedQuery, error) {
+	searchBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{
+					{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": since}}},
+					{"term": map[string]interface{}{"zero_results": false}},
+					withQuery,
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"queries": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field":         "query",
+					"size":          maxMinedQueries,
+					"min_doc_count": r.minSearches,
+				},
+				"aggs": map[string]interface{}{
+					"last_seen": map[string]interface{}{"max": map[string]interface{}{"field": "timestamp"}},
+				},
+			},
+		},
+	}
+
+	log.Printf("[ES] MINE SUGGESTIONS - Index: %s, Since: %s", r.analyticsIndex, since.Format(time.RFC3339))
+
+	var result struct {
+		Aggregations struct {
+			Queries struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+					LastSeen struct {
+						Value float64 `json:"value"`
+					} `json:"last_seen"`
+				} `json:"buckets"`
+			} `json:"queries"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.analyticsIndex, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	queries := make([]minedQuery, 0, len(result.Aggregations.Queries.Buckets))
+	for _, bucket := range result.Aggregations.Queries.Buckets {
+		if len(bucket.Key) > maxSuggestionLength || r.blocked(bucket.Key) {
+			continue
+		}
+		queries = append(queries, minedQuery{
+			Query:    bucket.Key,
+			Text:     bucket.Key,
+			Searches: bucket.DocCount,
+			LastSeen: time.UnixMilli(int64(bucket.LastSeen.Value)).UTC(),
+			MinedAt:  minedAt,
+		})
+	}
+	return queries, nil
+}
+
+// blocked reports whether a normalized query contains a blocklisted word or phrase
+func (r *SuggestionRepository) blocked(query string) bool {
+	if len(r.blocklist) == 0 {
+		return false
+	}
+
+	padded := " " + query + " "
+	for term := range r.blocklist {
+		if strings.Contains(padded, " "+term+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// store indexes mined queries, one document per query
+func (r *SuggestionRepository) store(ctx context.Context, queries []minedQuery) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, query := range queries {
+		action := map[string]interface{}{
+			"index": map[string]interface{}{
+				"_index": r.indexName,
+				"_id":    query.Query,
+			},
+		}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("error encoding bulk action: %w", err)
+		}
+		if err := encoder.Encode(query); err != nil {
+			return fmt.Errorf("error encoding suggestion: %w", err)
+		}
+	}
+
+	log.Printf("[ES] STORE SUGGESTIONS - Index: %s, Queries: %d", r.indexName, len(queries))
+
+	res, err := r.client.Bulk(
+		&body,
+		r.client.Bulk.WithContext(ctx),
+		r.client.Bulk.WithRefresh("wait_for"),
+	)
+	if err != nil {
+		return fmt.Errorf("error storing suggestions: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk suggestion store had failures: %s", string(resBody))
+	}
+
+	return nil
+}
+
+// prune deletes the suggestions not mined by the run at minedAt
+func (r *SuggestionRepository) prune(ctx context.Context, minedAt time.Time) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{"mined_at": map[string]interface{}{"lt": minedAt}},
+		},
+	}); err != nil {
+		return fmt.Errorf("error encoding prune query: %w", err)
+	}
+
+	log.Printf("[ES] PRUNE SUGGESTIONS - Index: %s, MinedBefore: %s", r.indexName, minedAt.Format(time.RFC3339))
+
+	res, err := r.client.DeleteByQuery(
+		[]string{r.indexName},
+		&buf,
+		r.client.DeleteByQuery.WithContext(ctx),
+		r.client.DeleteByQuery.WithConflicts("proceed"),
+	)
+	if err != nil {
+		return fmt.Errorf("error pruning suggestions: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// SuggestQueries completes a prefix with popular queries, ranked by how often
+// they were searched and how recently
+func (r *SuggestionRepository) SuggestQueries(ctx context.Context, prefix string, size int) ([]models.Suggestion, error) {
+	searchBody := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":  NormalizeQuery(prefix),
+						"type":   "bool_prefix",
+						"fields": []string{"text", "text._2gram", "text._3gram"},
+					},
+				},
+				"functions": []map[string]interface{}{
+					{"field_value_factor": map[string]interface{}{"field": "searches", "modifier": "log1p"}},
+					{"gauss": map[string]interface{}{
+						"last_seen": map[string]interface{}{"origin": "now", "scale": suggestionRecencyScale, "decay": 0.5},
+					}},
+				},
+				"score_mode": "multiply",
+				"boost_mode": "multiply",
+			},
+		},
+	}
+
+	log.Printf("[ES] SUGGEST QUERIES - Index: %s, Prefix: %q", r.indexName, prefix)
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source minedQuery `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.Suggestion, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		suggestions = append(suggestions, models.Suggestion{
+			Type:     models.SuggestionTypeQuery,
+			Text:     hit.Source.Query,
+			Searches: hit.Source.Searches,
+		})
+	}
+	return suggestions, nil
+}
+
+// SuggestProducts completes a prefix with product names
+func (r *ProductRepository) SuggestProducts(ctx context.Context, prefix string, size int) ([]models.Suggestion, error) {
+	searchBody := map[string]interface{}{
+		"size":    size,
+		"_source": []string{"id", "name", "category"},
+		"query": map[string]interface{}{
+			"match": map[string]interface{}{
+				"name.autocomplete": map[string]interface{}{
+					"query":    prefix,
+					"operator": "and",
+				},
+			},
+		},
+	}
+
+	products, _, err := r.executeSearch(ctx, searchBody)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.Suggestion, 0, len(products))
+	for _, product := range products {
+		suggestions = append(suggestions, models.Suggestion{
+			Type:      models.SuggestionTypeProduct,
+			Text:      product.Name,
+			ProductID: product.ID,
+			Category:  product.Category,
+		})
+	}
+	return suggestions, nil
+}
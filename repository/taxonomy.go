@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/querylang"
+)
+
+// TaxonomySource provides the category tree
+type TaxonomySource interface {
+	Taxonomy(ctx context.Context) (models.Taxonomy, error)
+}
+
+// SetTaxonomy enables hierarchical categories: products are indexed with the
+// path of their category, category filters include subcategories, and
+// searches return breadcrumbs and category facets
+func (r *ProductRepository) SetTaxonomy(source TaxonomySource) {
+	r.taxonomy = source
+}
+
+// repathScript sets the category paths of a product from params.paths; a
+// category missing from the taxonomy is its own top-level path
+const repathScript = `
+	String category = ctx._source.category;
+	if (category == null) {
+		ctx.op = 'noop';
+	} else {
+		ctx._source.category_paths = params.paths.containsKey(category) ? params.paths.get(category) : [category];
+	}
+`
+
+// activeTaxonomy returns the category tree for a search, or nil when
+// categories are flat
+func (r *ProductRepository) activeTaxonomy(ctx context.Context) models.Taxonomy {
+	if r.taxonomy == nil {
+		return nil
+	}
+	taxonomy, err := r.taxonomy.Taxonomy(ctx)
+	if err != nil {
+		log.Printf("[SEARCH] Failed to load the category taxonomy, filtering flat categories: %v", err)
+		return nil
+	}
+	return taxonomy
+}
+
+// categoryTerm returns the field and value matching a category: its path,
+// which subcategories are also indexed with, or the flat category without a
+// taxonomy
+func categoryTerm(category string, opts searchOptions) (string, string) {
+	if opts.taxonomy == nil {
+		return "category", category
+	}
+	return "category_paths", opts.taxonomy.Path(category)
+}
+
+// categoryResolver resolves the category filters of advanced queries the
+// same way as the category parameter
+func (opts searchOptions) categoryResolver() querylang.CategoryResolver {
+	return func(category string) (string, string) {
+		return categoryTerm(category, opts)
+	}
+}
+
+// categoryFilter matches a category and its subcategories in listings built
+// outside search requests, such as trending products
+func (r *ProductRepository) categoryFilter(ctx context.Context, category string) map[string]interface{} {
+	field, value := categoryTerm(category, searchOptions{taxonomy: r.activeTaxonomy(ctx)})
+	return map[string]interface{}{
+		"term": map[string]interface{}{field: value},
+	}
+}
+
+// RepathCategories recomputes the category paths of the products in the given
+// categories after the taxonomy changed, and returns how many were updated
+func (r *ProductRepository) RepathCategories(ctx context.Context, ids []string) (int, error) {
+	query := map[string]interface{}{
+		"terms": map[string]interface{}{"category": ids},
+	}
+	return r.repath(ctx, query)
+}
+
+// BackfillCategoryPaths computes the category paths of products indexed
+// before the taxonomy
+func (r *ProductRepository) BackfillCategoryPaths(ctx context.Context) (int, error) {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": map[string]interface{}{
+				"exists": map[string]interface{}{"field": "category_paths"},
+			},
+		},
+	}
+	return r.repath(ctx, query)
+}
+
+// repath recomputes the category paths of the products matching a query
+func (r *ProductRepository) repath(ctx context.Context, query map[string]interface{}) (int, error) {
+	if r.taxonomy == nil {
+		return 0, nil
+	}
+	taxonomy, err := r.taxonomy.Taxonomy(ctx)
+	if err != nil {
+		return 0, err
+	}
+	paths := make(map[string][]string, len(taxonomy))
+	for id := range taxonomy {
+		paths[id] = taxonomy.Paths(id)
+	}
+
+	return r.updateByQuery(ctx, "REPATH", query, map[string]interface{}{
+		"lang":   "painless",
+		"source": repathScript,
+		"params": map[string]interface{}{"paths": paths},
+	})
+}
+
+// categoryFacets counts the products matching the request in each category of
+// the tree, subcategories included. The request's own category filter is left
+// out so every category shows what selecting it would return.
+func (r *ProductRepository) categoryFacets(ctx context.Context, searchReq *models.ProductSearchRequest, opts searchOptions) ([]models.CategoryFacet, error) {
+	if opts.taxonomy == nil {
+		return nil, nil
+	}
+	facetReq := *searchReq
+	facetReq.Category = ""
+
+	searchBody := map[string]interface{}{
+		"query": buildSearchQuery(&facetReq, opts),
+		"size":  0,
+		"aggs": map[string]interface{}{
+			"categories": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "category_paths",
+					"size":  maxCategories,
+				},
+			},
+		},
+	}
+	visibleOnly(searchBody)
+
+	var result struct {
+		Aggregations struct {
+			Categories struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"categories"`
+		} `json:"aggregations"`
+	}
+	if err := searchIndex(ctx, r.client, r.indexName, searchBody, &result); err != nil {
+		return nil, fmt.Errorf("error computing category facets: %w", err)
+	}
+
+	counts := make(map[string]int, len(result.Aggregations.Categories.Buckets))
+	for _, bucket := range result.Aggregations.Categories.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+
+	facets := categoryFacetTree(opts.taxonomy, counts, "", "")
+	if facets == nil {
+		facets = []models.CategoryFacet{}
+	}
+
+	// Products in categories missing from the taxonomy are listed at the top level
+	for path, count := range counts {
+		if _, ok := opts.taxonomy[path]; !ok && !strings.Contains(path, models.CategoryPathSeparator) {
+			facets = append(facets, models.CategoryFacet{ID: path, Name: path, Path: path, Count: count})
+		}
+	}
+	sortCategoryFacets(facets)
+	return facets, nil
+}
+
+// categoryFacetTree builds the facets of the subcategories of a category that
+// have matching products
+func categoryFacetTree(taxonomy models.Taxonomy, counts map[string]int, parentID, parentPath string) []models.CategoryFacet {
+	var facets []models.CategoryFacet
+	for _, child := range taxonomy.Children(parentID) {
+		path := child.ID
+		if parentPath != "" {
+			path = parentPath + models.CategoryPathSeparator + child.ID
+		}
+		if counts[path] == 0 {
+			continue
+		}
+		facets = append(facets, models.CategoryFacet{
+			ID:       child.ID,
+			Name:     child.Name,
+			Path:     path,
+			Count:    counts[path],
+			Children: categoryFacetTree(taxonomy, counts, child.ID, path),
+		})
+	}
+	sortCategoryFacets(facets)
+	return facets
+}
+
+// sortCategoryFacets orders facets by count, then by name
+func sortCategoryFacets(facets []models.CategoryFacet) {
+	sort.SliceStable(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Name < facets[j].Name
+	})
+}
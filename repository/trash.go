@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// trashPurgeTimeout bounds one purge of expired trash
+	trashPurgeTimeout = 5 * time.Minute
+
+	// trashPurgeBatch is the most expired products loaded at once by a purge
+	trashPurgeBatch = 500
+
+	// TrashActor is recorded for the purges of expired trash
+	TrashActor = "trash"
+)
+
+// ErrProductNotTrashed is returned when restoring a product that is not in the trash
+var ErrProductNotTrashed = errors.New("product is not in the trash")
+
+// setDeletedAt moves a product to the trash, or out of it for nil
+func (r *ProductRepository) setDeletedAt(ctx context.Context, id string, deletedAt *time.Time) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"doc": map[string]interface{}{"deleted_at": deletedAt},
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling product update: %w", err)
+	}
+
+	log.Printf("[ES] SET DELETED_AT - Index: %s, DocumentID: %s, DeletedAt: %v", r.indexName, id, deletedAt)
+
+	req := esapi.UpdateRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+		Body:       bytes.NewReader(data),
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error updating product: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return ErrProductNotFound
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// Restore takes a product out of the trash. Listeners see it as created again.
+func (r *ProductRepository) Restore(ctx context.Context, id string) (*models.Product, error) {
+	product, err := r.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product.DeletedAt == nil {
+		return nil, ErrProductNotTrashed
+	}
+
+	if err := r.setDeletedAt(ctx, id, nil); err != nil {
+		return nil, err
+	}
+	product.DeletedAt = nil
+
+	if err := r.recordChange(ctx, nil, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// Purge permanently deletes a product, whether or not it is in the trash.
+// Listeners are only notified for a product that was not already in the
+// trash; for a trashed product, the purge is only recorded in the history.
+func (r *ProductRepository) Purge(ctx context.Context, id string) error {
+	existing, err := r.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := r.delete(ctx, id); err != nil {
+		return err
+	}
+
+	if existing.DeletedAt == nil {
+		return r.recordChange(ctx, existing, nil)
+	}
+	return r.recordPurge(ctx, existing)
+}
+
+// delete removes a product document
+func (r *ProductRepository) delete(ctx context.Context, id string) error {
+	log.Printf("[ES] DELETE - Index: %s, DocumentID: %s", r.indexName, id)
+
+	req := esapi.DeleteRequest{
+		Index:      r.indexName,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error deleting product: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	log.Printf("[ES] DELETE RESPONSE - Status: %d, Response: %s", res.StatusCode, string(resBody))
+
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return ErrProductNotFound
+		}
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// Trash lists the products in the trash, most recently deleted first
+func (r *ProductRepository) Trash(ctx context.Context, page, pageSize int) ([]models.Product, int, error) {
+	return r.searchProducts(ctx, map[string]interface{}{
+		"query": map[string]interface{}{
+			"exists": map[string]interface{}{"field": "deleted_at"},
+		},
+		"from": (page - 1) * pageSize,
+		"size": pageSize,
+		"sort": []map[string]interface{}{
+			{"deleted_at": map[string]interface{}{"order": "desc"}},
+		},
+	})
+}
+
+// ValidateTrashPurge checks the interval and retention of the trash purge
+func ValidateTrashPurge(interval, retention time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("trash purge interval must be positive, got %s", interval)
+	}
+	if retention <= 0 {
+		return fmt.Errorf("trash retention must be positive, got %s", retention)
+	}
+	return nil
+}
+
+// PurgeTrashEvery permanently deletes products trashed longer than retention,
+// every interval until the process exits. See ValidateTrashPurge.
+func (r *ProductRepository) PurgeTrashEvery(interval, retention time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(WithActor(context.Background(), TrashActor), trashPurgeTimeout)
+		if count, err := r.PurgeTrash(ctx, time.Now().Add(-retention)); err != nil {
+			log.Printf("[TRASH] Failed to purge expired trash: %v", err)
+		} else if count > 0 {
+			log.Printf("[TRASH] Purged %d expired products", count)
+		}
+		cancel()
+		time.Sleep(interval)
+	}
+}
+
+// PurgeTrash permanently deletes the products trashed before a time and
+// returns how many were deleted. Each purge is recorded in the history.
+func (r *ProductRepository) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	log.Printf("[ES] PURGE TRASH - Index: %s, DeletedBefore: %s", r.indexName, deletedBefore.Format(time.RFC3339))
+
+	purged := 0
+	for {
+		expired, _, err := r.searchProducts(ctx, map[string]interface{}{
+			"query": map[string]interface{}{
+				"range": map[string]interface{}{
+					"deleted_at": map[string]interface{}{"lt": deletedBefore},
+				},
+			},
+			"size": trashPurgeBatch,
+			"sort": []map[string]interface{}{
+				{"deleted_at": map[string]interface{}{"order": "asc"}},
+			},
+		})
+		if err != nil {
+			return purged, fmt.Errorf("error loading expired trash: %w", err)
+		}
+
+		for i := range expired {
+			// A product purged meanwhile, e.g. by hand, is already recorded
+			if err := r.delete(ctx, expired[i].ID); err != nil {
+				if errors.Is(err, ErrProductNotFound) {
+					continue
+				}
+				return purged, err
+			}
+			purged++
+			if err := r.recordPurge(ctx, &expired[i]); err != nil {
+				return purged, err
+			}
+		}
+		if len(expired) < trashPurgeBatch {
+			return purged, nil
+		}
+	}
+}
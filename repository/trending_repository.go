@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+const (
+	// TrendingCandidates is the number of top trending products considered
+	TrendingCandidates = 500
+
+	// trendingCacheTTL controls how long the default-window scores used for
+	// ranking are reused
+	trendingCacheTTL = time.Minute
+)
+
+// trendingEventCounters maps event types to the hourly counter they increment
+var trendingEventCounters = map[string]string{
+	models.EventTypeView:      "views",
+	models.EventTypeClick:     "clicks",
+	models.EventTypeAddToCart: "add_to_carts",
+	models.EventTypePurchase:  "purchases",
+}
+
+// TrendingRepository keeps hourly event counters per product and computes a
+// time-decayed trending score from them
+type TrendingRepository struct {
+	client        *elasticsearch.Client
+	indexName     string
+	halfLife      time.Duration
+	defaultWindow time.Duration
+
+	// cached default-window scores used as a ranking signal
+	cacheMu       sync.Mutex
+	cachedScores  map[string]float64
+	cachedScoreAt time.Time
+}
+
+func NewTrendingRepository(client *elasticsearch.Client, indexName string, halfLife, defaultWindow time.Duration) (*TrendingRepository, error) {
+	if halfLife <= 0 {
+		return nil, fmt.Errorf("trending half-life must be positive, got %s", halfLife)
+	}
+	return &TrendingRepository{
+		client:        client,
+		indexName:     indexName,
+		halfLife:      halfLife,
+		defaultWindow: defaultWindow,
+	}, nil
+}
+
+// HandleEvent increments the hourly counter of every product in the event
+func (r *TrendingRepository) HandleEvent(ctx context.Context, event *models.Event) error {
+	field, ok := trendingEventCounters[event.Type]
+	if !ok {
+		return nil
+	}
+	weight := eventWeights[event.Type]
+
+	bucket := event.Timestamp.UTC().Truncate(time.Hour)
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, productID := range uniqueIDs(event.ProductIDs) {
+		action := map[string]interface{}{
+			"update": map[string]interface{}{
+				"_index":            r.indexName,
+				"_id":               productID + ":" + bucket.Format(time.RFC3339),
+				"retry_on_conflict": 3,
+			},
+		}
+		upsert := map[string]interface{}{
+			"product_id":   productID,
+			"bucket":       bucket,
+			"views":        0,
+			"clicks":       0,
+			"add_to_carts": 0,
+			"purchases":    0,
+			"weighted":     weight,
+		}
+		upsert[field] = 1
+		update := map[string]interface{}{
+			"script": map[string]interface{}{
+				"source": "ctx._source[params.field] += 1; ctx._source.weighted += params.weight",
+				"params": map[string]interface{}{"field": field, "weight": weight},
+			},
+			"upsert": upsert,
+		}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("error encoding bulk action: %w", err)
+		}
+		if err := encoder.Encode(update); err != nil {
+			return fmt.Errorf("error encoding bulk update: %w", err)
+		}
+	}
+
+	res, err := r.client.Bulk(
+		&body,
+		r.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating trending counters: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk trending update had failures: %s", string(resBody))
+	}
+
+	return nil
+}
+
+// TopTrending returns the products with the highest decayed score over the
+// window, among productIDs unless it is nil. Each hourly bucket contributes its
+// weighted event count multiplied by 0.5^(age / half-life), so recent
+// activity outweighs lifetime totals.
+func (r *TrendingRepository) TopTrending(ctx context.Context, window time.Duration, limit int, productIDs []string) ([]models.TrendingScore, error) {
+	if productIDs != nil && len(productIDs) == 0 {
+		return []models.TrendingScore{}, nil
+	}
+	now := time.Now()
+
+	filters := []map[string]interface{}{
+		{"range": map[string]interface{}{
+			"bucket": map[string]interface{}{
+				"gte": now.Add(-window).UTC().Truncate(time.Hour),
+			},
+		}},
+	}
+	if productIDs != nil {
+		filters = append(filters, map[string]interface{}{
+			"terms": map[string]interface{}{"product_id": productIDs},
+		})
+	}
+
+	searchBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"aggs": map[string]interface{}{
+			"products": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "product_id",
+					"size":  limit,
+					"order": map[string]interface{}{"trending": "desc"},
+				},
+				"aggs": map[string]interface{}{
+					"trending": map[string]interface{}{
+						"sum": map[string]interface{}{
+							"script": map[string]interface{}{
+								"source": "doc['weighted'].value * Math.pow(0.5, (params.now - doc['bucket'].value.toInstant().toEpochMilli()) / params.half_life)",
+								"params": map[string]interface{}{
+									"now":       now.UnixMilli(),
+									"half_life": float64(r.halfLife.Milliseconds()),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
+		return nil, fmt.Errorf("error encoding trending query: %w", err)
+	}
+
+	log.Printf("[ES] TRENDING - Index: %s, Window: %s", r.indexName, window)
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(ctx),
+		r.client.Search.WithIndex(r.indexName),
+		r.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error executing trending query: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return nil, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Aggregations struct {
+			Products struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					Trending struct {
+						Value float64 `json:"value"`
+					} `json:"trending"`
+				} `json:"buckets"`
+			} `json:"products"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	scores := make([]models.TrendingScore, 0, len(result.Aggregations.Products.Buckets))
+	for _, bucket := range result.Aggregations.Products.Buckets {
+		scores = append(scores, models.TrendingScore{
+			ProductID: bucket.Key,
+			Score:     bucket.Trending.Value,
+		})
+	}
+	return scores, nil
+}
+
+// TrendingScores returns the default-window trending score by product ID,
+// cached for trendingCacheTTL
+func (r *TrendingRepository) TrendingScores(ctx context.Context) (map[string]float64, error) {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+
+	if r.cachedScores != nil && time.Since(r.cachedScoreAt) < trendingCacheTTL {
+		return r.cachedScores, nil
+	}
+
+	top, err := r.TopTrending(ctx, r.defaultWindow, TrendingCandidates, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float64, len(top))
+	for _, score := range top {
+		scores[score.ProductID] = score.Score
+	}
+
+	r.cachedScores = scores
+	r.cachedScoreAt = time.Now()
+	return scores, nil
+}
+
+// TrendingAmong returns the top default-window trending scores among the
+// given products, such as the products of a category
+func (r *TrendingRepository) TrendingAmong(ctx context.Context, productIDs []string) ([]models.TrendingScore, error) {
+	return r.TopTrending(ctx, r.defaultWindow, TrendingCandidates, productIDs)
+}
@@ -0,0 +1,433 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/google/uuid"
+)
+
+// maxWebhooks caps the registered webhooks loaded per product change
+const maxWebhooks = 1000
+
+var (
+	// ErrWebhookNotFound is returned when a webhook ID does not exist
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrDeliveryNotFound is returned when a delivery ID does not exist
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// WebhookRepository stores webhook endpoints and their delivery queue. Each
+// product change queues one delivery per subscribed webhook; the queue lives
+// in Elasticsearch so pending retries survive restarts.
+type WebhookRepository struct {
+	client          *elasticsearch.Client
+	webhooksIndex   string
+	deliveriesIndex string
+}
+
+func NewWebhookRepository(client *elasticsearch.Client, webhooksIndex, deliveriesIndex string) *WebhookRepository {
+	return &WebhookRepository{
+		client:          client,
+		webhooksIndex:   webhooksIndex,
+		deliveriesIndex: deliveriesIndex,
+	}
+}
+
+// Create registers a webhook, generating its signing secret when none is given
+func (r *WebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	webhook.ID = uuid.New().String()
+	webhook.CreatedAt = time.Now()
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("error generating webhook secret: %w", err)
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	log.Printf("[ES] CREATE WEBHOOK - Index: %s, DocumentID: %s, URL: %s", r.webhooksIndex, webhook.ID, webhook.URL)
+	return r.put(ctx, r.webhooksIndex, webhook.ID, webhook, "true")
+}
+
+// List returns the registered webhooks without their secrets
+func (r *WebhookRepository) List(ctx context.Context) ([]models.Webhook, error) {
+	webhooks, err := r.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// all returns the registered webhooks, oldest first
+func (r *WebhookRepository) all(ctx context.Context) ([]models.Webhook, error) {
+	searchBody := map[string]interface{}{
+		"size": maxWebhooks,
+		"sort": []map[string]interface{}{
+			{"created_at": map[string]interface{}{"order": "asc"}},
+		},
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.Webhook `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.webhooksIndex, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]models.Webhook, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		webhooks = append(webhooks, hit.Source)
+	}
+	return webhooks, nil
+}
+
+// Get returns a webhook, including its secret
+func (r *WebhookRepository) Get(ctx context.Context, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := r.get(ctx, r.webhooksIndex, id, &webhook); err != nil {
+		if errors.Is(err, errDocumentNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Delete removes a webhook. Its pending deliveries become dead letters on their next attempt.
+func (r *WebhookRepository) Delete(ctx context.Context, id string) error {
+	log.Printf("[ES] DELETE WEBHOOK - Index: %s, DocumentID: %s", r.webhooksIndex, id)
+
+	req := esapi.DeleteRequest{
+		Index:      r.webhooksIndex,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return ErrWebhookNotFound
+		}
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
+
+// HandleProductChange queues a delivery of the change for every subscribed webhook
+func (r *WebhookRepository) HandleProductChange(ctx context.Context, before, after *models.Product) error {
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+	}
+	switch {
+	case before == nil:
+		event.Type, event.Product = models.WebhookEventProductCreated, after
+	case after == nil:
+		event.Type, event.Product = models.WebhookEventProductDeleted, before
+	default:
+		event.Type, event.Product = models.WebhookEventProductUpdated, after
+	}
+	event.ProductID = event.Product.ID
+
+	webhooks, err := r.all(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading webhooks: %w", err)
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	queued := 0
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event.Type) {
+			continue
+		}
+
+		delivery := models.WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     webhook.ID,
+			EventType:     event.Type,
+			Event:         event,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: event.Timestamp,
+			History:       []models.DeliveryAttempt{},
+			CreatedAt:     event.Timestamp,
+			UpdatedAt:     event.Timestamp,
+		}
+		action := map[string]interface{}{
+			"index": map[string]interface{}{
+				"_index": r.deliveriesIndex,
+				"_id":    delivery.ID,
+			},
+		}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("error encoding bulk action: %w", err)
+		}
+		if err := encoder.Encode(delivery); err != nil {
+			return fmt.Errorf("error encoding delivery: %w", err)
+		}
+		queued++
+	}
+	if queued == 0 {
+		return nil
+	}
+
+	log.Printf("[ES] QUEUE WEBHOOKS - Index: %s, Event: %s, ProductID: %s, Deliveries: %d", r.deliveriesIndex, event.Type, event.ProductID, queued)
+
+	res, err := r.client.Bulk(
+		&body,
+		r.client.Bulk.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("error queueing deliveries: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk delivery queueing had failures: %s", string(resBody))
+	}
+	return nil
+}
+
+// DueDeliveries returns pending deliveries whose next attempt is due, oldest due first
+func (r *WebhookRepository) DueDeliveries(ctx context.Context, now time.Time, size int) ([]models.WebhookDelivery, error) {
+	return r.deliveries(ctx, map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"term": map[string]interface{}{"status": models.DeliveryPending}},
+				{"range": map[string]interface{}{"next_attempt_at": map[string]interface{}{"lte": now}}},
+			},
+		},
+	}, "next_attempt_at", "asc", size)
+}
+
+// ListDeliveries returns the latest deliveries, optionally of one status and webhook
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, status, webhookID string, size int) ([]models.WebhookDelivery, error) {
+	filters := []map[string]interface{}{}
+	if status != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"status": status}})
+	}
+	if webhookID != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"webhook_id": webhookID}})
+	}
+
+	return r.deliveries(ctx, map[string]interface{}{
+		"bool": map[string]interface{}{"filter": filters},
+	}, "created_at", "desc", size)
+}
+
+// deliveries runs a delivery query sorted on a field
+func (r *WebhookRepository) deliveries(ctx context.Context, query map[string]interface{}, sortField, order string, size int) ([]models.WebhookDelivery, error) {
+	searchBody := map[string]interface{}{
+		"size":  size,
+		"query": query,
+		"sort": []map[string]interface{}{
+			{sortField: map[string]interface{}{"order": order}},
+		},
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.WebhookDelivery `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := searchIndex(ctx, r.client, r.deliveriesIndex, searchBody, &result); err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		deliveries = append(deliveries, hit.Source)
+	}
+	return deliveries, nil
+}
+
+// GetDelivery returns a delivery with its attempts
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := r.get(ctx, r.deliveriesIndex, id, &delivery); err != nil {
+		if errors.Is(err, errDocumentNotFound) {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// SaveDelivery stores the state of a delivery after an attempt. The refresh
+// keeps the dispatcher from picking up a stale copy on its next poll.
+func (r *WebhookRepository) SaveDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	return r.put(ctx, r.deliveriesIndex, delivery.ID, delivery, "wait_for")
+}
+
+// Replay queues a delivery again for an immediate attempt with a fresh
+// retry budget; its attempt history is kept
+func (r *WebhookRepository) Replay(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	delivery, err := r.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := r.SaveDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ReplayDead queues every dead letter again, optionally only those of one
+// webhook, and returns how many were replayed
+func (r *WebhookRepository) ReplayDead(ctx context.Context, webhookID string) (int, error) {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"status": models.DeliveryDead}},
+	}
+	if webhookID != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"webhook_id": webhookID}})
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": "ctx._source.status = params.status; ctx._source.attempts = 0; ctx._source.next_attempt_at = params.now; ctx._source.updated_at = params.now",
+			"params": map[string]interface{}{"status": models.DeliveryPending, "now": now},
+		},
+	}); err != nil {
+		return 0, fmt.Errorf("error encoding replay query: %w", err)
+	}
+
+	log.Printf("[ES] REPLAY DEAD LETTERS - Index: %s, WebhookID: %q", r.deliveriesIndex, webhookID)
+
+	res, err := r.client.UpdateByQuery(
+		[]string{r.deliveriesIndex},
+		r.client.UpdateByQuery.WithContext(ctx),
+		r.client.UpdateByQuery.WithBody(&buf),
+		r.client.UpdateByQuery.WithConflicts("proceed"),
+		r.client.UpdateByQuery.WithRefresh(true),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error replaying dead letters: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		return 0, fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Updated int `json:"updated"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return 0, fmt.Errorf("error decoding response: %w", err)
+	}
+	return result.Updated, nil
+}
+
+// errDocumentNotFound is returned by get for a missing document
+var errDocumentNotFound = errors.New("document not found")
+
+// get decodes the source of a document
+func (r *WebhookRepository) get(ctx context.Context, index, id string, dest interface{}) error {
+	req := esapi.GetRequest{
+		Index:      index,
+		DocumentID: id,
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error getting document: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	if res.IsError() {
+		if res.StatusCode == 404 {
+			return errDocumentNotFound
+		}
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+
+	var result struct {
+		Source json.RawMessage `json:"_source"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if err := json.Unmarshal(result.Source, dest); err != nil {
+		return fmt.Errorf("error decoding document: %w", err)
+	}
+	return nil
+}
+
+// put indexes a document with the given refresh policy
+func (r *WebhookRepository) put(ctx context.Context, index, id string, document interface{}, refresh string) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("error marshaling document: %w", err)
+	}
+
+	req := esapi.IndexRequest{
+		Index:      index,
+		DocumentID: id,
+		Body:       bytes.NewReader(data),
+		Refresh:    refresh,
+	}
+
+	res, err := req.Do(ctx, r.client)
+	if err != nil {
+		return fmt.Errorf("error indexing document: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("error response: %s", string(resBody))
+	}
+	return nil
+}
@@ -5,7 +5,24 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(router *gin.Engine, handler *handlers.ProductHandler) {
+// Handlers groups the HTTP handlers served by the API
+type Handlers struct {
+	Product        *handlers.ProductHandler
+	Event          *handlers.EventHandler
+	Recommendation *handlers.RecommendationHandler
+	Experiment     *handlers.ExperimentHandler
+	Admin          *handlers.AdminHandler
+	Suggestion     *handlers.SuggestionHandler
+	Alert          *handlers.AlertHandler
+	Webhook        *handlers.WebhookHandler
+	Change         *handlers.ChangeHandler
+	Audit          *handlers.AuditHandler
+	Promotion      *handlers.PromotionHandler
+	Currency       *handlers.CurrencyHandler
+	Category       *handlers.CategoryHandler
+}
+
+func SetupRoutes(router *gin.Engine, h *Handlers) {
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -16,12 +33,72 @@ func SetupRoutes(router *gin.Engine, handler *handlers.ProductHandler) {
 	{
 		products := v1.Group("/products")
 		{
-			products.POST("", handler.CreateProduct)
-			products.GET("", handler.GetAllProducts)
-			products.GET("/search", handler.SearchProducts)
-			products.GET("/:id", handler.GetProduct)
-			products.PUT("/:id", handler.UpdateProduct)
-			products.DELETE("/:id", handler.DeleteProduct)
+			products.POST("", h.Product.CreateProduct)
+			products.GET("", h.Product.GetAllProducts)
+			products.GET("/search", h.Product.SearchProducts)
+			products.GET("/autocomplete", h.Suggestion.Autocomplete)
+			products.GET("/trending", h.Recommendation.GetTrending)
+			products.GET("/_changes", h.Change.StreamChanges)
+			products.GET("/:id", h.Product.GetProduct)
+			products.GET("/:id/similar", h.Product.GetSimilarProducts)
+			products.GET("/:id/bought-together", h.Recommendation.GetBoughtTogether)
+			products.GET("/:id/history", h.Audit.GetHistory)
+			products.POST("/:id/revert", h.Audit.RevertProduct)
+			products.POST("/:id/restore", h.Product.RestoreProduct)
+			products.PUT("/:id", h.Product.UpdateProduct)
+			products.DELETE("/:id", h.Product.DeleteProduct)
+		}
+
+		v1.POST("/events", h.Event.RecordEvent)
+
+		categories := v1.Group("/categories")
+		{
+			categories.GET("", h.Category.ListCategories)
+			categories.GET("/:id", h.Category.GetCategory)
+		}
+
+		alerts := v1.Group("/alerts")
+		{
+			alerts.POST("", h.Alert.CreateAlert)
+			alerts.GET("", h.Alert.ListAlerts)
+			alerts.DELETE("/:id", h.Alert.DeleteAlert)
+		}
+
+		experiments := v1.Group("/experiments")
+		{
+			experiments.GET("", h.Experiment.ListExperiments)
+			experiments.GET("/:name/report", h.Experiment.GetReport)
+		}
+
+		admin := v1.Group("/admin")
+		{
+			admin.GET("/shadow", h.Admin.GetShadowSummary)
+			admin.GET("/products", h.Product.ListProducts)
+			admin.GET("/products/trash", h.Product.ListTrash)
+			admin.GET("/products/:id", h.Product.PreviewProduct)
+			admin.GET("/ltr/export", h.Admin.ExportFeatures)
+			admin.GET("/analytics/queries", h.Admin.GetTopQueries)
+			admin.GET("/analytics/zero-results", h.Admin.GetZeroResultQueries)
+			admin.GET("/analytics/low-ctr", h.Admin.GetLowCTRQueries)
+			admin.GET("/analytics/filters", h.Admin.GetFilterUsage)
+			admin.POST("/suggestions/refresh", h.Admin.RefreshSuggestions)
+			admin.POST("/webhooks", h.Webhook.CreateWebhook)
+			admin.GET("/webhooks", h.Webhook.ListWebhooks)
+			admin.DELETE("/webhooks/:id", h.Webhook.DeleteWebhook)
+			admin.GET("/webhooks/deliveries", h.Webhook.ListDeliveries)
+			admin.GET("/webhooks/deliveries/:id", h.Webhook.GetDelivery)
+			admin.POST("/webhooks/deliveries/:id/replay", h.Webhook.ReplayDelivery)
+			admin.POST("/webhooks/deliveries/replay", h.Webhook.ReplayDeadLetters)
+			admin.POST("/promotions", h.Promotion.CreatePromotion)
+			admin.GET("/promotions", h.Promotion.ListPromotions)
+			admin.GET("/promotions/:id", h.Promotion.GetPromotion)
+			admin.PUT("/promotions/:id", h.Promotion.UpdatePromotion)
+			admin.DELETE("/promotions/:id", h.Promotion.DeletePromotion)
+			admin.GET("/currencies", h.Currency.ListCurrencies)
+			admin.PUT("/currencies/:code", h.Currency.SetRate)
+			admin.POST("/categories", h.Category.CreateCategory)
+			admin.PUT("/categories/:id", h.Category.UpdateCategory)
+			admin.DELETE("/categories/:id", h.Category.DeleteCategory)
 		}
 	}
 }
@@ -0,0 +1,85 @@
+package shadow
+
+// topK is the number of leading results compared
+const topK = 10
+
+// top returns at most the first topK IDs
+func top(ids []string) []string {
+	if len(ids) > topK {
+		return ids[:topK]
+	}
+	return ids
+}
+
+// jaccard is |A ∩ B| / |A ∪ B|; two empty lists are identical
+func jaccard(a, b []string) float64 {
+	setA := make(map[string]bool, len(a))
+	for _, id := range a {
+		setA[id] = true
+	}
+	union := make(map[string]bool, len(a)+len(b))
+	for id := range setA {
+		union[id] = true
+	}
+
+	shared := make(map[string]bool, len(b))
+	for _, id := range b {
+		union[id] = true
+		if setA[id] {
+			shared[id] = true
+		}
+	}
+
+	if len(union) == 0 {
+		return 1
+	}
+	return float64(len(shared)) / float64(len(union))
+}
+
+// kendallTau measures how consistently the products present in both rankings
+// are ordered: 1 for the same order, -1 for the reverse. ok is false when fewer
+// than two products are shared.
+func kendallTau(a, b []string) (tau float64, ok bool) {
+	rankB := make(map[string]int, len(b))
+	for i, id := range b {
+		rankB[id] = i
+	}
+
+	var shared []int // ranks in b of shared products, in a's order
+	for _, id := range a {
+		if rank, found := rankB[id]; found {
+			shared = append(shared, rank)
+		}
+	}
+	if len(shared) < 2 {
+		return 0, false
+	}
+
+	concordant, discordant := 0, 0
+	for i := 0; i < len(shared); i++ {
+		for j := i + 1; j < len(shared); j++ {
+			if shared[i] < shared[j] {
+				concordant++
+			} else {
+				discordant++
+			}
+		}
+	}
+	return float64(concordant-discordant) / float64(concordant+discordant), true
+}
+
+// newItems counts products of candidate that are not in production
+func newItems(production, candidate []string) int {
+	inProduction := make(map[string]bool, len(production))
+	for _, id := range production {
+		inProduction[id] = true
+	}
+
+	count := 0
+	for _, id := range candidate {
+		if !inProduction[id] {
+			count++
+		}
+	}
+	return count
+}
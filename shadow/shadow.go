@@ -0,0 +1,273 @@
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+)
+
+const (
+	// queueSize bounds the sampled searches waiting for evaluation; further
+	// samples are dropped so shadow traffic never backs up
+	queueSize = 100
+
+	// workers is the number of concurrent shadow searches
+	workers = 2
+
+	// searchTimeout bounds a single shadow search
+	searchTimeout = 5 * time.Second
+
+	// recentComparisons is the number of comparisons kept for the summary
+	recentComparisons = 50
+)
+
+// Searcher runs searches the same way the search endpoint does
+type Searcher interface {
+	SearchWithFallback(ctx context.Context, searchReq *models.ProductSearchRequest, steps []string) (*models.SearchResult, error)
+}
+
+// job is a sampled search with the product IDs production returned
+type job struct {
+	request    models.ProductSearchRequest
+	production []string
+}
+
+// Evaluator re-runs a sample of searches with a candidate ranking profile in
+// the background and compares the results with what production served
+type Evaluator struct {
+	searcher      Searcher
+	candidate     models.RankingProfile
+	sampleRate    float64
+	fallbackSteps []string
+	jobs          chan job
+
+	mu      sync.Mutex
+	summary models.ShadowSummary
+	// running totals behind the summary means
+	jaccardSum, tauSum, newSum float64
+	tauCount, identical        int
+}
+
+// NewEvaluator starts the shadow workers; a zero sample rate disables shadow mode
+func NewEvaluator(searcher Searcher, candidate models.RankingProfile, sampleRate float64, fallbackSteps []string) *Evaluator {
+	e := &Evaluator{
+		searcher:      searcher,
+		candidate:     candidate,
+		sampleRate:    sampleRate,
+		fallbackSteps: fallbackSteps,
+		summary: models.ShadowSummary{
+			Enabled:    sampleRate > 0,
+			SampleRate: sampleRate,
+			Candidate:  candidate,
+		},
+	}
+
+	if sampleRate > 0 {
+		e.jobs = make(chan job, queueSize)
+		for i := 0; i < workers; i++ {
+			go e.work()
+		}
+	}
+	return e
+}
+
+// LoadCandidate reads the candidate ranking profile: a JSON object of ranking
+// profile fields applied on top of the defaults
+func LoadCandidate(path string, defaults models.RankingProfile) (models.RankingProfile, error) {
+	candidate := defaults
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return candidate, fmt.Errorf("error reading shadow profile: %w", err)
+	}
+	if err := json.Unmarshal(data, &candidate); err != nil {
+		return candidate, fmt.Errorf("error decoding shadow profile: %w", err)
+	}
+	if err := repository.ValidateRankingProfile(candidate); err != nil {
+		return candidate, err
+	}
+	return candidate, nil
+}
+
+// Submit samples a served search for shadow evaluation. searchReq is the
+// request as received, before the search applied defaults or relaxations.
+// It never blocks: when the queue is full the sample is dropped.
+func (e *Evaluator) Submit(searchReq models.ProductSearchRequest, products []models.Product) {
+	if e.sampleRate <= 0 || rand.Float64() >= e.sampleRate {
+		return
+	}
+
+	production := make([]string, len(products))
+	for i, product := range products {
+		production[i] = product.ID
+	}
+
+	select {
+	case e.jobs <- job{request: searchReq, production: production}:
+	default:
+		e.mu.Lock()
+		e.summary.Dropped++
+		e.mu.Unlock()
+	}
+}
+
+// work evaluates queued searches until the process exits
+func (e *Evaluator) work() {
+	for j := range e.jobs {
+		e.evaluate(j)
+	}
+}
+
+// evaluate runs the candidate ranking for a sampled search and records the comparison
+func (e *Evaluator) evaluate(j job) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+
+	// The metrics compare the top results, so a search served past the first
+	// page or with fewer than topK results per page is re-run from the top
+	productionIDs := j.production
+	if !servedTop(j.request) {
+		productionReq := topRequest(j.request)
+		ids, err := e.search(ctx, &productionReq)
+		if err != nil {
+			log.Printf("[SHADOW] Production search failed for query %q: %v", j.request.Query, err)
+			e.fail()
+			return
+		}
+		productionIDs = ids
+	}
+
+	searchReq := topRequest(j.request)
+	candidateProfile := e.candidate
+	searchReq.Ranking = &candidateProfile
+
+	candidateIDs, err := e.search(ctx, &searchReq)
+	if err != nil {
+		log.Printf("[SHADOW] Candidate search failed for query %q: %v", j.request.Query, err)
+		e.fail()
+		return
+	}
+
+	production, candidate := top(productionIDs), top(candidateIDs)
+	comparison := models.ShadowComparison{
+		Query:       j.request.Query,
+		Category:    j.request.Category,
+		Jaccard:     jaccard(production, candidate),
+		NewInTop10:  newItems(production, candidate),
+		Production:  production,
+		Candidate:   candidate,
+		EvaluatedAt: time.Now(),
+	}
+	if tau, ok := kendallTau(production, candidate); ok {
+		comparison.KendallTau = &tau
+	}
+
+	tau := "n/a"
+	if comparison.KendallTau != nil {
+		tau = fmt.Sprintf("%.3f", *comparison.KendallTau)
+	}
+	log.Printf("[SHADOW] Query: %q, Category: %q, Jaccard@10: %.3f, KendallTau: %s, NewInTop10: %d",
+		comparison.Query, comparison.Category, comparison.Jaccard, tau, comparison.NewInTop10)
+
+	e.record(comparison)
+}
+
+// search runs a shadow search and returns the IDs of the products found
+func (e *Evaluator) search(ctx context.Context, searchReq *models.ProductSearchRequest) ([]string, error) {
+	result, err := e.searcher.SearchWithFallback(ctx, searchReq, e.fallbackSteps)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(result.Products))
+	for i, product := range result.Products {
+		ids[i] = product.ID
+	}
+	return ids, nil
+}
+
+// fail counts a sample that could not be evaluated
+func (e *Evaluator) fail() {
+	e.mu.Lock()
+	e.summary.Failed++
+	e.mu.Unlock()
+}
+
+// servedTop reports whether a request was served the first page with at
+// least topK results on it; an unset page size uses the default of 10
+func servedTop(searchReq models.ProductSearchRequest) bool {
+	pageSize := searchReq.PageSize
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	return searchReq.Page <= 1 && pageSize >= topK
+}
+
+// topRequest returns a copy of the request asking for the first topK results
+func topRequest(searchReq models.ProductSearchRequest) models.ProductSearchRequest {
+	searchReq.Page = 1
+	if searchReq.PageSize < topK {
+		searchReq.PageSize = topK
+	}
+	return searchReq
+}
+
+// record adds a comparison to the running summary
+func (e *Evaluator) record(comparison models.ShadowComparison) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.summary.Evaluated++
+	e.jaccardSum += comparison.Jaccard
+	e.newSum += float64(comparison.NewInTop10)
+	if comparison.KendallTau != nil {
+		e.tauSum += *comparison.KendallTau
+		e.tauCount++
+	}
+	if sameOrder(comparison.Production, comparison.Candidate) {
+		e.identical++
+	}
+
+	e.summary.Recent = append([]models.ShadowComparison{comparison}, e.summary.Recent...)
+	if len(e.summary.Recent) > recentComparisons {
+		e.summary.Recent = e.summary.Recent[:recentComparisons]
+	}
+}
+
+// Summary returns the aggregated comparisons since startup
+func (e *Evaluator) Summary() models.ShadowSummary {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	summary := e.summary
+	summary.Recent = append([]models.ShadowComparison{}, e.summary.Recent...)
+	if summary.Evaluated > 0 {
+		summary.MeanJaccard = e.jaccardSum / float64(summary.Evaluated)
+		summary.MeanNewInTop10 = e.newSum / float64(summary.Evaluated)
+		summary.IdenticalTop10 = float64(e.identical) / float64(summary.Evaluated)
+	}
+	if e.tauCount > 0 {
+		summary.MeanKendallTau = e.tauSum / float64(e.tauCount)
+	}
+	return summary
+}
+
+func sameOrder(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+// Package webhook delivers queued product change events to registered
+// webhooks, with signed payloads and retries.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aditya/elasticsearch-products-api/models"
+	"github.com/aditya/elasticsearch-products-api/repository"
+)
+
+const (
+	// dispatchBatch is the most due deliveries attempted per poll
+	dispatchBatch = 100
+
+	// workers is the number of concurrent deliveries
+	workers = 4
+
+	// requestTimeout bounds one webhook call
+	requestTimeout = 10 * time.Second
+
+	// maxBackoff caps the delay between two attempts
+	maxBackoff = 6 * time.Hour
+
+	// maxErrorBody is how much of a failed response is kept as the error
+	maxErrorBody = 512
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Store is the persistent delivery queue
+type Store interface {
+	DueDeliveries(ctx context.Context, now time.Time, size int) ([]models.WebhookDelivery, error)
+	SaveDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	Get(ctx context.Context, id string) (*models.Webhook, error)
+}
+
+// Dispatcher polls the queue for due deliveries and POSTs them. A failed
+// delivery is retried after retryBase, doubling with every attempt; after
+// maxAttempts it becomes a dead letter.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	maxAttempts  int
+	retryBase    time.Duration
+	pollInterval time.Duration
+}
+
+func NewDispatcher(store Store, maxAttempts int, retryBase, pollInterval time.Duration) (*Dispatcher, error) {
+	if maxAttempts <= 0 {
+		return nil, fmt.Errorf("max attempts must be positive, got %d", maxAttempts)
+	}
+	if retryBase <= 0 {
+		return nil, fmt.Errorf("retry base must be positive, got %s", retryBase)
+	}
+	if pollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %s", pollInterval)
+	}
+	return &Dispatcher{
+		store:        store,
+		client:       &http.Client{Timeout: requestTimeout},
+		maxAttempts:  maxAttempts,
+		retryBase:    retryBase,
+		pollInterval: pollInterval,
+	}, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// webhook secret. Receivers recompute it to authenticate a delivery, and
+// reject old timestamps to prevent replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is the delay before the next attempt after a number of failed attempts
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.retryBase
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// Run delivers due deliveries every poll interval until the process exits
+func (d *Dispatcher) Run() {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.poll()
+	}
+}
+
+// poll attempts one batch of due deliveries
+func (d *Dispatcher) poll() {
+	ctx := context.Background()
+
+	due, err := d.store.DueDeliveries(ctx, time.Now(), dispatchBatch)
+	if err != nil {
+		log.Printf("[WEBHOOK] Failed to load due deliveries: %v", err)
+		return
+	}
+
+	webhooks := make(map[string]*models.Webhook)
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+	for i := range due {
+		delivery := &due[i]
+
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = d.store.Get(ctx, delivery.WebhookID)
+			if err != nil && !errors.Is(err, repository.ErrWebhookNotFound) {
+				log.Printf("[WEBHOOK] Failed to load webhook %s: %v", delivery.WebhookID, err)
+				continue
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			d.attempt(ctx, webhook, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt makes one delivery attempt and stores the outcome. A nil webhook
+// was deleted, so the delivery becomes a dead letter without a call.
+func (d *Dispatcher) attempt(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) {
+	var attempt models.DeliveryAttempt
+	if webhook == nil {
+		attempt = models.DeliveryAttempt{At: time.Now(), Error: "webhook deleted"}
+		delivery.Attempts = d.maxAttempts
+	} else {
+		attempt = d.send(ctx, webhook, delivery)
+		delivery.Attempts++
+	}
+	delivery.History = append(delivery.History, attempt)
+
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = attempt.Error
+		log.Printf("[WEBHOOK] Delivery %s to webhook %s is dead after %d attempts: %s", delivery.ID, delivery.WebhookID, delivery.Attempts, attempt.Error)
+	default:
+		delivery.LastError = attempt.Error
+		delivery.NextAttemptAt = time.Now().Add(d.Backoff(delivery.Attempts))
+		log.Printf("[WEBHOOK] Delivery %s to webhook %s failed (attempt %d), retrying at %s: %s",
+			delivery.ID, delivery.WebhookID, delivery.Attempts, delivery.NextAttemptAt.Format(time.RFC3339), attempt.Error)
+	}
+
+	if err := d.store.SaveDelivery(ctx, delivery); err != nil {
+		log.Printf("[WEBHOOK] Failed to save delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the signed event; any non-2xx response is a failure
+func (d *Dispatcher) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (attempt models.DeliveryAttempt) {
+	attempt.At = time.Now()
+	defer func() { attempt.DurationMs = time.Since(attempt.At).Milliseconds() }()
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("error encoding event: %v", err)
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = fmt.Sprintf("error creating request: %v", err)
+		return attempt
+	}
+	timestamp := strconv.FormatInt(attempt.At.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(webhook.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		attempt.Error = fmt.Sprintf("status %d: %s", res.StatusCode, string(resBody))
+	}
+	return attempt
+}